@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the optional YAML file given with -config
+type Config struct {
+	ProcessActions ProcessActionsConfig `yaml:"process_actions"`
+	Diagnostics    DiagnosticsConfig    `yaml:"diagnostics"`
+}
+
+// ProcessActionsConfig allows signals and priority changes from the
+// dashboard. With no users or commands listed every action is refused.
+type ProcessActionsConfig struct {
+	// AllowUsers are the owners, by name or UID, whose processes may be acted on
+	AllowUsers []string `yaml:"allow_users"`
+	// AllowCommands are shell-style patterns matched against the command name
+	AllowCommands []string `yaml:"allow_commands"`
+	// ConfirmTimeout is how long a confirmation token stays valid
+	ConfirmTimeout time.Duration `yaml:"confirm_timeout"`
+}
+
+// DiagnosticsConfig limits the network diagnostics run from the dashboard
+type DiagnosticsConfig struct {
+	// DenyPrivate refuses targets in loopback, private, link-local and
+	// carrier-grade NAT ranges. It is on unless the config turns it off.
+	DenyPrivate bool `yaml:"deny_private"`
+	// DenyNetworks are further CIDR ranges that may not be targeted
+	DenyNetworks []string `yaml:"deny_networks"`
+	// The timeouts bound each step of a diagnostics run
+	DNSTimeout        time.Duration `yaml:"dns_timeout"`
+	ConnectTimeout    time.Duration `yaml:"connect_timeout"`
+	HTTPTimeout       time.Duration `yaml:"http_timeout"`
+	TracerouteTimeout time.Duration `yaml:"traceroute_timeout"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		ProcessActions: ProcessActionsConfig{ConfirmTimeout: time.Minute},
+		Diagnostics: DiagnosticsConfig{
+			DenyPrivate:       true,
+			DNSTimeout:        5 * time.Second,
+			ConnectTimeout:    5 * time.Second,
+			HTTPTimeout:       10 * time.Second,
+			TracerouteTimeout: 20 * time.Second,
+		},
+	}
+}
+
+// loadConfig reads the config file, or returns the defaults when path is empty
+func loadConfig(file string) (Config, error) {
+	config := defaultConfig()
+	if file == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading config: %v", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return Config{}, fmt.Errorf("error parsing config %s: %v", file, err)
+	}
+	if err := config.validate(); err != nil {
+		return Config{}, fmt.Errorf("error in config %s: %v", file, err)
+	}
+	return config, nil
+}
+
+func (c Config) validate() error {
+	if c.ProcessActions.ConfirmTimeout <= 0 {
+		return fmt.Errorf("process_actions.confirm_timeout must be positive")
+	}
+	for _, pattern := range c.ProcessActions.AllowCommands {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("process_actions.allow_commands: bad pattern %q", pattern)
+		}
+	}
+	d := c.Diagnostics
+	if d.DNSTimeout <= 0 || d.ConnectTimeout <= 0 || d.HTTPTimeout <= 0 || d.TracerouteTimeout <= 0 {
+		return fmt.Errorf("diagnostics timeouts must be positive")
+	}
+	for _, cidr := range d.DenyNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("diagnostics.deny_networks: %v", err)
+		}
+	}
+	return nil
+}
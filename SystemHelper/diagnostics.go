@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetworkDiagnostics represents network test results. The target is
+// resolved once, and the checks connect to the first address so they all
+// test the same host.
+type NetworkDiagnostics struct {
+	Target string
+	// Addresses are what the target resolved to
+	Addresses  []string
+	DNS        DNSResult
+	TCP        []TCPResult
+	HTTP       *HTTPResult       `json:",omitempty"`
+	Traceroute *TracerouteResult `json:",omitempty"`
+	// Error is set when the target did not resolve, so only DNS was checked
+	// and the other steps are missing
+	Error     string `json:",omitempty"`
+	LastCheck time.Time
+}
+
+// DiagnosticStep is what every step reports
+type DiagnosticStep struct {
+	Error string `json:",omitempty"`
+	// Millis is how long the step took
+	Millis float64
+}
+
+func (s *DiagnosticStep) finish(start time.Time, err error) {
+	s.Millis = float64(time.Since(start)) / float64(time.Millisecond)
+	if err != nil {
+		s.Error = err.Error()
+	}
+}
+
+// DNSResult is the answer to a lookup of one record type
+type DNSResult struct {
+	DiagnosticStep
+	Type    string
+	Records []string
+}
+
+// TCPResult is a connection attempt to one port
+type TCPResult struct {
+	DiagnosticStep
+	Address string
+	Port    int
+	Open    bool
+}
+
+// HTTPResult is a GET of the target's root. Redirects are reported, not
+// followed.
+type HTTPResult struct {
+	DiagnosticStep
+	URL        string
+	StatusCode int    `json:",omitempty"`
+	Status     string `json:",omitempty"`
+	Location   string `json:",omitempty"`
+	// TLSVersion and CertificateExpires describe an HTTPS connection
+	TLSVersion         string     `json:",omitempty"`
+	CertificateExpires *time.Time `json:",omitempty"`
+}
+
+// DiagnosticsRequest is what to check, from the POST form values target,
+// type, ports and scheme
+type DiagnosticsRequest struct {
+	Target string
+	// Type is the DNS record type to look up
+	Type  string
+	Ports []int
+	// Scheme is http, https or none for the HTTP check
+	Scheme string
+}
+
+// dnsRecordTypes are the record types that can be looked up
+var dnsRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT", "PTR"}
+
+const (
+	// maxDiagnosticPorts bounds the TCP checks in one run
+	maxDiagnosticPorts = 10
+	defaultPorts       = "80,443"
+)
+
+// resolver is Go's own DNS client rather than the C library's, so lookups
+// honour the context deadline
+var resolver = &net.Resolver{PreferGo: true}
+
+// parseDiagnosticsRequest validates the form values of a diagnostics run
+func parseDiagnosticsRequest(r *http.Request) (DiagnosticsRequest, error) {
+	req := DiagnosticsRequest{
+		Target: strings.TrimSuffix(strings.TrimSpace(r.FormValue("target")), "."),
+		Type:   strings.ToUpper(strings.TrimSpace(r.FormValue("type"))),
+		Scheme: strings.ToLower(strings.TrimSpace(r.FormValue("scheme"))),
+	}
+	if err := validateTarget(req.Target); err != nil {
+		return req, err
+	}
+
+	isIP := net.ParseIP(req.Target) != nil
+	if req.Type == "" {
+		req.Type = "A"
+		if isIP {
+			req.Type = "PTR"
+		}
+	}
+	if !containsString(dnsRecordTypes, req.Type) {
+		return req, fmt.Errorf("type must be one of %s", strings.Join(dnsRecordTypes, ", "))
+	}
+	if (req.Type == "PTR") != isIP {
+		return req, fmt.Errorf("PTR lookups need an IP address, and other types a hostname")
+	}
+
+	if req.Scheme == "" {
+		req.Scheme = "https"
+	}
+	if req.Scheme != "http" && req.Scheme != "https" && req.Scheme != "none" {
+		return req, fmt.Errorf("scheme must be http, https or none")
+	}
+
+	ports := r.FormValue("ports")
+	if strings.TrimSpace(ports) == "" {
+		ports = defaultPorts
+	}
+	seen := make(map[int]bool)
+	for _, field := range strings.Split(ports, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || port < 1 || port > 65535 {
+			return req, fmt.Errorf("invalid port %q", strings.TrimSpace(field))
+		}
+		if !seen[port] {
+			seen[port] = true
+			req.Ports = append(req.Ports, port)
+		}
+	}
+	if len(req.Ports) > maxDiagnosticPorts {
+		return req, fmt.Errorf("at most %d ports can be checked", maxDiagnosticPorts)
+	}
+	return req, nil
+}
+
+// validateTarget accepts an IP address or a hostname, and nothing that
+// could be mistaken for a URL, a port or a command-line option
+func validateTarget(target string) error {
+	if target == "" {
+		return errors.New("target is required")
+	}
+	if net.ParseIP(target) != nil {
+		return nil
+	}
+	if len(target) > 253 {
+		return errors.New("target is too long for a hostname")
+	}
+	for _, label := range strings.Split(target, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("target %q is not a valid hostname or IP address", target)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("target %q is not a valid hostname or IP address", target)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("target %q is not a valid hostname or IP address", target)
+			}
+		}
+	}
+	return nil
+}
+
+// denied reports whether diagnostics may not be run against ip. Multicast
+// and "this network" addresses are never valid targets.
+func (c DiagnosticsConfig) denied(ip net.IP) bool {
+	if ip.IsMulticast() || thisNetwork.Contains(ip) {
+		return true
+	}
+	if c.DenyPrivate && (ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || sharedAddressSpace.Contains(ip)) {
+		return true
+	}
+	for _, cidr := range c.DenyNetworks {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+	sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+	// thisNetwork is 0.0.0.0/8, which some stacks treat as the local host
+	thisNetwork = &net.IPNet{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)}
+)
+
+// errTargetDenied is returned for a target in a denied network
+var errTargetDenied = errors.New("target is in a network that diagnostics may not be run against")
+
+// resolveTarget returns the target's addresses, IPv4 first. It fails if
+// any of them is denied, so that a name cannot smuggle in an internal
+// address next to a public one.
+func resolveTarget(ctx context.Context, config DiagnosticsConfig, target string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(target); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := resolver.LookupIPAddr(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", target)
+	}
+	for _, ip := range ips {
+		if config.denied(ip) {
+			return nil, fmt.Errorf("%w: %s", errTargetDenied, ip)
+		}
+	}
+	sort.SliceStable(ips, func(i, j int) bool {
+		return ips[i].To4() != nil && ips[j].To4() == nil
+	})
+	return ips, nil
+}
+
+// runNetworkDiagnostics resolves the target and then runs the DNS, TCP,
+// HTTP and traceroute steps side by side, each under its own timeout
+func runNetworkDiagnostics(ctx context.Context, config DiagnosticsConfig, req DiagnosticsRequest) (NetworkDiagnostics, error) {
+	results := NetworkDiagnostics{Target: req.Target}
+
+	resolveCtx, cancel := context.WithTimeout(ctx, config.DNSTimeout)
+	ips, err := resolveTarget(resolveCtx, config, req.Target)
+	cancel()
+	if errors.Is(err, errTargetDenied) {
+		return results, err
+	}
+	for _, ip := range ips {
+		results.Addresses = append(results.Addresses, ip.String())
+	}
+
+	var wg sync.WaitGroup
+	step := func(timeout time.Duration, run func(ctx context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			run(ctx)
+		}()
+	}
+
+	step(config.DNSTimeout, func(ctx context.Context) {
+		results.DNS = lookupRecords(ctx, req.Target, req.Type)
+	})
+	if err != nil {
+		results.Error = fmt.Sprintf("cannot resolve %s: %v", req.Target, err)
+		wg.Wait()
+		results.LastCheck = time.Now()
+		return results, nil
+	}
+
+	ip := ips[0]
+	results.TCP = make([]TCPResult, len(req.Ports))
+	for i, port := range req.Ports {
+		i, port := i, port
+		step(config.ConnectTimeout, func(ctx context.Context) {
+			results.TCP[i] = checkTCP(ctx, ip, port)
+		})
+	}
+	if req.Scheme != "none" {
+		results.HTTP = &HTTPResult{}
+		step(config.HTTPTimeout, func(ctx context.Context) {
+			*results.HTTP = checkHTTP(ctx, req.Scheme, req.Target, ip, 0)
+		})
+	}
+	results.Traceroute = &TracerouteResult{}
+	step(config.TracerouteTimeout, func(ctx context.Context) {
+		*results.Traceroute = traceroute(ctx, ip)
+	})
+	wg.Wait()
+
+	results.LastCheck = time.Now()
+	return results, nil
+}
+
+// lookupRecords asks the resolver for one record type
+func lookupRecords(ctx context.Context, target, recordType string) DNSResult {
+	start := time.Now()
+	result := DNSResult{Type: recordType}
+	var err error
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		var ips []net.IP
+		if ips, err = resolver.LookupIP(ctx, network, target); err == nil {
+			for _, ip := range ips {
+				result.Records = append(result.Records, ip.String())
+			}
+		}
+	case "CNAME":
+		var cname string
+		if cname, err = resolver.LookupCNAME(ctx, target); err == nil {
+			result.Records = []string{cname}
+		}
+	case "MX":
+		var records []*net.MX
+		if records, err = resolver.LookupMX(ctx, target); err == nil {
+			for _, mx := range records {
+				result.Records = append(result.Records, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+			}
+		}
+	case "NS":
+		var records []*net.NS
+		if records, err = resolver.LookupNS(ctx, target); err == nil {
+			for _, ns := range records {
+				result.Records = append(result.Records, ns.Host)
+			}
+		}
+	case "TXT":
+		result.Records, err = resolver.LookupTXT(ctx, target)
+	case "PTR":
+		result.Records, err = resolver.LookupAddr(ctx, target)
+	default:
+		err = fmt.Errorf("unsupported record type %s", recordType)
+	}
+	result.finish(start, err)
+	return result
+}
+
+// checkTCP connects to ip:port
+func checkTCP(ctx context.Context, ip net.IP, port int) TCPResult {
+	address := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	result := TCPResult{Address: address, Port: port}
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err == nil {
+		result.Open = true
+		conn.Close()
+	}
+	result.finish(start, err)
+	return result
+}
+
+// checkHTTP sends a GET for the target's root to ip, so the request cannot
+// be sent to another address by a second DNS answer. A zero port means the
+// scheme's default.
+func checkHTTP(ctx context.Context, scheme, target string, ip net.IP, port int) HTTPResult {
+	host := target
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != 0 {
+		host = net.JoinHostPort(target, strconv.Itoa(port))
+	}
+	result := HTTPResult{URL: scheme + "://" + host + "/"}
+	start := time.Now()
+
+	dialPort := port
+	if dialPort == 0 {
+		dialPort = 80
+		if scheme == "https" {
+			dialPort = 443
+		}
+	}
+	address := net.JoinHostPort(ip.String(), strconv.Itoa(dialPort))
+	var dialer net.Dialer
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+			TLSClientConfig:   &tls.Config{ServerName: target},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, result.URL, nil)
+	if err != nil {
+		result.finish(start, err)
+		return result
+	}
+	req.Header.Set("User-Agent", "SystemHelper diagnostics")
+	resp, err := client.Do(req)
+	if err != nil {
+		result.finish(start, err)
+		return result
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.Status = resp.Status
+	result.Location = resp.Header.Get("Location")
+	if resp.TLS != nil {
+		result.TLSVersion = tls.VersionName(resp.TLS.Version)
+		if len(resp.TLS.PeerCertificates) > 0 {
+			expires := resp.TLS.PeerCertificates[0].NotAfter
+			result.CertificateExpires = &expires
+		}
+	}
+	result.finish(start, nil)
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTarget(t *testing.T) {
+	for _, target := range []string{"example.com", "a-b.example.co.uk", "_dmarc.example.com", "localhost", "192.0.2.1", "2001:db8::1"} {
+		if err := validateTarget(target); err != nil {
+			t.Errorf("validateTarget(%q) = %v", target, err)
+		}
+	}
+	for _, target := range []string{"", "-c 1 example.com", "example.com:80", "http://example.com", "a..b", "-x.com", "x-.com",
+		"exa mple.com", "x;reboot", strings.Repeat("a", 64) + ".com", strings.Repeat("a.", 127) + "com"} {
+		if err := validateTarget(target); err == nil {
+			t.Errorf("validateTarget(%q) succeeded", target)
+		}
+	}
+}
+
+func diagnosticsForm(values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/network/diagnostics", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestParseDiagnosticsRequest(t *testing.T) {
+	req, err := parseDiagnosticsRequest(diagnosticsForm(url.Values{"target": {" example.com. "}}))
+	want := DiagnosticsRequest{Target: "example.com", Type: "A", Ports: []int{80, 443}, Scheme: "https"}
+	if err != nil || !reflect.DeepEqual(req, want) {
+		t.Errorf("defaults: %+v, %v, want %+v", req, err, want)
+	}
+	req, err = parseDiagnosticsRequest(diagnosticsForm(url.Values{"target": {"192.0.2.1"}, "ports": {"22, 22,8080"}, "scheme": {"none"}}))
+	want = DiagnosticsRequest{Target: "192.0.2.1", Type: "PTR", Ports: []int{22, 8080}, Scheme: "none"}
+	if err != nil || !reflect.DeepEqual(req, want) {
+		t.Errorf("IP target: %+v, %v, want %+v", req, err, want)
+	}
+
+	for _, values := range []url.Values{
+		{"target": {"example.com"}, "type": {"ANY"}},
+		{"target": {"example.com"}, "type": {"PTR"}},
+		{"target": {"192.0.2.1"}, "type": {"MX"}},
+		{"target": {"example.com"}, "scheme": {"ftp"}},
+		{"target": {"example.com"}, "ports": {"0"}},
+		{"target": {"example.com"}, "ports": {"80;443"}},
+		{"target": {"example.com"}, "ports": {"1,2,3,4,5,6,7,8,9,10,11"}},
+	} {
+		if _, err := parseDiagnosticsRequest(diagnosticsForm(values)); err == nil {
+			t.Errorf("parseDiagnosticsRequest(%v) succeeded", values)
+		}
+	}
+}
+
+func TestDiagnosticsDenied(t *testing.T) {
+	config := DiagnosticsConfig{DenyPrivate: true, DenyNetworks: []string{"203.0.113.0/24"}}
+	for _, address := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1",
+		"0.0.0.0", "0.1.2.3", "224.0.0.1", "239.255.255.250", "ff02::1", "ff0e::1", "::1", "fd00::1", "fe80::1", "::ffff:10.0.0.1", "203.0.113.7"} {
+		if !config.denied(net.ParseIP(address)) {
+			t.Errorf("%s is allowed", address)
+		}
+	}
+	for _, address := range []string{"192.0.2.1", "8.8.8.8", "2001:4860:4860::8888", "100.128.0.1"} {
+		if config.denied(net.ParseIP(address)) {
+			t.Errorf("%s is denied", address)
+		}
+	}
+	if (DiagnosticsConfig{}).denied(net.ParseIP("127.0.0.1")) {
+		t.Error("loopback is denied without deny_private")
+	}
+	for _, address := range []string{"0.0.0.0", "0.1.2.3", "224.0.0.1", "ff0e::1"} {
+		if !(DiagnosticsConfig{}).denied(net.ParseIP(address)) {
+			t.Errorf("%s is allowed without deny_private", address)
+		}
+	}
+	if !defaultConfig().Diagnostics.DenyPrivate {
+		t.Error("deny_private is off by default")
+	}
+
+	_, err := runNetworkDiagnostics(context.Background(), config, DiagnosticsRequest{Target: "169.254.169.254", Type: "PTR", Scheme: "none"})
+	if !errors.Is(err, errTargetDenied) {
+		t.Errorf("diagnostics of a denied target: %v, want errTargetDenied", err)
+	}
+}
+
+func TestNetworkDiagnosticsRejectsCrossOrigin(t *testing.T) {
+	r := diagnosticsForm(url.Values{"target": {"192.0.2.1"}, "scheme": {"none"}})
+	r.Header.Set("Origin", "https://attacker.example")
+	w := httptest.NewRecorder()
+	handleNetworkDiagnostics(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("cross-origin POST: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestReachabilityChecks(t *testing.T) {
+	var wantHost string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != wantHost {
+			t.Errorf("Host = %q, want %q", r.Host, wantHost)
+		}
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	wantHost = "example.test:" + strconv.Itoa(port)
+	loopback := net.ParseIP("127.0.0.1")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if result := checkTCP(ctx, loopback, port); !result.Open || result.Error != "" {
+		t.Errorf("open port: %+v", result)
+	}
+	// Listen and close to find a port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	if result := checkTCP(ctx, loopback, closed); result.Open || result.Error == "" {
+		t.Errorf("closed port: %+v", result)
+	}
+
+	// The request names the target but goes to the resolved address, and
+	// the redirect is reported rather than followed
+	result := checkHTTP(ctx, "http", "example.test", loopback, port)
+	if result.Error != "" || result.StatusCode != http.StatusFound || result.Location != "/login" ||
+		result.URL != "http://"+wantHost+"/" {
+		t.Errorf("HTTP check: %+v", result)
+	}
+}
+
+func TestTracerouteQuotes(t *testing.T) {
+	// An IPv4 header without options, then the start of our echo request
+	quoted := make([]byte, 28)
+	quoted[0] = 0x45
+	copy(quoted[20:], []byte{8, 0, 0, 0, 0x12, 0x34, 0x00, 0x07})
+	if !traceroute4.quotes(quoted, 0x1234, 7) {
+		t.Error("the echo request is not recognised")
+	}
+	if traceroute4.quotes(quoted, 0x1234, 8) || traceroute4.quotes(quoted, 0x4321, 7) {
+		t.Error("another probe is recognised")
+	}
+	if traceroute4.quotes(quoted[:24], 0x1234, 7) {
+		t.Error("a truncated quote is recognised")
+	}
+
+	quoted6 := make([]byte, 48)
+	copy(quoted6[40:], []byte{128, 0, 0, 0, 0x12, 0x34, 0x00, 0x07})
+	if !traceroute6.quotes(quoted6, 0x1234, 7) {
+		t.Error("the ICMPv6 echo request is not recognised")
+	}
+}
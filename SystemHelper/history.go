@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sample is the part of SystemStats kept in history
+type Sample struct {
+	Time        time.Time
+	CPU         float64
+	Memory      float64
+	LoadAverage [3]float64
+	// Processes are the busiest processes at the time
+	Processes []ProcessSample `json:",omitempty"`
+}
+
+// ProcessSample is a process's CPU usage in a sample
+type ProcessSample struct {
+	PID     int
+	Command string
+	CPU     float64
+}
+
+// historyProcesses is how many processes each sample keeps
+const historyProcesses = 10
+
+// maxHistoryPoints caps the points per series returned by the history API;
+// longer ranges are averaged into wider steps
+const maxHistoryPoints = 360
+
+func sampleStats(stats SystemStats) Sample {
+	sample := Sample{
+		Time:        stats.Timestamp,
+		CPU:         stats.CPUUsage,
+		Memory:      stats.MemoryUsage,
+		LoadAverage: stats.LoadAverage,
+	}
+	for _, process := range stats.TopProcesses {
+		sample.Processes = append(sample.Processes, ProcessSample{PID: process.PID, Command: process.Command, CPU: process.CPU})
+	}
+	sample.Processes = trimProcesses(sample.Processes)
+	return sample
+}
+
+// trimProcesses sorts processes busiest first and keeps historyProcesses of them
+func trimProcesses(processes []ProcessSample) []ProcessSample {
+	sort.SliceStable(processes, func(i, j int) bool {
+		return processes[i].CPU > processes[j].CPU
+	})
+	if len(processes) > historyProcesses {
+		processes = processes[:historyProcesses]
+	}
+	return processes
+}
+
+// sampleRing is a fixed-size buffer of samples in time order. Once full,
+// each new sample replaces the oldest.
+type sampleRing struct {
+	buf   []Sample
+	start int
+	count int
+}
+
+func newSampleRing(size int) *sampleRing {
+	if size < 1 {
+		size = 1
+	}
+	return &sampleRing{buf: make([]Sample, size)}
+}
+
+func (r *sampleRing) push(sample Sample) {
+	if r.count < len(r.buf) {
+		r.buf[(r.start+r.count)%len(r.buf)] = sample
+		r.count++
+		return
+	}
+	r.buf[r.start] = sample
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+func (r *sampleRing) at(i int) Sample {
+	return r.buf[(r.start+i)%len(r.buf)]
+}
+
+// between returns the samples at or after from and before to, oldest first
+func (r *sampleRing) between(from, to time.Time) []Sample {
+	// Samples are in time order, so search for the first one in range
+	first := sort.Search(r.count, func(i int) bool { return !r.at(i).Time.Before(from) })
+	var samples []Sample
+	for i := first; i < r.count; i++ {
+		sample := r.at(i)
+		if !sample.Time.Before(to) {
+			break
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// all returns every sample, oldest first
+func (r *sampleRing) all() []Sample {
+	samples := make([]Sample, r.count)
+	for i := range samples {
+		samples[i] = r.at(i)
+	}
+	return samples
+}
+
+// downsample averages samples into buckets of step, aligned to multiples of
+// step. Each bucket is stamped with its start. A process missing from some
+// samples in a bucket counts as idle in them.
+func downsample(samples []Sample, step time.Duration) []Sample {
+	var out []Sample
+	for i := 0; i < len(samples); {
+		bucket := samples[i].Time.Truncate(step)
+		j := i
+		for j < len(samples) && samples[j].Time.Truncate(step).Equal(bucket) {
+			j++
+		}
+		out = append(out, averageSamples(bucket, samples[i:j]))
+		i = j
+	}
+	return out
+}
+
+func averageSamples(at time.Time, samples []Sample) Sample {
+	average := Sample{Time: at}
+	cpu := make(map[int]*ProcessSample)
+	for _, sample := range samples {
+		average.CPU += sample.CPU
+		average.Memory += sample.Memory
+		for k := range average.LoadAverage {
+			average.LoadAverage[k] += sample.LoadAverage[k]
+		}
+		for _, process := range sample.Processes {
+			if cpu[process.PID] == nil {
+				cpu[process.PID] = &ProcessSample{PID: process.PID, Command: process.Command}
+			}
+			cpu[process.PID].CPU += process.CPU
+		}
+	}
+
+	n := float64(len(samples))
+	average.CPU /= n
+	average.Memory /= n
+	for k := range average.LoadAverage {
+		average.LoadAverage[k] /= n
+	}
+	for _, process := range cpu {
+		process.CPU /= n
+		average.Processes = append(average.Processes, *process)
+	}
+	sort.Slice(average.Processes, func(i, j int) bool {
+		return average.Processes[i].PID < average.Processes[j].PID
+	})
+	average.Processes = trimProcesses(average.Processes)
+	return average
+}
+
+// HistoryConfig sets the resolution and retention of each history tier
+type HistoryConfig struct {
+	// Resolution is how often stats are collected
+	Resolution time.Duration
+	// Retention is how long samples are kept at full resolution, in memory
+	Retention time.Duration
+	// ArchiveResolution and ArchiveRetention set the downsampled tier that
+	// serves longer ranges
+	ArchiveResolution time.Duration
+	ArchiveRetention  time.Duration
+	// ArchivePath is the JSON-lines file the downsampled tier is kept in
+	// across restarts; empty keeps it in memory only
+	ArchivePath string
+}
+
+func (c HistoryConfig) validate() error {
+	switch {
+	case c.Resolution <= 0:
+		return fmt.Errorf("-interval must be positive")
+	case c.Retention < c.Resolution:
+		return fmt.Errorf("-history-retention must be at least -interval")
+	case c.ArchiveResolution < c.Resolution:
+		return fmt.Errorf("-archive-resolution must be at least -interval")
+	case c.ArchiveRetention < c.ArchiveResolution:
+		return fmt.Errorf("-archive-retention must be at least -archive-resolution")
+	}
+	return nil
+}
+
+// History keeps recent samples at full resolution and older ones averaged
+// into the archive tier
+type History struct {
+	mu      sync.RWMutex
+	config  HistoryConfig
+	recent  *sampleRing
+	archive *sampleRing
+	// pending are the samples of the archive bucket still being filled
+	pending []Sample
+
+	file *os.File
+	// lines is the number of records in the file, which is compacted once
+	// it holds twice what the archive keeps
+	lines int
+}
+
+// NewHistory creates the history, loading the archive file if one is set
+func NewHistory(config HistoryConfig) (*History, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	h := &History{
+		config:  config,
+		recent:  newSampleRing(int(config.Retention / config.Resolution)),
+		archive: newSampleRing(int(config.ArchiveRetention / config.ArchiveResolution)),
+	}
+	if config.ArchivePath == "" {
+		return h, nil
+	}
+
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	if err := h.rewrite(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// load reads the archive file, skipping expired samples
+func (h *History) load() error {
+	file, err := os.Open(h.config.ArchivePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading history file: %v", err)
+	}
+	defer file.Close()
+
+	cutoff := time.Now().Add(-h.config.ArchiveRetention)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var sample Sample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			// Skip a torn final line from an interrupted write
+			continue
+		}
+		if sample.Time.Before(cutoff) {
+			continue
+		}
+		h.archive.push(sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading history file: %v", err)
+	}
+	return nil
+}
+
+// rewrite replaces the archive file with the archive tier and reopens it
+// for appending
+func (h *History) rewrite() error {
+	if h.file != nil {
+		h.file.Close()
+		h.file = nil
+	}
+
+	tmp := h.config.ArchivePath + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error compacting history file: %v", err)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	samples := h.archive.all()
+	for i := range samples {
+		encoder.Encode(samples[i])
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("error compacting history file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error compacting history file: %v", err)
+	}
+	if err := os.Rename(tmp, h.config.ArchivePath); err != nil {
+		return fmt.Errorf("error compacting history file: %v", err)
+	}
+
+	h.file, err = os.OpenFile(h.config.ArchivePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %v", err)
+	}
+	h.lines = len(samples)
+	return nil
+}
+
+// Close closes the archive file. The partly filled archive bucket is lost.
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	return h.file.Close()
+}
+
+// Add records a sample, averaging the previous archive bucket once the
+// sample falls into a new one
+func (h *History) Add(stats SystemStats) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sample := sampleStats(stats)
+	h.recent.push(sample)
+
+	bucket := sample.Time.Truncate(h.config.ArchiveResolution)
+	if len(h.pending) == 0 || h.pending[0].Time.Truncate(h.config.ArchiveResolution).Equal(bucket) {
+		h.pending = append(h.pending, sample)
+		return nil
+	}
+	archived := averageSamples(h.pending[0].Time.Truncate(h.config.ArchiveResolution), h.pending)
+	h.pending = append(h.pending[:0], sample)
+	h.archive.push(archived)
+
+	if h.file == nil {
+		return nil
+	}
+	if h.lines >= 2*len(h.archive.buf) {
+		return h.rewrite()
+	}
+	if err := json.NewEncoder(h.file).Encode(archived); err != nil {
+		return fmt.Errorf("error writing history: %v", err)
+	}
+	h.lines++
+	return nil
+}
+
+// HistoryPoint is one value of a series
+type HistoryPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// HistorySeries is a named line on a chart
+type HistorySeries struct {
+	Name   string
+	Points []HistoryPoint
+}
+
+// HistoryResponse is the response of /api/system/history
+type HistoryResponse struct {
+	Metric string
+	Range  string
+	// Step is the spacing of the points
+	Step   string
+	Series []HistorySeries
+}
+
+// historyMetrics are the metrics the history API serves
+var historyMetrics = []string{"cpu", "memory", "load", "process"}
+
+// processSeries is how many processes the process metric charts when no
+// PID is given
+const processSeries = 5
+
+// Query returns the metric over the window before now. Samples older than
+// the full-resolution tier come from the archive. A pid selects a single
+// process for the process metric.
+func (h *History) Query(metric string, window time.Duration, pid int, now time.Time) HistoryResponse {
+	h.mu.RLock()
+	from := now.Add(-window)
+	samples := h.recent.between(from, now.Add(time.Nanosecond))
+	cutoff := now
+	if len(samples) > 0 {
+		cutoff = samples[0].Time
+	}
+	older := h.archive.between(from, cutoff.Truncate(h.config.ArchiveResolution))
+	h.mu.RUnlock()
+
+	step := h.config.Resolution
+	if len(older) > 0 {
+		step = h.config.ArchiveResolution
+	}
+	if wide := window / maxHistoryPoints; wide > step {
+		step = wide.Round(time.Second)
+	}
+	samples = append(older, samples...)
+	if step > h.config.Resolution {
+		samples = downsample(samples, step)
+	}
+
+	response := HistoryResponse{Metric: metric, Range: window.String(), Step: step.String()}
+	switch metric {
+	case "cpu":
+		response.Series = []HistorySeries{sampleSeries("CPU", samples, func(s Sample) float64 { return s.CPU })}
+	case "memory":
+		response.Series = []HistorySeries{sampleSeries("Memory", samples, func(s Sample) float64 { return s.Memory })}
+	case "load":
+		for k, name := range []string{"1 min", "5 min", "15 min"} {
+			k := k
+			response.Series = append(response.Series, sampleSeries(name, samples, func(s Sample) float64 { return s.LoadAverage[k] }))
+		}
+	case "process":
+		response.Series = processHistory(samples, pid)
+	}
+	return response
+}
+
+func sampleSeries(name string, samples []Sample, value func(Sample) float64) HistorySeries {
+	series := HistorySeries{Name: name, Points: make([]HistoryPoint, len(samples))}
+	for i, sample := range samples {
+		series.Points[i] = HistoryPoint{Time: sample.Time, Value: value(sample)}
+	}
+	return series
+}
+
+// processHistory returns a series per process: the one with pid, or the
+// busiest on average over the samples. A process has no point in samples
+// where it was not among the busiest.
+func processHistory(samples []Sample, pid int) []HistorySeries {
+	type processTotal struct {
+		series HistorySeries
+		total  float64
+	}
+	totals := make(map[int]*processTotal)
+	for _, sample := range samples {
+		for _, process := range sample.Processes {
+			if pid != 0 && process.PID != pid {
+				continue
+			}
+			total := totals[process.PID]
+			if total == nil {
+				total = &processTotal{series: HistorySeries{Name: fmt.Sprintf("%s (%d)", process.Command, process.PID)}}
+				totals[process.PID] = total
+			}
+			total.series.Points = append(total.series.Points, HistoryPoint{Time: sample.Time, Value: process.CPU})
+			total.total += process.CPU
+		}
+	}
+
+	list := make([]*processTotal, 0, len(totals))
+	for _, total := range totals {
+		list = append(list, total)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].total != list[j].total {
+			return list[i].total > list[j].total
+		}
+		return list[i].series.Name < list[j].series.Name
+	})
+	series := []HistorySeries{}
+	for i := 0; i < len(list) && i < processSeries; i++ {
+		series = append(series, list[i].series)
+	}
+	return series
+}
+
+// parseRange parses a duration, also accepting whole days such as 7d
+func parseRange(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid range %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid range %q", value)
+	}
+	return window, nil
+}
+
+// handleSystemHistory serves /api/system/history?metric=cpu&range=1h.
+// metric is cpu, memory, load or process, range defaults to 1h and may not
+// exceed the archive retention, and pid selects one process.
+func handleSystemHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	metric := query.Get("metric")
+	if metric == "" {
+		metric = "cpu"
+	}
+	known := false
+	for _, name := range historyMetrics {
+		known = known || name == metric
+	}
+	if !known {
+		http.Error(w, fmt.Sprintf("Unknown metric %q, want one of %s", metric, strings.Join(historyMetrics, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	window := time.Hour
+	if value := query.Get("range"); value != "" {
+		var err error
+		if window, err = parseRange(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if window > history.config.ArchiveRetention {
+		http.Error(w, fmt.Sprintf("Range exceeds the %s of history kept", history.config.ArchiveRetention), http.StatusBadRequest)
+		return
+	}
+
+	var pid int
+	if value := query.Get("pid"); value != "" {
+		var err error
+		if pid, err = strconv.Atoi(value); err != nil || pid <= 0 {
+			http.Error(w, "Invalid process ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history.Query(metric, window, pid, time.Now()))
+}
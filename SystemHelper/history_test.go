@@ -0,0 +1,107 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var historyStart = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func statsAt(offset time.Duration, cpu float64) SystemStats {
+	return SystemStats{
+		Timestamp:    historyStart.Add(offset),
+		CPUUsage:     cpu,
+		MemoryUsage:  cpu / 2,
+		LoadAverage:  [3]float64{cpu / 100, 0, 0},
+		TopProcesses: []ProcessInfo{{PID: 7, Command: "worker", CPU: cpu}},
+	}
+}
+
+func TestSampleRingWrapsAround(t *testing.T) {
+	ring := newSampleRing(3)
+	for i := 0; i < 5; i++ {
+		ring.push(Sample{Time: historyStart.Add(time.Duration(i) * time.Second), CPU: float64(i)})
+	}
+	all := ring.all()
+	if len(all) != 3 || all[0].CPU != 2 || all[2].CPU != 4 {
+		t.Fatalf("ring holds %+v, want the last three samples", all)
+	}
+	between := ring.between(historyStart.Add(3*time.Second), historyStart.Add(4*time.Second))
+	if len(between) != 1 || between[0].CPU != 3 {
+		t.Errorf("between = %+v, want the sample at 3s", between)
+	}
+}
+
+func TestHistoryQueryUsesArchiveForOlderSamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	config := HistoryConfig{
+		Resolution:        10 * time.Second,
+		Retention:         time.Minute,
+		ArchiveResolution: time.Minute,
+		ArchiveRetention:  100 * 365 * 24 * time.Hour,
+		ArchivePath:       path,
+	}
+	h, err := NewHistory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Five minutes of samples: minute m has CPU 10*m and 10*m+20 alternately
+	for i := 0; i < 30; i++ {
+		cpu := float64(i/6*10 + i%2*20)
+		if err := h.Add(statsAt(time.Duration(i)*10*time.Second, cpu)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := historyStart.Add(290 * time.Second)
+
+	recent := h.Query("cpu", time.Minute, 0, now)
+	if recent.Step != "10s" || len(recent.Series) != 1 || len(recent.Series[0].Points) != 6 {
+		t.Fatalf("last minute: %+v, want six points at full resolution", recent)
+	}
+
+	// The first four minutes come from the archive and the last from the
+	// full-resolution tier, all averaged per minute
+	all := h.Query("cpu", 5*time.Minute, 0, now)
+	points := all.Series[0].Points
+	if all.Step != "1m0s" || len(points) != 5 {
+		t.Fatalf("five minutes: step %s and %d points, want 1m0s and 5", all.Step, len(points))
+	}
+	for m, point := range points {
+		if want := float64(m*10 + 10); !approx(point.Value, want) || !point.Time.Equal(historyStart.Add(time.Duration(m)*time.Minute)) {
+			t.Errorf("minute %d: %+v, want %v at its start", m, point, want)
+		}
+	}
+
+	process := h.Query("process", 5*time.Minute, 7, now)
+	if len(process.Series) != 1 || process.Series[0].Name != "worker (7)" {
+		t.Errorf("process series %+v, want worker (7)", process.Series)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The archive survives a restart; the full-resolution tier does not
+	reopened, err := NewHistory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	points = reopened.Query("cpu", 5*time.Minute, 0, now).Series[0].Points
+	if len(points) != 4 || !approx(points[3].Value, 40) {
+		t.Errorf("after reopening: %+v, want the four archived minutes", points)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for value, want := range map[string]time.Duration{"15m": 15 * time.Minute, "1h": time.Hour, "7d": 7 * 24 * time.Hour} {
+		if got, err := parseRange(value); err != nil || got != want {
+			t.Errorf("parseRange(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "0s", "-1h", "xd", "1w"} {
+		if _, err := parseRange(value); err == nil {
+			t.Errorf("parseRange(%q) succeeded", value)
+		}
+	}
+}
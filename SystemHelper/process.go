@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessDetails is the structured view of a process served by
+// GET /api/process/{pid} on Linux
+type ProcessDetails struct {
+	PID     int
+	PPID    int
+	Command string
+	Cmdline []string
+	State   string
+	User    string
+	UID     int
+	Nice    int
+	// IOPriority is the I/O scheduling class and level, which /proc does
+	// not show, so it is asked of the kernel
+	IOPriority IOPriority
+	Threads    int
+	// RSS is the resident set size in bytes
+	RSS     uint64
+	Started time.Time
+	// Parents lists the ancestors, nearest first
+	Parents  []ProcessNode
+	Children []ProcessNode
+	// Environment has the values of secret-looking variables redacted
+	Environment map[string]string
+	Cgroups     []CgroupInfo
+	// Files lists up to maxListedFiles of the FileCount descriptors
+	Files     []FileInfo
+	FileCount int
+	Sockets   []SocketInfo
+	// ActionsAllowed reports whether the allow-list permits actions on the process
+	ActionsAllowed bool
+	// Errors lists the details that could not be read, usually for lack of
+	// permission
+	Errors []string `json:",omitempty"`
+}
+
+// IOPriority is an I/O scheduling class and its level, 0 being the highest.
+// Class none means the level follows the CPU nice value.
+type IOPriority struct {
+	Class string
+	Level int
+}
+
+// ProcessNode is a process in the tree
+type ProcessNode struct {
+	PID      int
+	Command  string
+	Children []ProcessNode `json:",omitempty"`
+}
+
+// CgroupInfo is a line of /proc/[pid]/cgroup. Hierarchy 0 is cgroup v2.
+type CgroupInfo struct {
+	Hierarchy   int
+	Controllers []string `json:",omitempty"`
+	Path        string
+}
+
+// FileInfo is an open file descriptor
+type FileInfo struct {
+	FD     int
+	Target string
+	// Type is file, device, socket, pipe, anon or other
+	Type string
+}
+
+// SocketInfo is an internet socket held by a process
+type SocketInfo struct {
+	FD       int
+	Protocol string
+	State    string
+	Local    string
+	Remote   string
+}
+
+const (
+	// maxTreeDepth bounds how many generations of children are listed
+	maxTreeDepth = 5
+	// maxListedFiles bounds the descriptors listed for a process
+	maxListedFiles = 500
+)
+
+// processStates names the states in /proc/[pid]/stat
+var processStates = map[string]string{
+	"R": "running",
+	"S": "sleeping",
+	"D": "disk sleep",
+	"Z": "zombie",
+	"T": "stopped",
+	"t": "tracing stop",
+	"X": "dead",
+	"I": "idle",
+}
+
+// secretEnvironment matches the names of variables whose values are not shown
+var secretEnvironment = regexp.MustCompile(`(?i)pass|secret|token|key|credential|auth|cookie|session`)
+
+// lookupUser names a UID, or returns it as a number when it has no name
+var lookupUser = func(uid int) string {
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return u.Username
+	}
+	return strconv.Itoa(uid)
+}
+
+// readProcessDetails reads everything /proc has on a process. Only a missing
+// process is an error; details that cannot be read are listed in Errors.
+func (p procFS) readProcessDetails(pid int) (ProcessDetails, error) {
+	sample, err := p.readProcess(pid)
+	if err != nil {
+		return ProcessDetails{}, err
+	}
+	details := ProcessDetails{
+		PID:     pid,
+		PPID:    sample.PPID,
+		Command: sample.Command,
+		State:   processStates[sample.State],
+		UID:     sample.UID,
+		User:    lookupUser(sample.UID),
+		Nice:    sample.Nice,
+		Threads: sample.Threads,
+		RSS:     sample.RSS * 1024,
+	}
+	if details.State == "" {
+		details.State = sample.State
+	}
+	fail := func(what string, err error) {
+		details.Errors = append(details.Errors, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	dir := strconv.Itoa(pid)
+	if boot, err := p.readBootTime(); err != nil {
+		fail("start time", err)
+	} else {
+		details.Started = boot.Add(time.Duration(sample.Start) * time.Second / clockTicks)
+	}
+	if data, err := os.ReadFile(p.path(dir, "cmdline")); err != nil {
+		fail("command line", err)
+	} else {
+		details.Cmdline = splitNUL(data)
+	}
+	if data, err := os.ReadFile(p.path(dir, "environ")); err != nil {
+		fail("environment", err)
+	} else {
+		details.Environment = parseEnvironment(data)
+	}
+	if details.Cgroups, err = p.readCgroups(dir); err != nil {
+		fail("cgroups", err)
+	}
+	if err := p.readFiles(dir, &details); err != nil {
+		fail("files", err)
+	}
+	if processes, err := p.readProcesses(); err != nil {
+		fail("process tree", err)
+	} else {
+		details.Parents, details.Children = processTree(pid, processes)
+	}
+	return details, nil
+}
+
+// readBootTime reads when the system booted from the btime line of /proc/stat
+func (p procFS) readBootTime() (time.Time, error) {
+	file, err := os.Open(p.path("stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("%s: bad btime: %v", file.Name(), err)
+			}
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, err
+	}
+	return time.Time{}, fmt.Errorf("%s: no btime line", file.Name())
+}
+
+func splitNUL(data []byte) []string {
+	data = bytes.TrimRight(data, "\x00")
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(string(data), "\x00")
+}
+
+func parseEnvironment(data []byte) map[string]string {
+	environment := make(map[string]string)
+	for _, entry := range splitNUL(data) {
+		name, value, _ := strings.Cut(entry, "=")
+		if secretEnvironment.MatchString(name) {
+			value = "[redacted]"
+		}
+		environment[name] = value
+	}
+	return environment
+}
+
+// readCgroups reads /proc/[pid]/cgroup
+func (p procFS) readCgroups(dir string) ([]CgroupInfo, error) {
+	data, err := os.ReadFile(p.path(dir, "cgroup"))
+	if err != nil {
+		return nil, err
+	}
+	var cgroups []CgroupInfo
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		hierarchy, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		cgroup := CgroupInfo{Hierarchy: hierarchy, Path: fields[2]}
+		if fields[1] != "" {
+			cgroup.Controllers = strings.Split(fields[1], ",")
+		}
+		cgroups = append(cgroups, cgroup)
+	}
+	return cgroups, nil
+}
+
+// readFiles lists the descriptors in /proc/[pid]/fd and matches the sockets
+// among them with the tables in the process's network namespace
+func (p procFS) readFiles(dir string, details *ProcessDetails) error {
+	entries, err := os.ReadDir(p.path(dir, "fd"))
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, _ := strconv.Atoi(entries[i].Name())
+		b, _ := strconv.Atoi(entries[j].Name())
+		return a < b
+	})
+
+	inodes := make(map[uint64]int)
+	for _, entry := range entries {
+		fd, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(p.path(dir, "fd", entry.Name()))
+		if err != nil {
+			// Closed since the directory was read
+			continue
+		}
+		details.FileCount++
+		file := FileInfo{FD: fd, Target: target, Type: fileType(target)}
+		if file.Type == "socket" {
+			var inode uint64
+			if _, err := fmt.Sscanf(target, "socket:[%d]", &inode); err == nil {
+				inodes[inode] = fd
+			}
+		}
+		if len(details.Files) < maxListedFiles {
+			details.Files = append(details.Files, file)
+		}
+	}
+	if len(inodes) == 0 {
+		return nil
+	}
+
+	sockets, err := p.readSockets(dir, "net")
+	if err != nil {
+		return err
+	}
+	for _, socket := range sockets {
+		if fd, ok := inodes[socket.Inode]; ok {
+			details.Sockets = append(details.Sockets, SocketInfo{
+				FD:       fd,
+				Protocol: socket.Protocol,
+				State:    socket.State,
+				Local:    socket.Local,
+				Remote:   socket.Remote,
+			})
+		}
+	}
+	sort.Slice(details.Sockets, func(i, j int) bool {
+		return details.Sockets[i].FD < details.Sockets[j].FD
+	})
+	return nil
+}
+
+func fileType(target string) string {
+	switch {
+	case strings.HasPrefix(target, "socket:"):
+		return "socket"
+	case strings.HasPrefix(target, "pipe:"):
+		return "pipe"
+	case strings.HasPrefix(target, "anon_inode:"):
+		return "anon"
+	case strings.HasPrefix(target, "/dev/"):
+		return "device"
+	case strings.HasPrefix(target, "/"):
+		return "file"
+	}
+	return "other"
+}
+
+// processTree returns the ancestors of pid, nearest first, and its
+// descendants up to maxTreeDepth generations
+func processTree(pid int, processes []procSample) ([]ProcessNode, []ProcessNode) {
+	byPID := make(map[int]procSample, len(processes))
+	children := make(map[int][]procSample)
+	for _, process := range processes {
+		byPID[process.PID] = process
+		children[process.PPID] = append(children[process.PPID], process)
+	}
+
+	var parents []ProcessNode
+	seen := map[int]bool{pid: true}
+	for ppid := byPID[pid].PPID; ppid != 0 && !seen[ppid]; ppid = byPID[ppid].PPID {
+		parent, ok := byPID[ppid]
+		if !ok {
+			break
+		}
+		seen[ppid] = true
+		parents = append(parents, ProcessNode{PID: parent.PID, Command: parent.Command})
+	}
+
+	var descend func(pid, depth int) []ProcessNode
+	descend = func(pid, depth int) []ProcessNode {
+		if depth > maxTreeDepth {
+			return nil
+		}
+		var nodes []ProcessNode
+		for _, child := range children[pid] {
+			nodes = append(nodes, ProcessNode{PID: child.PID, Command: child.Command, Children: descend(child.PID, depth+1)})
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].PID < nodes[j].PID })
+		return nodes
+	}
+	return parents, descend(pid, 1)
+}
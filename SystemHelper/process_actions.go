@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProcessAction is the body of POST /api/process/{pid}/actions. A request
+// without a token is checked and answered with one; repeating it with the
+// token runs it.
+type ProcessAction struct {
+	// Action is signal, renice or ionice
+	Action string
+	// Signal is TERM, KILL, STOP or CONT
+	Signal string `json:",omitempty"`
+	// Nice is the new nice value, from -20 to 19
+	Nice int `json:",omitempty"`
+	// Class is the I/O scheduling class, realtime, best-effort or idle, and
+	// Level its level from 0 to 7
+	Class string `json:",omitempty"`
+	Level int    `json:",omitempty"`
+	Token string `json:",omitempty"`
+}
+
+// ProcessActionResult is the response to a process action
+type ProcessActionResult struct {
+	// Status is confirm when the action awaits its token and done once it ran
+	Status  string
+	Summary string
+	Token   string     `json:",omitempty"`
+	Expires *time.Time `json:",omitempty"`
+}
+
+// processSignals are the signals that may be sent from the dashboard
+var processSignals = []string{"TERM", "KILL", "STOP", "CONT"}
+
+// ioClasses are the I/O scheduling classes by their kernel number
+var ioClasses = map[string]int{"realtime": 1, "best-effort": 2, "idle": 3}
+
+// validate checks the action's arguments and puts them in canonical form
+func (a *ProcessAction) validate() error {
+	switch a.Action {
+	case "signal":
+		a.Signal = strings.TrimPrefix(strings.ToUpper(a.Signal), "SIG")
+		for _, signal := range processSignals {
+			if a.Signal == signal {
+				a.Nice, a.Class, a.Level = 0, "", 0
+				return nil
+			}
+		}
+		return fmt.Errorf("signal must be one of %s", strings.Join(processSignals, ", "))
+	case "renice":
+		if a.Nice < -20 || a.Nice > 19 {
+			return fmt.Errorf("nice must be between -20 and 19")
+		}
+		a.Signal, a.Class, a.Level = "", "", 0
+		return nil
+	case "ionice":
+		if _, ok := ioClasses[a.Class]; !ok {
+			return fmt.Errorf("class must be realtime, best-effort or idle")
+		}
+		if a.Level < 0 || a.Level > 7 {
+			return fmt.Errorf("level must be between 0 and 7")
+		}
+		if a.Class == "idle" {
+			a.Level = 0
+		}
+		a.Signal, a.Nice = "", 0
+		return nil
+	}
+	return fmt.Errorf("action must be signal, renice or ionice")
+}
+
+func (a ProcessAction) describe(sample procSample, user string) string {
+	target := fmt.Sprintf("%d (%s, owned by %s)", sample.PID, sample.Command, user)
+	switch a.Action {
+	case "signal":
+		return fmt.Sprintf("send SIG%s to %s", a.Signal, target)
+	case "renice":
+		return fmt.Sprintf("set the nice value of %s to %d", target, a.Nice)
+	}
+	if a.Class == "idle" {
+		return fmt.Sprintf("set the I/O priority of %s to idle", target)
+	}
+	return fmt.Sprintf("set the I/O priority of %s to %s level %d", target, a.Class, a.Level)
+}
+
+// allows reports whether the allow-list permits actions on a process, by its
+// owner's name or UID or by its command
+func (c ProcessActionsConfig) allows(uid int, user, command string) bool {
+	for _, allowed := range c.AllowUsers {
+		if allowed == user || allowed == strconv.Itoa(uid) {
+			return true
+		}
+	}
+	for _, pattern := range c.AllowCommands {
+		if ok, _ := path.Match(pattern, command); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingAction is an action waiting for its confirmation token. Start
+// identifies the process, so a token cannot act on a process that later
+// reused the PID.
+type pendingAction struct {
+	PID     int
+	Start   uint64
+	Action  ProcessAction
+	Expires time.Time
+}
+
+// actionTokens holds the confirmation tokens that have been handed out.
+// Each can be used once.
+type actionTokens struct {
+	mu      sync.Mutex
+	pending map[string]pendingAction
+}
+
+func newActionTokens() *actionTokens {
+	return &actionTokens{pending: make(map[string]pendingAction)}
+}
+
+func (t *actionTokens) issue(action pendingAction) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, pending := range t.pending {
+		if time.Now().After(pending.Expires) {
+			delete(t.pending, key)
+		}
+	}
+	t.pending[token] = action
+	return token, nil
+}
+
+// redeem removes a token and returns its action if it has not expired
+func (t *actionTokens) redeem(token string, now time.Time) (pendingAction, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	action, ok := t.pending[token]
+	delete(t.pending, token)
+	if !ok || now.After(action.Expires) {
+		return pendingAction{}, false
+	}
+	return action, true
+}
+
+var (
+	processActionsConfig ProcessActionsConfig
+	processActionTokens  = newActionTokens()
+	// runProcessAction carries out a confirmed action; tests replace it
+	runProcessAction = func(pid int, action ProcessAction) error {
+		switch action.Action {
+		case "signal":
+			return sendSignal(pid, action.Signal)
+		case "renice":
+			return setNice(pid, action.Nice)
+		}
+		return setIOPriority(pid, ioClasses[action.Class], action.Level)
+	}
+)
+
+func writeActionError(w http.ResponseWriter, message string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"Error": message})
+}
+
+// handleProcessAction serves POST /api/process/{pid}/actions
+func handleProcessAction(w http.ResponseWriter, r *http.Request, pid int) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeActionError(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		writeActionError(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	if runtime.GOOS != "linux" {
+		writeActionError(w, "Process actions are only supported on Linux", http.StatusNotImplemented)
+		return
+	}
+
+	var action ProcessAction
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&action); err != nil {
+		writeActionError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := action.validate(); err != nil {
+		writeActionError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if pid == 1 || pid == os.Getpid() {
+		writeActionError(w, fmt.Sprintf("Actions on process %d are not allowed", pid), http.StatusForbidden)
+		return
+	}
+
+	sample, err := procStats.fs.readProcess(pid)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeActionError(w, fmt.Sprintf("No process %d", pid), http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeActionError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user := lookupUser(sample.UID)
+	if !processActionsConfig.allows(sample.UID, user, sample.Command) {
+		writeActionError(w, fmt.Sprintf("Process %d (%s, owned by %s) is not in the process_actions allow-list of the config file", pid, sample.Command, user), http.StatusForbidden)
+		return
+	}
+
+	token := action.Token
+	action.Token = ""
+	summary := action.describe(sample, user)
+	w.Header().Set("Content-Type", "application/json")
+
+	if token == "" {
+		pending := pendingAction{PID: pid, Start: sample.Start, Action: action, Expires: time.Now().Add(processActionsConfig.ConfirmTimeout)}
+		token, err := processActionTokens.issue(pending)
+		if err != nil {
+			writeActionError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(ProcessActionResult{Status: "confirm", Summary: summary, Token: token, Expires: &pending.Expires})
+		return
+	}
+
+	pending, ok := processActionTokens.redeem(token, time.Now())
+	if !ok {
+		writeActionError(w, "Invalid or expired confirmation token", http.StatusForbidden)
+		return
+	}
+	if pending.PID != pid || pending.Start != sample.Start || pending.Action != action {
+		writeActionError(w, "Confirmation token was issued for a different action", http.StatusForbidden)
+		return
+	}
+	if err := runProcessAction(pid, action); err != nil {
+		log.Printf("Process action by %s failed: %s: %v", r.RemoteAddr, summary, err)
+		writeActionError(w, fmt.Sprintf("Failed to %s: %v", summary, err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Process action by %s: %s", r.RemoteAddr, summary)
+	json.NewEncoder(w).Encode(ProcessActionResult{Status: "done", Summary: summary})
+}
+
+// sameOrigin reports whether a request came from the dashboard itself, or
+// from a client such as curl that sends no Origin
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
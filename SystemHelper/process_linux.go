@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+var signalNumbers = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"STOP": syscall.SIGSTOP,
+	"CONT": syscall.SIGCONT,
+}
+
+func sendSignal(pid int, signal string) error {
+	number, ok := signalNumbers[signal]
+	if !ok {
+		return fmt.Errorf("unknown signal %s", signal)
+	}
+	return syscall.Kill(pid, number)
+}
+
+func setNice(pid, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
+
+// The I/O priority packs the class above a 13-bit level, see ioprio_set(2)
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+func setIOPriority(pid, class, level int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(class<<ioprioClassShift|level))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func getIOPriority(pid int) (IOPriority, error) {
+	value, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(pid), 0)
+	if errno != 0 {
+		return IOPriority{}, errno
+	}
+	priority := IOPriority{Class: "none", Level: int(value & (1<<ioprioClassShift - 1))}
+	for name, class := range ioClasses {
+		if int(value>>ioprioClassShift) == class {
+			priority.Class = name
+		}
+	}
+	return priority, nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// Process actions read and change processes through Linux system calls
+var errProcessActionsUnsupported = errors.New("process actions are not supported on this platform")
+
+func sendSignal(pid int, signal string) error {
+	return errProcessActionsUnsupported
+}
+
+func setNice(pid, nice int) error {
+	return errProcessActionsUnsupported
+}
+
+func setIOPriority(pid, class, level int) error {
+	return errProcessActionsUnsupported
+}
+
+func getIOPriority(pid int) (IOPriority, error) {
+	return IOPriority{}, errProcessActionsUnsupported
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProcessDetails(t *testing.T) {
+	defer func(lookup func(int) string) { lookupUser = lookup }(lookupUser)
+	lookupUser = func(uid int) string { return "user" + strconv.Itoa(uid) }
+
+	details, err := procFS{root: "testdata/proc/t0"}.readProcessDetails(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.PPID != 1 || details.State != "running" || details.UID != 33 || details.User != "user33" ||
+		details.Threads != 4 || details.RSS != 400000*1024 {
+		t.Errorf("got %+v", details)
+	}
+	// Booted at 1700000000, started 50000 ticks later
+	if want := time.Unix(1700000500, 0); !details.Started.Equal(want) {
+		t.Errorf("Started = %v, want %v", details.Started, want)
+	}
+	if want := []string{"/usr/bin/web", "--workers", "4"}; !reflect.DeepEqual(details.Cmdline, want) {
+		t.Errorf("Cmdline = %q, want %q", details.Cmdline, want)
+	}
+	wantEnvironment := map[string]string{"HOME": "/var/www", "PATH": "/usr/bin:/bin", "DB_PASSWORD": "[redacted]", "EMPTY": ""}
+	if !reflect.DeepEqual(details.Environment, wantEnvironment) {
+		t.Errorf("Environment = %v, want %v", details.Environment, wantEnvironment)
+	}
+	wantCgroups := []CgroupInfo{
+		{Hierarchy: 0, Path: "/system.slice/web.service"},
+		{Hierarchy: 3, Controllers: []string{"cpu", "cpuacct"}, Path: "/system.slice"},
+	}
+	if !reflect.DeepEqual(details.Cgroups, wantCgroups) {
+		t.Errorf("Cgroups = %+v, want %+v", details.Cgroups, wantCgroups)
+	}
+
+	wantFiles := []FileInfo{
+		{FD: 0, Target: "/dev/null", Type: "device"},
+		{FD: 1, Target: "/var/log/web.log", Type: "file"},
+		{FD: 3, Target: "socket:[10003]", Type: "socket"},
+		{FD: 4, Target: "socket:[99999]", Type: "socket"},
+		{FD: 10, Target: "pipe:[555]", Type: "pipe"},
+	}
+	if !reflect.DeepEqual(details.Files, wantFiles) || details.FileCount != 5 {
+		t.Errorf("Files = %+v (%d), want %+v", details.Files, details.FileCount, wantFiles)
+	}
+	// Socket 99999 is not an internet socket, so it is not in the tables
+	wantSockets := []SocketInfo{{FD: 3, Protocol: "tcp", State: "LISTEN", Local: "127.0.0.1:8081", Remote: "0.0.0.0:*"}}
+	if !reflect.DeepEqual(details.Sockets, wantSockets) {
+		t.Errorf("Sockets = %+v, want %+v", details.Sockets, wantSockets)
+	}
+	if want := []ProcessNode{{PID: 1, Command: "systemd"}}; !reflect.DeepEqual(details.Parents, want) || details.Children != nil {
+		t.Errorf("Parents = %+v, Children = %+v, want %+v and none", details.Parents, details.Children, want)
+	}
+	if len(details.Errors) != 0 {
+		t.Errorf("Errors = %q", details.Errors)
+	}
+
+	// systemd has no cmdline, environ, cgroup or fd fixtures
+	details, err = procFS{root: "testdata/proc/t0"}.readProcessDetails(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(details.Errors) != 4 || len(details.Children) != 1 || details.Children[0].PID != 42 {
+		t.Errorf("systemd: Errors = %q, Children = %+v, want 4 errors and child 42", details.Errors, details.Children)
+	}
+}
+
+func TestProcessTreeIgnoresLoops(t *testing.T) {
+	processes := []procSample{{PID: 5, PPID: 6}, {PID: 6, PPID: 5}, {PID: 7, PPID: 5}}
+	parents, children := processTree(5, processes)
+	if len(parents) != 1 || parents[0].PID != 6 {
+		t.Errorf("parents = %+v, want 6 only", parents)
+	}
+	if len(children) != 2 {
+		t.Errorf("children = %+v, want 6 and 7", children)
+	}
+}
+
+// postAction posts a process action to the handler
+func postAction(t *testing.T, pid int, body string) (int, map[string]interface{}) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/api/process/"+strconv.Itoa(pid)+"/actions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handleProcessInfo(w, r)
+	var result map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("%s: decoding response: %v", body, err)
+	}
+	return w.Code, result
+}
+
+func TestProcessActionConfirmation(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process actions are only supported on Linux")
+	}
+	defer func(collector *procCollector, config ProcessActionsConfig, run func(int, ProcessAction) error) {
+		procStats, processActionsConfig, runProcessAction = collector, config, run
+	}(procStats, processActionsConfig, runProcessAction)
+	procStats = fixtureCollector("testdata/proc/t0")
+	processActionsConfig = ProcessActionsConfig{AllowCommands: []string{"web*"}, ConfirmTimeout: time.Minute}
+	var ran []ProcessAction
+	runProcessAction = func(pid int, action ProcessAction) error {
+		if pid != 42 {
+			t.Errorf("action on %d, want 42", pid)
+		}
+		ran = append(ran, action)
+		return nil
+	}
+
+	code, result := postAction(t, 42, `{"Action": "signal", "Signal": "sigterm"}`)
+	token, _ := result["Token"].(string)
+	if code != http.StatusAccepted || token == "" || len(ran) != 0 {
+		t.Fatalf("first request: %d %v, want a token and nothing run", code, result)
+	}
+	// A token only confirms the action it was issued for, and only once
+	if code, result = postAction(t, 42, `{"Action": "signal", "Signal": "KILL", "Token": "`+token+`"}`); code != http.StatusForbidden {
+		t.Errorf("token for another signal: %d %v, want 403", code, result)
+	}
+	if code, result = postAction(t, 42, `{"Action": "signal", "Signal": "TERM", "Token": "`+token+`"}`); code != http.StatusForbidden {
+		t.Errorf("token used after a mismatch: %d %v, want 403", code, result)
+	}
+
+	_, result = postAction(t, 42, `{"Action": "renice", "Nice": 10}`)
+	token, _ = result["Token"].(string)
+	if code, result = postAction(t, 42, `{"Action": "renice", "Nice": 10, "Token": "`+token+`"}`); code != http.StatusOK || result["Status"] != "done" {
+		t.Errorf("confirmed renice: %d %v, want done", code, result)
+	}
+	if want := []ProcessAction{{Action: "renice", Nice: 10}}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %+v, want %+v", ran, want)
+	}
+	if code, _ = postAction(t, 42, `{"Action": "renice", "Nice": 10, "Token": "`+token+`"}`); code != http.StatusForbidden {
+		t.Errorf("reused token: %d, want 403", code)
+	}
+
+	for _, c := range []struct {
+		pid  int
+		body string
+		want int
+	}{
+		{2, `{"Action": "signal", "Signal": "TERM"}`, http.StatusForbidden},
+		{1, `{"Action": "signal", "Signal": "TERM"}`, http.StatusForbidden},
+		{7, `{"Action": "signal", "Signal": "TERM"}`, http.StatusNotFound},
+		{42, `{"Action": "signal", "Signal": "HUP"}`, http.StatusBadRequest},
+		{42, `{"Action": "renice", "Nice": -21}`, http.StatusBadRequest},
+		{42, `{"Action": "ionice", "Class": "best-effort", "Level": 8}`, http.StatusBadRequest},
+		{42, `{"Action": "exec"}`, http.StatusBadRequest},
+	} {
+		if code, result := postAction(t, c.pid, c.body); code != c.want {
+			t.Errorf("%d %s: %d %v, want %d", c.pid, c.body, code, result, c.want)
+		}
+	}
+	if len(ran) != 1 {
+		t.Errorf("ran %+v, want only the renice", ran)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		file := filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	config, err := loadConfig(write("process_actions:\n  allow_users: [www-data]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ProcessActions.ConfirmTimeout != time.Minute || !config.ProcessActions.allows(33, "www-data", "nginx") {
+		t.Errorf("got %+v, want www-data allowed with the default timeout", config)
+	}
+	if !config.Diagnostics.DenyPrivate {
+		t.Error("deny_private is off when the config does not set it")
+	}
+	if config, err = loadConfig(write("diagnostics:\n  deny_private: false\n")); err != nil || config.Diagnostics.DenyPrivate {
+		t.Errorf("got %+v, %v; want deny_private turned off", config.Diagnostics, err)
+	}
+	for _, content := range []string{
+		"process_actions:\n  allow_user: [www-data]\n",
+		"process_actions:\n  allow_commands: [\"[\"]\n",
+		"process_actions:\n  confirm_timeout: 0s\n",
+	} {
+		if _, err := loadConfig(write(content)); err == nil {
+			t.Errorf("loadConfig accepted %q", content)
+		}
+	}
+}
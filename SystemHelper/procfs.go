@@ -0,0 +1,696 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// clockTicks is USER_HZ, the unit of the tick counters in /proc. The kernel
+// fixes it at 100 for userspace regardless of its internal timer frequency.
+const clockTicks = 100
+
+// topProcessCount is how many processes the Linux collector reports
+const topProcessCount = 20
+
+// procFS reads system statistics from a proc filesystem mounted at root,
+// which is /proc except in tests
+type procFS struct {
+	root string
+}
+
+func (p procFS) path(elem ...string) string {
+	return filepath.Join(append([]string{p.root}, elem...)...)
+}
+
+// cpuTimes are the tick counters of a cpu line in /proc/stat
+type cpuTimes struct {
+	User, Nice, System, Idle, IOWait, IRQ, SoftIRQ, Steal uint64
+}
+
+// Total is the ticks spent in every state. Guest time is already included
+// in User and Nice, so it is not added again.
+func (c cpuTimes) Total() uint64 {
+	return c.User + c.Nice + c.System + c.Idle + c.IOWait + c.IRQ + c.SoftIRQ + c.Steal
+}
+
+// Busy is the ticks spent neither idle nor waiting for I/O
+func (c cpuTimes) Busy() uint64 {
+	return c.Total() - c.Idle - c.IOWait
+}
+
+// cpuStat is the cpu section of /proc/stat
+type cpuStat struct {
+	// All is the aggregate of every core
+	All   cpuTimes
+	Cores []cpuTimes
+}
+
+// readCPUStat reads the cpu lines of /proc/stat
+func (p procFS) readCPUStat() (cpuStat, error) {
+	file, err := os.Open(p.path("stat"))
+	if err != nil {
+		return cpuStat{}, err
+	}
+	defer file.Close()
+
+	var stat cpuStat
+	found := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		times, err := parseCPUTimes(fields[1:])
+		if err != nil {
+			return cpuStat{}, fmt.Errorf("%s: %s: %v", file.Name(), fields[0], err)
+		}
+		if fields[0] == "cpu" {
+			stat.All = times
+			found = true
+		} else {
+			stat.Cores = append(stat.Cores, times)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cpuStat{}, err
+	}
+	if !found {
+		return cpuStat{}, fmt.Errorf("%s: no cpu line", file.Name())
+	}
+	return stat, nil
+}
+
+// parseCPUTimes parses the counters after the cpu label. Older kernels
+// report fewer columns; the missing ones are zero.
+func parseCPUTimes(fields []string) (cpuTimes, error) {
+	if len(fields) < 4 {
+		return cpuTimes{}, fmt.Errorf("want at least 4 counters, got %d", len(fields))
+	}
+	var values [8]uint64
+	for i := 0; i < len(values) && i < len(fields); i++ {
+		value, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return cpuTimes{}, err
+		}
+		values[i] = value
+	}
+	return cpuTimes{
+		User:    values[0],
+		Nice:    values[1],
+		System:  values[2],
+		Idle:    values[3],
+		IOWait:  values[4],
+		IRQ:     values[5],
+		SoftIRQ: values[6],
+		Steal:   values[7],
+	}, nil
+}
+
+// cpuPercent is the share of ticks between two samples that were busy
+func cpuPercent(prev, cur cpuTimes) float64 {
+	if cur.Total() <= prev.Total() || cur.Busy() < prev.Busy() {
+		return 0
+	}
+	return float64(cur.Busy()-prev.Busy()) / float64(cur.Total()-prev.Total()) * 100
+}
+
+// cpuBreakdown is the share of ticks between two samples spent in each state
+func cpuBreakdown(prev, cur cpuTimes) CPUTimes {
+	total := float64(cur.Total()) - float64(prev.Total())
+	if total <= 0 {
+		return CPUTimes{}
+	}
+	share := func(prev, cur uint64) float64 {
+		if cur < prev {
+			return 0
+		}
+		return float64(cur-prev) / total * 100
+	}
+	return CPUTimes{
+		User:    share(prev.User, cur.User),
+		Nice:    share(prev.Nice, cur.Nice),
+		System:  share(prev.System, cur.System),
+		Idle:    share(prev.Idle, cur.Idle),
+		IOWait:  share(prev.IOWait, cur.IOWait),
+		IRQ:     share(prev.IRQ, cur.IRQ),
+		SoftIRQ: share(prev.SoftIRQ, cur.SoftIRQ),
+		Steal:   share(prev.Steal, cur.Steal),
+	}
+}
+
+// readMemInfo reads /proc/meminfo as a map of field to kilobytes
+func (p procFS) readMemInfo() (map[string]uint64, error) {
+	file, err := os.Open(p.path("meminfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseMemInfo(file)
+}
+
+func parseMemInfo(r io.Reader) (map[string]uint64, error) {
+	info := make(map[string]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		if kb, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			info[key] = kb
+		}
+	}
+	return info, scanner.Err()
+}
+
+// memoryPercent is the share of memory that cannot be reclaimed. Kernels
+// before 3.14 lack MemAvailable, so it is estimated from the free and
+// cache fields.
+func memoryPercent(info map[string]uint64) float64 {
+	total := info["MemTotal"]
+	if total == 0 {
+		return 0
+	}
+	available, ok := info["MemAvailable"]
+	if !ok {
+		available = info["MemFree"] + info["Buffers"] + info["Cached"]
+	}
+	if available > total {
+		available = total
+	}
+	return float64(total-available) / float64(total) * 100
+}
+
+// swapUsage returns the swap size and use in bytes, and the percentage used
+func swapUsage(info map[string]uint64) (total, used uint64, percent float64) {
+	total = info["SwapTotal"]
+	free := info["SwapFree"]
+	if total == 0 || free > total {
+		return total * 1024, 0, 0
+	}
+	used = total - free
+	return total * 1024, used * 1024, float64(used) / float64(total) * 100
+}
+
+// readUptime returns the seconds since boot from /proc/uptime
+func (p procFS) readUptime() (float64, error) {
+	data, err := os.ReadFile(p.path("uptime"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%s: empty", p.path("uptime"))
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// readLoadAverage reads the 1, 5 and 15 minute load averages from /proc/loadavg
+func (p procFS) readLoadAverage() ([3]float64, error) {
+	var load [3]float64
+	data, err := os.ReadFile(p.path("loadavg"))
+	if err != nil {
+		return load, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < len(load) {
+		return load, fmt.Errorf("%s: want %d load averages, got %d", p.path("loadavg"), len(load), len(fields))
+	}
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return load, fmt.Errorf("%s: %v", p.path("loadavg"), err)
+		}
+	}
+	return load, nil
+}
+
+// procSample is what the collector reads for one process
+type procSample struct {
+	PID     int
+	PPID    int
+	Command string
+	// State is the one-letter state, such as R for running
+	State   string
+	Nice    int
+	Threads int
+	// UID is the real user ID
+	UID int
+	// Ticks is the user and system time the process has used
+	Ticks uint64
+	// Start is the ticks after boot at which the process started
+	Start uint64
+	// RSS is the resident set size in kilobytes; kernel threads have none
+	RSS uint64
+}
+
+// readProcesses reads every process in the proc filesystem. Processes that
+// exit while they are being read are skipped.
+func (p procFS) readProcesses() ([]procSample, error) {
+	entries, err := os.ReadDir(p.root)
+	if err != nil {
+		return nil, err
+	}
+	var samples []procSample
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		sample, err := p.readProcess(pid)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// readProcess reads /proc/[pid]/stat and /proc/[pid]/status
+func (p procFS) readProcess(pid int) (procSample, error) {
+	dir := strconv.Itoa(pid)
+	data, err := os.ReadFile(p.path(dir, "stat"))
+	if err != nil {
+		return procSample{}, err
+	}
+	sample, err := parseProcStat(string(data))
+	if err != nil {
+		return procSample{}, fmt.Errorf("%s: %v", p.path(dir, "stat"), err)
+	}
+	sample.PID = pid
+
+	status, err := os.Open(p.path(dir, "status"))
+	if err != nil {
+		return procSample{}, err
+	}
+	defer status.Close()
+	scanner := bufio.NewScanner(status)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "Uid":
+			sample.UID, _ = strconv.Atoi(fields[0])
+		case "VmRSS":
+			sample.RSS, _ = strconv.ParseUint(fields[0], 10, 64)
+		}
+	}
+	return sample, scanner.Err()
+}
+
+// parseProcStat parses /proc/[pid]/stat. The command is in parentheses and
+// may itself contain spaces and parentheses, so the fields are counted from
+// the last closing parenthesis.
+func parseProcStat(data string) (procSample, error) {
+	open := strings.IndexByte(data, '(')
+	end := strings.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return procSample{}, fmt.Errorf("no command in parentheses")
+	}
+	// fields[0] is the state, field 3 in proc(5)
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 20 {
+		return procSample{}, fmt.Errorf("want at least 22 fields, got %d", len(fields)+2)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return procSample{}, fmt.Errorf("utime: %v", err)
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return procSample{}, fmt.Errorf("stime: %v", err)
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procSample{}, fmt.Errorf("starttime: %v", err)
+	}
+	// These only inform the process details, so a bad value is left at zero
+	ppid, _ := strconv.Atoi(fields[1])
+	nice, _ := strconv.Atoi(fields[16])
+	threads, _ := strconv.Atoi(fields[17])
+	return procSample{
+		PPID:    ppid,
+		Command: data[open+1 : end],
+		State:   fields[0],
+		Nice:    nice,
+		Threads: threads,
+		Ticks:   utime + stime,
+		Start:   start,
+	}, nil
+}
+
+// socketTables are the files under /proc/net read for sockets, with the
+// protocol names netstat uses for them
+var socketTables = []string{"tcp", "tcp6", "udp", "udp6"}
+
+// tcpStates names the states in include/net/tcp_states.h. UDP uses
+// ESTABLISHED for connected sockets and CLOSE for the rest, which are
+// listed as UNCONN, like ss does.
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+	"0C": "NEW_SYN_RECV",
+}
+
+// socketEntry is a socket in one of the socketTables
+type socketEntry struct {
+	Protocol  string
+	State     string
+	LocalPort int
+	Local     string
+	Remote    string
+	Inode     uint64
+}
+
+// readSockets reads every socket in the tables under dir, which is net for
+// the collector's own network namespace or [pid]/net for a process's. A
+// missing table, such as tcp6 when IPv6 is disabled, is skipped.
+func (p procFS) readSockets(dir ...string) ([]socketEntry, error) {
+	var sockets []socketEntry
+	for _, table := range socketTables {
+		path := p.path(append(dir, table)...)
+		file, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list, err := parseSocketTable(file, table)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		sockets = append(sockets, list...)
+	}
+	return sockets, nil
+}
+
+// readOpenPorts reads the listening TCP sockets and the unconnected UDP
+// sockets, like `netstat -tuln`
+func (p procFS) readOpenPorts() ([]PortInfo, error) {
+	sockets, err := p.readSockets("net")
+	if err != nil {
+		return nil, err
+	}
+	var ports []PortInfo
+	seen := make(map[string]bool)
+	for _, socket := range sockets {
+		if socket.State != "LISTEN" && socket.State != "UNCONN" {
+			continue
+		}
+		// Sockets sharing a port with SO_REUSEPORT are listed once
+		key := socket.Protocol + " " + socket.Local
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ports = append(ports, PortInfo{
+			Port:     socket.LocalPort,
+			Protocol: socket.Protocol,
+			State:    socket.State,
+			Local:    socket.Local,
+			Remote:   socket.Remote,
+		})
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Port != ports[j].Port {
+			return ports[i].Port < ports[j].Port
+		}
+		if ports[i].Protocol != ports[j].Protocol {
+			return ports[i].Protocol < ports[j].Protocol
+		}
+		return ports[i].Local < ports[j].Local
+	})
+	return ports, nil
+}
+
+func parseSocketTable(r io.Reader, protocol string) ([]socketEntry, error) {
+	var sockets []socketEntry
+	scanner := bufio.NewScanner(r)
+	// Skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		state := tcpStates[fields[3]]
+		if state == "" {
+			state = fields[3]
+		}
+		if strings.HasPrefix(protocol, "udp") && state == "CLOSE" {
+			state = "UNCONN"
+		}
+		localIP, localPort, err := parseSocketAddress(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		remoteIP, remotePort, err := parseSocketAddress(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad inode %q", fields[9])
+		}
+		sockets = append(sockets, socketEntry{
+			Protocol:  protocol,
+			State:     state,
+			LocalPort: localPort,
+			Local:     formatEndpoint(localIP, localPort),
+			Remote:    formatEndpoint(remoteIP, remotePort),
+			Inode:     inode,
+		})
+	}
+	return sockets, scanner.Err()
+}
+
+// parseSocketAddress decodes an address such as 0100007F:1F91. The address
+// is printed as 32-bit words in host byte order, the port in network order.
+func parseSocketAddress(value string) (net.IP, int, error) {
+	host, port, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("bad address %q", value)
+	}
+	raw, err := hex.DecodeString(host)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("bad address %q", value)
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.NativeEndian.Uint32(raw[i:]))
+	}
+	number, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("bad port in %q", value)
+	}
+	return ip, int(number), nil
+}
+
+func formatEndpoint(ip net.IP, port int) string {
+	if port == 0 {
+		return net.JoinHostPort(ip.String(), "*")
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+// procCollector turns the counters in /proc into rates by comparing each
+// sample with the previous one
+type procCollector struct {
+	fs procFS
+	// statfs sizes a mounted filesystem; tests replace it
+	statfs func(path string) (filesystemSize, error)
+
+	mu         sync.Mutex
+	prevCPU    cpuStat
+	prevTicks  map[int]uint64
+	prevUptime float64
+	prevDisks  map[string]diskCounters
+	prevNet    map[string]netCounters
+
+	// statting holds the mount points whose statfs has not returned, such
+	// as a hung network filesystem, so they are not queried again meanwhile
+	statMu   sync.Mutex
+	statting map[string]bool
+}
+
+func newProcCollector(root string) *procCollector {
+	return &procCollector{
+		fs:       procFS{root: root},
+		statfs:   statFilesystem,
+		statting: make(map[string]bool),
+	}
+}
+
+// procStats collects the Linux statistics from the host's /proc
+var procStats = newProcCollector("/proc")
+
+// collect reads a sample. The first sample reports CPU, disk and network
+// usage since boot and each process's average since it started; later ones
+// report the usage since the previous sample. Whatever could be read is
+// returned along with the errors for the rest.
+func (c *procCollector) collect() (SystemStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var stats SystemStats
+	var errs []error
+
+	// Rates are measured over the uptime between samples
+	uptime, uptimeErr := c.fs.readUptime()
+	if uptimeErr != nil {
+		errs = append(errs, uptimeErr)
+	}
+	elapsed := uptime - c.prevUptime
+
+	cpu, cpuErr := c.fs.readCPUStat()
+	if cpuErr != nil {
+		errs = append(errs, cpuErr)
+	} else {
+		stats.CPUUsage = cpuPercent(c.prevCPU.All, cpu.All)
+		stats.CPUTimes = cpuBreakdown(c.prevCPU.All, cpu.All)
+		stats.CPUCores = make([]float64, len(cpu.Cores))
+		for i, core := range cpu.Cores {
+			// A core brought online since the last sample is measured since boot
+			var prev cpuTimes
+			if i < len(c.prevCPU.Cores) {
+				prev = c.prevCPU.Cores[i]
+			}
+			stats.CPUCores[i] = cpuPercent(prev, core)
+		}
+	}
+
+	memInfo, err := c.fs.readMemInfo()
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		stats.MemoryUsage = memoryPercent(memInfo)
+		stats.SwapTotal, stats.SwapUsed, stats.SwapUsage = swapUsage(memInfo)
+	}
+
+	if stats.LoadAverage, err = c.fs.readLoadAverage(); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Process CPU is measured against the same interval as the system's
+	if cpuErr == nil && uptimeErr == nil {
+		processes, err := c.processes(cpu, memInfo["MemTotal"], uptime)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		stats.TopProcesses = processes
+		c.prevCPU = cpu
+	}
+
+	ports, err := c.fs.readOpenPorts()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	stats.OpenPorts = ports
+
+	if stats.Filesystems, err = c.filesystems(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if uptimeErr == nil {
+		disks, err := c.fs.readDiskStats()
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			stats.Disks = diskRates(c.prevDisks, disks, elapsed)
+			c.prevDisks = disks
+		}
+
+		interfaces, err := c.fs.readNetDev()
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			stats.Network = networkRates(c.prevNet, interfaces, elapsed)
+			c.prevNet = interfaces
+		}
+		c.prevUptime = uptime
+	}
+
+	return stats, errors.Join(errs...)
+}
+
+// processes returns the busiest processes, measured against the cpu
+// sample and uptime. CPU is a percentage of one core, as in top.
+func (c *procCollector) processes(cpu cpuStat, memTotal uint64, uptime float64) ([]ProcessInfo, error) {
+	samples, err := c.fs.readProcesses()
+	if err != nil {
+		return nil, err
+	}
+	cores := len(cpu.Cores)
+	if cores == 0 {
+		cores = 1
+	}
+	elapsed := cpu.All.Total() - c.prevCPU.All.Total()
+	now := uint64(uptime * clockTicks)
+
+	ticks := make(map[int]uint64, len(samples))
+	processes := make([]ProcessInfo, 0, len(samples))
+	for _, sample := range samples {
+		ticks[sample.PID] = sample.Ticks
+		info := ProcessInfo{PID: sample.PID, Command: sample.Command}
+
+		prev, seen := c.prevTicks[sample.PID]
+		switch {
+		case seen && prev <= sample.Ticks && elapsed > 0:
+			info.CPU = float64(sample.Ticks-prev) / float64(elapsed) * float64(cores) * 100
+		case now > sample.Start:
+			// A new process, or a reused PID: average over its lifetime, like ps
+			info.CPU = float64(sample.Ticks) / float64(now-sample.Start) * 100
+		}
+		if memTotal > 0 {
+			info.Memory = float64(sample.RSS) / float64(memTotal) * 100
+		}
+		processes = append(processes, info)
+	}
+	c.prevTicks = ticks
+
+	sort.Slice(processes, func(i, j int) bool {
+		if processes[i].CPU != processes[j].CPU {
+			return processes[i].CPU > processes[j].CPU
+		}
+		if processes[i].Memory != processes[j].Memory {
+			return processes[i].Memory > processes[j].Memory
+		}
+		return processes[i].PID < processes[j].PID
+	})
+	if len(processes) > topProcessCount {
+		processes = processes[:topProcessCount]
+	}
+	return processes, nil
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// diskSectorSize is the unit of the sector counts in /proc/diskstats,
+// whatever the device's own sector size
+const diskSectorSize = 512
+
+// diskCounters are the cumulative counters of a block device
+type diskCounters struct {
+	Reads        uint64
+	ReadSectors  uint64
+	Writes       uint64
+	WriteSectors uint64
+	// IOMillis is the time the device had I/O in flight
+	IOMillis uint64
+}
+
+// ignoredDisks are the prefixes of virtual block devices
+var ignoredDisks = []string{"loop", "ram", "fd", "sr"}
+
+// readDiskStats reads /proc/diskstats. Loop, RAM and optical devices, devices
+// that have never done I/O, and partitions of a listed disk are skipped, so
+// each disk is counted once.
+func (p procFS) readDiskStats() (map[string]diskCounters, error) {
+	file, err := os.Open(p.path("diskstats"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	disks := make(map[string]diskCounters)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+		name := fields[2]
+		if hasAnyPrefix(name, ignoredDisks) {
+			continue
+		}
+		var values [11]uint64
+		for i := range values {
+			if values[i], err = strconv.ParseUint(fields[3+i], 10, 64); err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", file.Name(), name, err)
+			}
+		}
+		counters := diskCounters{
+			Reads:        values[0],
+			ReadSectors:  values[2],
+			Writes:       values[4],
+			WriteSectors: values[6],
+			IOMillis:     values[9],
+		}
+		if counters == (diskCounters{}) {
+			continue
+		}
+		disks[name] = counters
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for name := range disks {
+		if isPartition(name, disks) {
+			delete(disks, name)
+		}
+	}
+	return disks, nil
+}
+
+// isPartition reports whether name is a partition of another device, such
+// as sda1 of sda or nvme0n1p1 of nvme0n1. A disk whose name ends in a digit
+// numbers its partitions after a "p", so dm-10 is not a partition of dm-1.
+func isPartition(name string, disks map[string]diskCounters) bool {
+	for disk := range disks {
+		suffix, ok := strings.CutPrefix(name, disk)
+		if !ok || suffix == "" {
+			continue
+		}
+		if last := disk[len(disk)-1]; last >= '0' && last <= '9' {
+			if suffix, ok = strings.CutPrefix(suffix, "p"); !ok {
+				continue
+			}
+		}
+		if _, err := strconv.ParseUint(suffix, 10, 32); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// perSecond is the rate of a counter over seconds. A counter that went
+// backwards was reset, so it has no rate.
+func perSecond(prev, cur uint64, seconds float64) float64 {
+	if seconds <= 0 || cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / seconds
+}
+
+// diskRates compares two readings taken seconds apart. Without a previous
+// reading the counters are averaged since boot; a device that appeared
+// since the previous reading has no rates yet.
+func diskRates(prev, cur map[string]diskCounters, seconds float64) []DiskInfo {
+	names := make([]string, 0, len(cur))
+	for name := range cur {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	disks := make([]DiskInfo, 0, len(names))
+	for _, name := range names {
+		info := DiskInfo{Device: name}
+		before, seen := prev[name]
+		if prev == nil || seen {
+			now := cur[name]
+			info.ReadBytesPerSec = perSecond(before.ReadSectors, now.ReadSectors, seconds) * diskSectorSize
+			info.WriteBytesPerSec = perSecond(before.WriteSectors, now.WriteSectors, seconds) * diskSectorSize
+			info.ReadsPerSec = perSecond(before.Reads, now.Reads, seconds)
+			info.WritesPerSec = perSecond(before.Writes, now.Writes, seconds)
+			info.Busy = perSecond(before.IOMillis, now.IOMillis, seconds) / 1000 * 100
+			if info.Busy > 100 {
+				info.Busy = 100
+			}
+		}
+		disks = append(disks, info)
+	}
+	return disks
+}
+
+// netCounters are the cumulative counters of a network interface
+type netCounters struct {
+	RxBytes, RxPackets, RxErrors, RxDropped uint64
+	TxBytes, TxPackets, TxErrors, TxDropped uint64
+}
+
+// readNetDev reads the interface counters in /proc/net/dev
+func (p procFS) readNetDev() (map[string]netCounters, error) {
+	file, err := os.Open(p.path("net", "dev"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	interfaces := make(map[string]netCounters)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// The counters contain no colons, so the last one ends the name;
+		// the two header lines have none
+		colon := strings.LastIndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		name := strings.TrimSpace(line[:colon])
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) < 12 {
+			return nil, fmt.Errorf("%s: %s: want at least 12 counters, got %d", file.Name(), name, len(fields))
+		}
+		var values [12]uint64
+		for i := range values {
+			if values[i], err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", file.Name(), name, err)
+			}
+		}
+		interfaces[name] = netCounters{
+			RxBytes: values[0], RxPackets: values[1], RxErrors: values[2], RxDropped: values[3],
+			TxBytes: values[8], TxPackets: values[9], TxErrors: values[10], TxDropped: values[11],
+		}
+	}
+	return interfaces, scanner.Err()
+}
+
+// networkRates compares two readings like diskRates
+func networkRates(prev, cur map[string]netCounters, seconds float64) []NetworkInfo {
+	names := make([]string, 0, len(cur))
+	for name := range cur {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	interfaces := make([]NetworkInfo, 0, len(names))
+	for _, name := range names {
+		now := cur[name]
+		info := NetworkInfo{
+			Interface: name,
+			RxErrors:  now.RxErrors,
+			TxErrors:  now.TxErrors,
+			RxDropped: now.RxDropped,
+			TxDropped: now.TxDropped,
+		}
+		before, seen := prev[name]
+		if prev == nil || seen {
+			info.RxBytesPerSec = perSecond(before.RxBytes, now.RxBytes, seconds)
+			info.TxBytesPerSec = perSecond(before.TxBytes, now.TxBytes, seconds)
+			info.RxPacketsPerSec = perSecond(before.RxPackets, now.RxPackets, seconds)
+			info.TxPacketsPerSec = perSecond(before.TxPackets, now.TxPackets, seconds)
+		}
+		interfaces = append(interfaces, info)
+	}
+	return interfaces
+}
+
+// mountEntry is a line of /proc/mounts
+type mountEntry struct {
+	Device string
+	Mount  string
+	Type   string
+}
+
+// virtualFilesystems hold no data on disk, so they are not listed. tmpfs
+// is kept, since a full /run or /dev/shm causes trouble too.
+var virtualFilesystems = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true, "cgroup2": true,
+	"configfs": true, "debugfs": true, "devpts": true, "devtmpfs": true, "efivarfs": true,
+	"fusectl": true, "hugetlbfs": true, "mqueue": true, "nsfs": true, "proc": true,
+	"pstore": true, "ramfs": true, "rpc_pipefs": true, "securityfs": true,
+	"selinuxfs": true, "squashfs": true, "sysfs": true, "tracefs": true,
+}
+
+// readMounts reads /proc/mounts. When several filesystems are mounted on
+// the same point only the last, which hides the others, is returned.
+func (p procFS) readMounts() ([]mountEntry, error) {
+	file, err := os.Open(p.path("mounts"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var mounts []mountEntry
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || virtualFilesystems[fields[2]] {
+			continue
+		}
+		entry := mountEntry{Device: unescapeMount(fields[0]), Mount: unescapeMount(fields[1]), Type: fields[2]}
+		if i, ok := index[entry.Mount]; ok {
+			mounts[i] = entry
+			continue
+		}
+		index[entry.Mount] = len(mounts)
+		mounts = append(mounts, entry)
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMount decodes the octal escapes, such as \040 for a space, that
+// /proc/mounts uses for whitespace and backslashes
+func unescapeMount(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) {
+			if code, err := strconv.ParseUint(value[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// filesystemSize is what statfs reports for a filesystem, in bytes and inodes
+type filesystemSize struct {
+	Total      uint64
+	Free       uint64
+	Available  uint64
+	Inodes     uint64
+	InodesFree uint64
+}
+
+// statfsTimeout bounds the wait for a filesystem's size, since statfs on an
+// unreachable network filesystem can block indefinitely
+const statfsTimeout = 2 * time.Second
+
+// filesystems returns the usage of each mounted filesystem, like df.
+// Filesystems that cannot be sized, or that have no blocks, are skipped.
+func (c *procCollector) filesystems() ([]FilesystemInfo, error) {
+	mounts, err := c.fs.readMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var filesystems []FilesystemInfo
+	for _, mount := range mounts {
+		size, ok := c.statWithTimeout(mount.Mount)
+		if !ok || size.Total == 0 {
+			continue
+		}
+		info := FilesystemInfo{
+			Mount:     mount.Mount,
+			Device:    mount.Device,
+			Type:      mount.Type,
+			Total:     size.Total,
+			Available: size.Available,
+			Inodes:    size.Inodes,
+		}
+		if size.Free <= size.Total {
+			info.Used = size.Total - size.Free
+		}
+		// Blocks reserved for root count as neither used nor available
+		if info.Used+info.Available > 0 {
+			info.Usage = float64(info.Used) / float64(info.Used+info.Available) * 100
+		}
+		if size.Inodes > 0 && size.InodesFree <= size.Inodes {
+			info.InodesUsed = size.Inodes - size.InodesFree
+			info.InodeUsage = float64(info.InodesUsed) / float64(size.Inodes) * 100
+		}
+		filesystems = append(filesystems, info)
+	}
+	sort.Slice(filesystems, func(i, j int) bool {
+		return filesystems[i].Mount < filesystems[j].Mount
+	})
+	return filesystems, nil
+}
+
+// statWithTimeout sizes the filesystem at mount. A call that is still
+// blocked from an earlier sample is not repeated.
+func (c *procCollector) statWithTimeout(mount string) (filesystemSize, bool) {
+	c.statMu.Lock()
+	if c.statting[mount] {
+		c.statMu.Unlock()
+		return filesystemSize{}, false
+	}
+	c.statting[mount] = true
+	c.statMu.Unlock()
+
+	type result struct {
+		size filesystemSize
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		size, err := c.statfs(mount)
+		c.statMu.Lock()
+		delete(c.statting, mount)
+		c.statMu.Unlock()
+		done <- result{size, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.size, r.err == nil
+	case <-time.After(statfsTimeout):
+		return filesystemSize{}, false
+	}
+}
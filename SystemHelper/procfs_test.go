@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The fixtures under testdata/proc are two samples of a two-core host
+// taken 100 seconds apart: t0 has processes 1, 2 (a kernel thread) and 42;
+// by t1, 42 has exited and 77 has started. testdata/proc/partitions only
+// has a diskstats file with disks whose names end in digits.
+
+func approx(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+// fixtureSizes stand in for statfs on the fixture mounts
+var fixtureSizes = map[string]filesystemSize{
+	"/":            {Total: 1100, Free: 300, Available: 200, Inodes: 100, InodesFree: 25},
+	"/run":         {Total: 1000, Free: 1000, Available: 1000},
+	"/mnt/my data": {Total: 2000, Free: 500, Available: 500, Inodes: 10, InodesFree: 10},
+}
+
+func fixtureCollector(root string) *procCollector {
+	collector := newProcCollector(root)
+	collector.statfs = func(path string) (filesystemSize, error) {
+		size, ok := fixtureSizes[path]
+		if !ok {
+			return filesystemSize{}, errors.New("stale file handle")
+		}
+		return size, nil
+	}
+	return collector
+}
+
+func TestProcCollectorFirstSample(t *testing.T) {
+	collector := fixtureCollector("testdata/proc/t0")
+	stats, err := collector.collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Since boot: 1800 of 10000 ticks busy
+	if !approx(stats.CPUUsage, 18) {
+		t.Errorf("CPUUsage = %v, want 18", stats.CPUUsage)
+	}
+	// 2000000 of 8000000 kB available
+	if !approx(stats.MemoryUsage, 75) {
+		t.Errorf("MemoryUsage = %v, want 75", stats.MemoryUsage)
+	}
+
+	if stats.LoadAverage != [3]float64{0.5, 0.25, 0.1} {
+		t.Errorf("LoadAverage = %v, want [0.5 0.25 0.1]", stats.LoadAverage)
+	}
+
+	if !approx(stats.CPUTimes.User, 12) || !approx(stats.CPUTimes.System, 6) || !approx(stats.CPUTimes.Idle, 80) || !approx(stats.CPUTimes.IOWait, 2) {
+		t.Errorf("CPUTimes = %+v, want 12%% user, 6%% system, 80%% idle, 2%% iowait", stats.CPUTimes)
+	}
+	if len(stats.CPUCores) != 2 || !approx(stats.CPUCores[0], 18) || !approx(stats.CPUCores[1], 18) {
+		t.Errorf("CPUCores = %v, want [18 18]", stats.CPUCores)
+	}
+	if stats.SwapTotal != 2000000*1024 || stats.SwapUsed != 0 || stats.SwapUsage != 0 {
+		t.Errorf("swap = %d/%d bytes, %v%%, want none used of 2000000 kB", stats.SwapUsed, stats.SwapTotal, stats.SwapUsage)
+	}
+
+	// Since boot, 1000 seconds ago
+	wantDisks := []DiskInfo{
+		{Device: "nvme0n1", ReadBytesPerSec: 5120, WriteBytesPerSec: 1024, ReadsPerSec: 0.5, WritesPerSec: 0.1, Busy: 0.02},
+		{Device: "sda", ReadBytesPerSec: 10240, WriteBytesPerSec: 20480, ReadsPerSec: 1, WritesPerSec: 2, Busy: 0.1},
+	}
+	assertDisks(t, stats.Disks, wantDisks)
+
+	// Lifetime averages: 5000 ticks over 50000 for 42, 4000 over 100000 for 1
+	want := []ProcessInfo{
+		{PID: 42, Command: "web (worker)", CPU: 10, Memory: 5},
+		{PID: 1, Command: "systemd", CPU: 4, Memory: 1},
+		{PID: 2, Command: "kthreadd"},
+	}
+	assertProcesses(t, stats.TopProcesses, want)
+}
+
+func TestProcCollectorRates(t *testing.T) {
+	collector := fixtureCollector("testdata/proc/t0")
+	if _, err := collector.collect(); err != nil {
+		t.Fatal(err)
+	}
+	collector.fs.root = "testdata/proc/t1"
+	stats, err := collector.collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 400 of the 1000 ticks between the samples were busy
+	if !approx(stats.CPUUsage, 40) {
+		t.Errorf("CPUUsage = %v, want 40", stats.CPUUsage)
+	}
+	if !approx(stats.MemoryUsage, 50) {
+		t.Errorf("MemoryUsage = %v, want 50", stats.MemoryUsage)
+	}
+
+	if !approx(stats.CPUTimes.User, 30) || !approx(stats.CPUTimes.System, 10) || !approx(stats.CPUTimes.Idle, 50) || !approx(stats.CPUTimes.IOWait, 10) {
+		t.Errorf("CPUTimes = %+v, want 30%% user, 10%% system, 50%% idle, 10%% iowait", stats.CPUTimes)
+	}
+	if len(stats.CPUCores) != 2 || !approx(stats.CPUCores[0], 50) || !approx(stats.CPUCores[1], 30) {
+		t.Errorf("CPUCores = %v, want [50 30]", stats.CPUCores)
+	}
+	if stats.SwapUsed != 500000*1024 || !approx(stats.SwapUsage, 25) {
+		t.Errorf("swap = %d bytes, %v%%, want 500000 kB, 25%%", stats.SwapUsed, stats.SwapUsage)
+	}
+
+	// sdb appeared since t0, so it has no rates yet
+	wantDisks := []DiskInfo{
+		{Device: "nvme0n1"},
+		{Device: "sda", ReadBytesPerSec: 1024000, WriteBytesPerSec: 102400, ReadsPerSec: 20, WritesPerSec: 5, Busy: 50},
+		{Device: "sdb"},
+	}
+	assertDisks(t, stats.Disks, wantDisks)
+
+	wantNetwork := []NetworkInfo{
+		{Interface: "eth0", RxBytesPerSec: 100000, TxBytesPerSec: 5000, RxPacketsPerSec: 100, TxPacketsPerSec: 10, RxErrors: 2, RxDropped: 1, TxDropped: 3},
+		{Interface: "lo"},
+	}
+	if !reflect.DeepEqual(stats.Network, wantNetwork) {
+		t.Errorf("Network = %+v, want %+v", stats.Network, wantNetwork)
+	}
+
+	// 1 used 100 ticks of 500 per core, so 20% of a core; 77 is new and
+	// averaged over its 1000 ticks of life
+	want := []ProcessInfo{
+		{PID: 1, Command: "systemd", CPU: 20, Memory: 1},
+		{PID: 77, Command: "sh", CPU: 3, Memory: 0.05},
+		{PID: 2, Command: "kthreadd"},
+	}
+	assertProcesses(t, stats.TopProcesses, want)
+
+	// t1 has no net directory
+	if len(stats.OpenPorts) != 0 {
+		t.Errorf("OpenPorts = %+v, want none", stats.OpenPorts)
+	}
+}
+
+func assertProcesses(t *testing.T, got, want []ProcessInfo) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d processes %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i].PID != want[i].PID || got[i].Command != want[i].Command ||
+			!approx(got[i].CPU, want[i].CPU) || !approx(got[i].Memory, want[i].Memory) {
+			t.Errorf("process %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func assertDisks(t *testing.T, got, want []DiskInfo) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got disks %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Device != want[i].Device || !approx(got[i].ReadBytesPerSec, want[i].ReadBytesPerSec) ||
+			!approx(got[i].WriteBytesPerSec, want[i].WriteBytesPerSec) || !approx(got[i].ReadsPerSec, want[i].ReadsPerSec) ||
+			!approx(got[i].WritesPerSec, want[i].WritesPerSec) || !approx(got[i].Busy, want[i].Busy) {
+			t.Errorf("disk %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadDiskStatsSkipsPartitions(t *testing.T) {
+	disks, err := procFS{root: "testdata/proc/partitions"}.readDiskStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for name := range disks {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	// nvme1n1p2 is kept because its disk is not listed
+	want := []string{"dm-1", "dm-10", "md1", "md10", "mmcblk0", "nbd1", "nbd10", "nvme1n1p2", "sda"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("disks = %v, want %v", got, want)
+	}
+}
+
+func TestFilesystems(t *testing.T) {
+	filesystems, err := fixtureCollector("testdata/proc/t0").filesystems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Virtual filesystems are skipped, the xfs mount is hidden by the ext4
+	// one on the same point, and the NFS mount cannot be sized
+	want := []FilesystemInfo{
+		{Mount: "/", Device: "/dev/sda1", Type: "ext4", Total: 1100, Used: 800, Available: 200, Usage: 80, Inodes: 100, InodesUsed: 75, InodeUsage: 75},
+		{Mount: "/mnt/my data", Device: "/dev/sdc1", Type: "ext4", Total: 2000, Used: 1500, Available: 500, Usage: 75, Inodes: 10},
+		{Mount: "/run", Device: "tmpfs", Type: "tmpfs", Total: 1000, Available: 1000},
+	}
+	if !reflect.DeepEqual(filesystems, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", filesystems, want)
+	}
+}
+
+func TestReadOpenPorts(t *testing.T) {
+	ports, err := procFS{root: "testdata/proc/t0"}.readOpenPorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The duplicate SSH listener is listed once, the established TCP and
+	// connected UDP sockets not at all, and the missing udp6 is skipped
+	want := []PortInfo{
+		{Port: 22, Protocol: "tcp", State: "LISTEN", Local: "0.0.0.0:22", Remote: "0.0.0.0:*"},
+		{Port: 53, Protocol: "udp", State: "UNCONN", Local: "127.0.0.53:53", Remote: "0.0.0.0:*"},
+		{Port: 68, Protocol: "udp", State: "UNCONN", Local: "0.0.0.0:68", Remote: "0.0.0.0:*"},
+		{Port: 80, Protocol: "tcp6", State: "LISTEN", Local: "[::]:80", Remote: "[::]:*"},
+		{Port: 5432, Protocol: "tcp6", State: "LISTEN", Local: "[::1]:5432", Remote: "[::]:*"},
+		{Port: 8081, Protocol: "tcp", State: "LISTEN", Local: "127.0.0.1:8081", Remote: "0.0.0.0:*"},
+	}
+	if !reflect.DeepEqual(ports, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", ports, want)
+	}
+}
+
+func TestMemoryPercentWithoutMemAvailable(t *testing.T) {
+	info, err := parseMemInfo(strings.NewReader("MemTotal: 1000 kB\nMemFree: 200 kB\nBuffers: 100 kB\nCached: 200 kB\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := memoryPercent(info); !approx(got, 50) {
+		t.Errorf("memoryPercent = %v, want 50", got)
+	}
+}
+
+func TestParseProcStatErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"12 no-parentheses S 1",
+		"12 (short) S 1 2 3",
+		"12 (bad) S 1 12 12 0 -1 0 0 0 0 0 x 0 0 0 20 0 1 0 100 0 0",
+	} {
+		if _, err := parseProcStat(data); err == nil {
+			t.Errorf("parseProcStat(%q) succeeded", data)
+		}
+	}
+}
+
+func TestProcCollectorMissingRoot(t *testing.T) {
+	stats, err := fixtureCollector("testdata/proc/missing").collect()
+	if err == nil {
+		t.Fatal("want an error for a missing proc filesystem")
+	}
+	if stats.CPUUsage != 0 || len(stats.TopProcesses) != 0 || len(stats.OpenPorts) != 0 {
+		t.Errorf("got stats %+v from a missing proc filesystem", stats)
+	}
+}
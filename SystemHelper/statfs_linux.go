@@ -0,0 +1,20 @@
+package main
+
+import "syscall"
+
+// statFilesystem sizes the filesystem mounted at path
+func statFilesystem(path string) (filesystemSize, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return filesystemSize{}, err
+	}
+	// Block counts are in fragment-size units
+	unit := uint64(st.Frsize)
+	return filesystemSize{
+		Total:      st.Blocks * unit,
+		Free:       st.Bfree * unit,
+		Available:  st.Bavail * unit,
+		Inodes:     st.Files,
+		InodesFree: st.Ffree,
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// statFilesystem is only needed by the Linux collector
+func statFilesystem(path string) (filesystemSize, error) {
+	return filesystemSize{}, fmt.Errorf("statfs is not supported on this platform")
+}
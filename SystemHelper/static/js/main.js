@@ -1,3 +1,37 @@
+// Escape text from the host, such as process names, before inserting it as HTML
+function escapeHTML(value) {
+    return String(value ?? '').replace(/[&<>"']/g, c => ({
+        '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'
+    })[c]);
+}
+
+// Format a byte count with binary units
+function formatBytes(bytes) {
+    const units = ['B', 'KiB', 'MiB', 'GiB', 'TiB', 'PiB'];
+    let i = 0;
+    while (bytes >= 1024 && i < units.length - 1) {
+        bytes /= 1024;
+        i++;
+    }
+    return `${bytes.toFixed(i === 0 ? 0 : 1)} ${units[i]}`;
+}
+
+// Format a percentage, flagging it when it is at or above 90%
+function formatUsage(percent) {
+    const text = `${percent.toFixed(1)}%`;
+    return percent >= 90 ? `<span class="usage-high">${text}</span>` : text;
+}
+
+// Fill a table body, or show a placeholder row when there are no rows
+function fillTable(id, rows, columns, render) {
+    const table = document.getElementById(id);
+    if (!rows || rows.length === 0) {
+        table.innerHTML = `<tr><td colspan="${columns}" class="text-center text-muted">Not available</td></tr>`;
+        return;
+    }
+    table.innerHTML = rows.map(render).join('');
+}
+
 // Update system stats every 5 seconds
 function updateSystemStats() {
     fetch('/api/system/stats')
@@ -5,13 +39,20 @@ function updateSystemStats() {
         .then(data => {
             document.getElementById('cpu-usage').textContent = `${data.CPUUsage.toFixed(1)}%`;
             document.getElementById('memory-usage').textContent = `${data.MemoryUsage.toFixed(1)}%`;
+            document.getElementById('load-average').textContent = data.LoadAverage.map(load => load.toFixed(2)).join('  ');
+            document.getElementById('cpu-wait').textContent = `${data.CPUTimes.IOWait.toFixed(1)}% / ${data.CPUTimes.Steal.toFixed(1)}%`;
+            document.getElementById('swap-usage').textContent = data.SwapTotal > 0
+                ? `${data.SwapUsage.toFixed(1)}% of ${formatBytes(data.SwapTotal)}`
+                : 'None';
+            document.getElementById('cpu-cores').innerHTML = (data.CPUCores || []).map((usage, core) =>
+                `<div style="height: ${Math.max(usage, 2)}%" title="CPU ${core}: ${usage.toFixed(1)}%"></div>`).join('');
             
             // Update processes table
             const processesTable = document.getElementById('processes-table');
-            processesTable.innerHTML = data.TopProcesses.map(process => `
+            processesTable.innerHTML = (data.TopProcesses || []).map(process => `
                 <tr>
                     <td>${process.PID}</td>
-                    <td>${process.Command}</td>
+                    <td>${escapeHTML(process.Command)}</td>
                     <td>${process.CPU.toFixed(1)}%</td>
                     <td>${process.Memory.toFixed(1)}%</td>
                     <td>
@@ -24,22 +65,207 @@ function updateSystemStats() {
             
             // Update ports table
             const portsTable = document.getElementById('ports-table');
-            portsTable.innerHTML = data.OpenPorts.map(port => `
+            portsTable.innerHTML = (data.OpenPorts || []).map(port => `
                 <tr>
-                    <td>${port.Protocol}</td>
-                    <td>${port.Local}</td>
-                    <td>${port.Remote}</td>
-                    <td>${port.State}</td>
+                    <td>${escapeHTML(port.protocol)}</td>
+                    <td>${escapeHTML(port.local)}</td>
+                    <td>${escapeHTML(port.remote)}</td>
+                    <td>${escapeHTML(port.state)}</td>
                 </tr>
             `).join('');
+
+            fillTable('filesystems-table', data.Filesystems, 6, fs => `
+                <tr>
+                    <td title="${escapeHTML(fs.Device)}">${escapeHTML(fs.Mount)}</td>
+                    <td>${escapeHTML(fs.Type)}</td>
+                    <td>${formatBytes(fs.Total)}</td>
+                    <td>${formatBytes(fs.Used)}</td>
+                    <td>${formatUsage(fs.Usage)}</td>
+                    <td>${fs.Inodes > 0 ? formatUsage(fs.InodeUsage) : '-'}</td>
+                </tr>
+            `);
+
+            fillTable('disks-table', data.Disks, 5, disk => `
+                <tr>
+                    <td>${escapeHTML(disk.Device)}</td>
+                    <td>${formatBytes(disk.ReadBytesPerSec)}</td>
+                    <td>${formatBytes(disk.WriteBytesPerSec)}</td>
+                    <td>${disk.ReadsPerSec.toFixed(1)} / ${disk.WritesPerSec.toFixed(1)}</td>
+                    <td>${formatUsage(disk.Busy)}</td>
+                </tr>
+            `);
+
+            fillTable('network-table', data.Network, 5, iface => `
+                <tr>
+                    <td>${escapeHTML(iface.Interface)}</td>
+                    <td>${formatBytes(iface.RxBytesPerSec)}</td>
+                    <td>${formatBytes(iface.TxBytesPerSec)}</td>
+                    <td>${iface.RxPacketsPerSec.toFixed(1)} / ${iface.TxPacketsPerSec.toFixed(1)}</td>
+                    <td>${iface.RxErrors + iface.TxErrors} / ${iface.RxDropped + iface.TxDropped}</td>
+                </tr>
+            `);
         })
         .catch(error => console.error('Error updating system stats:', error));
 }
 
+// Line colors for chart series
+const chartColors = ['#0d6efd', '#dc3545', '#198754', '#fd7e14', '#6f42c1'];
+
+// Draw series of {Time, Value} points as an SVG line chart. A sparkline has
+// no axes or legend. max fixes the top of the y axis, otherwise it fits the data.
+function renderChart(container, series, { max, sparkline = false } = {}) {
+    const points = series.flatMap(s => s.Points || []);
+    if (points.length === 0) {
+        container.innerHTML = sparkline ? '' : '<div class="empty">No samples yet</div>';
+        return;
+    }
+
+    const width = 600;
+    const height = sparkline ? 30 : 160;
+    const pad = sparkline ? { top: 2, right: 0, bottom: 2, left: 0 } : { top: 10, right: 10, bottom: 20, left: 40 };
+    const times = points.map(p => Date.parse(p.Time));
+    const t0 = Math.min(...times);
+    const t1 = Math.max(t0 + 1, ...times);
+    const top = max || Math.max(1, ...points.map(p => p.Value)) * 1.1;
+    const x = t => pad.left + (t - t0) / (t1 - t0) * (width - pad.left - pad.right);
+    const y = v => height - pad.bottom - Math.min(v, top) / top * (height - pad.top - pad.bottom);
+
+    let svg = `<svg viewBox="0 0 ${width} ${height}" preserveAspectRatio="none">`;
+    if (!sparkline) {
+        for (const fraction of [0, 0.5, 1]) {
+            const v = top * fraction;
+            svg += `<line class="grid" x1="${pad.left}" x2="${width - pad.right}" y1="${y(v)}" y2="${y(v)}"></line>`;
+            svg += `<text class="axis" x="${pad.left - 4}" y="${y(v) + 3}" text-anchor="end">${v.toFixed(v < 10 ? 1 : 0)}</text>`;
+        }
+        const label = t => new Date(t).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+        svg += `<text class="axis" x="${pad.left}" y="${height - 4}">${label(t0)}</text>`;
+        svg += `<text class="axis" x="${width - pad.right}" y="${height - 4}" text-anchor="end">${label(t1)}</text>`;
+    }
+    series.forEach((s, i) => {
+        const line = (s.Points || []).map(p => `${x(Date.parse(p.Time)).toFixed(1)},${y(p.Value).toFixed(1)}`).join(' ');
+        svg += `<polyline fill="none" stroke="${chartColors[i % chartColors.length]}" stroke-width="1.5" vector-effect="non-scaling-stroke" points="${line}"><title>${escapeHTML(s.Name)}</title></polyline>`;
+    });
+    svg += '</svg>';
+
+    if (!sparkline && series.length > 1) {
+        svg += '<div class="chart-legend">' + series.map((s, i) =>
+            `<span><i style="background:${chartColors[i % chartColors.length]}"></i>${escapeHTML(s.Name)}</span>`).join('') + '</div>';
+    }
+    container.innerHTML = svg;
+}
+
+function fetchHistory(metric, range) {
+    return fetch(`/api/system/history?metric=${metric}&range=${encodeURIComponent(range)}`)
+        .then(response => {
+            if (!response.ok) {
+                return response.text().then(text => { throw new Error(text); });
+            }
+            return response.json();
+        });
+}
+
+let historyRange = '1h';
+
+// Update the history charts and the stat card sparklines
+function updateHistory() {
+    const charts = [
+        ['cpu', 'cpu-chart', { max: 100 }],
+        ['memory', 'memory-chart', { max: 100 }],
+        ['load', 'load-chart', {}],
+        ['process', 'process-chart', {}],
+    ];
+    for (const [metric, id, options] of charts) {
+        fetchHistory(metric, historyRange)
+            .then(data => renderChart(document.getElementById(id), data.Series, options))
+            .catch(error => console.error(`Error updating ${metric} history:`, error));
+    }
+    for (const metric of ['cpu', 'memory']) {
+        fetchHistory(metric, '15m')
+            .then(data => renderChart(document.getElementById(`${metric}-sparkline`), data.Series, { max: 100, sparkline: true }))
+            .catch(error => console.error(`Error updating ${metric} sparkline:`, error));
+    }
+}
+
+document.querySelectorAll('#history-range button').forEach(button => {
+    button.addEventListener('click', function() {
+        document.querySelectorAll('#history-range button').forEach(b => b.classList.remove('active'));
+        this.classList.add('active');
+        historyRange = this.dataset.range;
+        updateHistory();
+    });
+});
+
+// Format a step's duration, or its error
+function formatStep(step, result) {
+    const time = `${step.Millis.toFixed(1)} ms`;
+    if (step.Error) {
+        return `<td class="usage-high">${escapeHTML(step.Error)}</td><td>${time}</td>`;
+    }
+    return `<td>${result}</td><td>${time}</td>`;
+}
+
+function renderDiagnostics(data) {
+    const summary = document.getElementById('diagnostics-summary');
+    summary.innerHTML = data.Error
+        ? `<span class="usage-high">${escapeHTML(data.Error)}</span>`
+        : `${escapeHTML(data.Target)} is ${escapeHTML((data.Addresses || []).join(', '))}`;
+
+    const checks = (data.TCP || []).map(tcp => `
+        <tr>
+            <td>TCP ${escapeHTML(tcp.Address)}</td>
+            ${formatStep(tcp, 'Open')}
+        </tr>
+    `);
+    if (data.HTTP) {
+        let result = escapeHTML(data.HTTP.Status);
+        if (data.HTTP.Location) {
+            result += ` &rarr; ${escapeHTML(data.HTTP.Location)}`;
+        }
+        if (data.HTTP.TLSVersion) {
+            result += `, ${escapeHTML(data.HTTP.TLSVersion)}, certificate expires ${new Date(data.HTTP.CertificateExpires).toLocaleDateString()}`;
+        }
+        checks.push(`
+            <tr>
+                <td>GET ${escapeHTML(data.HTTP.URL)}</td>
+                ${formatStep(data.HTTP, result)}
+            </tr>
+        `);
+    }
+    fillTable('reach-table', checks, 3, row => row);
+
+    const trace = data.Traceroute;
+    const hops = trace ? (trace.Hops || []) : [];
+    fillTable('trace-table', hops, 4, hop => `
+        <tr>
+            <td>${hop.TTL}</td>
+            <td>${hop.Address ? escapeHTML(hop.Address) : '*'}</td>
+            <td>${escapeHTML(hop.Host)}</td>
+            <td>${hop.Address ? `${hop.RTT.toFixed(1)} ms` : ''}</td>
+        </tr>
+    `);
+    if (trace && (trace.Error || !trace.Reached)) {
+        document.getElementById('trace-table').insertAdjacentHTML('beforeend',
+            `<tr><td colspan="4" class="text-muted">${escapeHTML(trace.Error || 'Not reached')}</td></tr>`);
+    }
+
+    const dns = data.DNS;
+    const records = dns.Error ? [] : (dns.Records || []);
+    fillTable('dns-table', records, 2, record => `
+        <tr>
+            <td>${escapeHTML(dns.Type)}</td>
+            <td>${escapeHTML(record)}</td>
+        </tr>
+    `);
+    if (dns.Error) {
+        document.getElementById('dns-table').innerHTML =
+            `<tr><td>${escapeHTML(dns.Type)}</td><td class="usage-high">${escapeHTML(dns.Error)}</td></tr>`;
+    }
+}
+
 // Handle network diagnostics form submission
 document.getElementById('network-form').addEventListener('submit', function(e) {
     e.preventDefault();
-    const target = document.getElementById('target-input').value;
+    const target = document.getElementById('target-input').value.trim();
     if (!target) return;
 
     // Show loading state
@@ -49,22 +275,29 @@ document.getElementById('network-form').addEventListener('submit', function(e) {
     submitButton.disabled = true;
 
     // Send request
+    const body = new URLSearchParams({
+        target: target,
+        type: document.getElementById('record-type').value,
+        ports: document.getElementById('ports-input').value,
+        scheme: document.getElementById('scheme-select').value,
+    });
     fetch('/api/network/diagnostics', {
         method: 'POST',
         headers: {
             'Content-Type': 'application/x-www-form-urlencoded',
         },
-        body: `target=${encodeURIComponent(target)}`
+        body: body.toString()
     })
-    .then(response => response.json())
-    .then(data => {
-        document.getElementById('ping-output').textContent = data.PingResults;
-        document.getElementById('mtr-output').textContent = data.MTRResults;
-        document.getElementById('dns-output').textContent = data.DNSResults;
+    .then(response => {
+        if (!response.ok) {
+            return response.text().then(text => { throw new Error(text.trim()); });
+        }
+        return response.json();
     })
+    .then(renderDiagnostics)
     .catch(error => {
         console.error('Error running network diagnostics:', error);
-        alert('Error running network diagnostics. Please try again.');
+        alert(`Error running network diagnostics: ${error.message}`);
     })
     .finally(() => {
         // Restore button state
@@ -73,29 +306,182 @@ document.getElementById('network-form').addEventListener('submit', function(e) {
     });
 });
 
+// Render a process and its descendants as nested lists
+function renderProcessTree(nodes) {
+    if (!nodes || nodes.length === 0) {
+        return '';
+    }
+    return '<ul>' + nodes.map(node =>
+        `<li>${node.PID} ${escapeHTML(node.Command)}${renderProcessTree(node.Children)}</li>`).join('') + '</ul>';
+}
+
+// The process shown in the modal
+let modalPID = null;
+
 // Show process details in modal
 function showProcessDetails(pid) {
     fetch(`/api/process/${pid}`)
-        .then(response => response.json())
+        .then(response => {
+            if (!response.ok) {
+                return response.text().then(text => { throw new Error(text); });
+            }
+            return response.json();
+        })
         .then(data => {
-            document.getElementById('ps-output').textContent = data.ps;
-            document.getElementById('lsof-output').textContent = data.lsof;
-            
+            modalPID = pid;
+            renderProcessDetails(data);
+
             // Show modal
-            const modal = new bootstrap.Modal(document.getElementById('processModal'));
+            const modal = bootstrap.Modal.getOrCreateInstance(document.getElementById('processModal'));
             modal.show();
         })
         .catch(error => {
             console.error('Error fetching process details:', error);
-            alert('Error fetching process details. Please try again.');
+            alert(`Error fetching process details: ${error.message}`);
+        });
+}
+
+function renderProcessDetails(data) {
+    const info = document.getElementById('process-info');
+    const actions = document.getElementById('process-actions');
+    const note = document.getElementById('process-actions-note');
+
+    // Without /proc the server sends the ps and lsof output instead
+    if (data.ps !== undefined) {
+        info.innerHTML = `<pre class="output-box">${escapeHTML(data.ps)}</pre><pre class="output-box">${escapeHTML(data.lsof)}</pre>`;
+        actions.style.display = 'none';
+        note.textContent = 'Process actions are only supported on Linux.';
+        ['process-tree', 'process-sockets', 'process-files', 'process-environment', 'process-cgroups']
+            .forEach(id => { document.getElementById(id).innerHTML = ''; });
+        return;
+    }
+
+    const io = data.IOPriority.Class === 'none' ? 'from nice' : `${data.IOPriority.Class} ${data.IOPriority.Level}`;
+    const rows = [
+        ['PID', data.PID],
+        ['Parent', data.PPID],
+        ['Command', data.Command],
+        ['Command line', (data.Cmdline || []).join(' ')],
+        ['State', data.State],
+        ['User', `${data.User} (${data.UID})`],
+        ['Nice', data.Nice],
+        ['I/O priority', io],
+        ['Threads', data.Threads],
+        ['Resident memory', formatBytes(data.RSS)],
+        ['Started', new Date(data.Started).toLocaleString()],
+    ];
+    info.innerHTML = '<table class="table table-sm">' +
+        rows.map(([name, value]) => `<tr><th>${name}</th><td>${escapeHTML(value)}</td></tr>`).join('') +
+        '</table>' +
+        (data.Errors || []).map(error => `<div class="text-muted small">Unavailable: ${escapeHTML(error)}</div>`).join('');
+
+    actions.style.display = data.ActionsAllowed ? '' : 'none';
+    note.textContent = data.ActionsAllowed
+        ? 'Each action asks for confirmation before it runs.'
+        : 'Actions are disabled: this process is not in the process_actions allow-list of the SystemHelper config.';
+    document.getElementById('nice-value').value = data.Nice;
+
+    // Parents are nearest first, so each wraps the tree built so far
+    let tree = `<strong>${data.PID} ${escapeHTML(data.Command)}</strong>${renderProcessTree(data.Children)}`;
+    tree = (data.Parents || []).reduce((inner, parent) => `${parent.PID} ${escapeHTML(parent.Command)}<ul><li>${inner}</li></ul>`, tree);
+    document.getElementById('process-tree').innerHTML = `<ul><li>${tree}</li></ul>`;
+
+    fillTable('process-sockets', data.Sockets, 5, socket => `
+        <tr>
+            <td>${socket.FD}</td>
+            <td>${escapeHTML(socket.Protocol)}</td>
+            <td>${escapeHTML(socket.State)}</td>
+            <td>${escapeHTML(socket.Local)}</td>
+            <td>${escapeHTML(socket.Remote)}</td>
+        </tr>
+    `);
+    const files = data.Files || [];
+    document.getElementById('process-files-title').textContent = files.length < data.FileCount
+        ? `Files (first ${files.length} of ${data.FileCount})`
+        : 'Files';
+    fillTable('process-files', files, 3, file => `
+        <tr>
+            <td>${file.FD}</td>
+            <td>${escapeHTML(file.Type)}</td>
+            <td>${escapeHTML(file.Target)}</td>
+        </tr>
+    `);
+    const environment = Object.entries(data.Environment || {}).sort(([a], [b]) => a.localeCompare(b));
+    fillTable('process-environment', environment, 2, ([name, value]) => `
+        <tr>
+            <th>${escapeHTML(name)}</th>
+            <td>${escapeHTML(value)}</td>
+        </tr>
+    `);
+    fillTable('process-cgroups', data.Cgroups, 3, cgroup => `
+        <tr>
+            <td>${cgroup.Hierarchy}</td>
+            <td>${escapeHTML((cgroup.Controllers || []).join(', '))}</td>
+            <td>${escapeHTML(cgroup.Path)}</td>
+        </tr>
+    `);
+}
+
+// Post a process action. The server answers the first request with a
+// confirmation token, which is sent back once the user agrees.
+function runProcessAction(action) {
+    const post = body => fetch(`/api/process/${modalPID}/actions`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(body),
+    }).then(response => response.json().then(data => {
+        if (!response.ok && response.status !== 202) {
+            throw new Error(data.Error || response.statusText);
+        }
+        return data;
+    }));
+
+    post(action)
+        .then(pending => {
+            if (!confirm(`Really ${pending.Summary}?`)) {
+                return null;
+            }
+            return post({ ...action, Token: pending.Token });
+        })
+        .then(result => {
+            if (!result) {
+                return;
+            }
+            // A terminated process has nothing left to show
+            if (action.Signal === 'TERM' || action.Signal === 'KILL') {
+                bootstrap.Modal.getOrCreateInstance(document.getElementById('processModal')).hide();
+                updateSystemStats();
+            } else {
+                showProcessDetails(modalPID);
+            }
+        })
+        .catch(error => {
+            console.error('Error running process action:', error);
+            alert(`Process action failed: ${error.message}`);
         });
 }
 
+document.querySelectorAll('#process-actions [data-signal]').forEach(button => {
+    button.addEventListener('click', () => runProcessAction({ Action: 'signal', Signal: button.dataset.signal }));
+});
+document.getElementById('renice-button').addEventListener('click', () => {
+    runProcessAction({ Action: 'renice', Nice: parseInt(document.getElementById('nice-value').value, 10) });
+});
+document.getElementById('ionice-button').addEventListener('click', () => {
+    runProcessAction({
+        Action: 'ionice',
+        Class: document.getElementById('io-class').value,
+        Level: parseInt(document.getElementById('io-level').value, 10),
+    });
+});
+
 // Initialize tooltips
 document.addEventListener('DOMContentLoaded', function() {
     // Start system stats updates
     updateSystemStats();
     setInterval(updateSystemStats, 5000);
+    updateHistory();
+    setInterval(updateHistory, 30000);
     
     // Initialize Bootstrap tooltips
     const tooltipTriggerList = [].slice.call(document.querySelectorAll('[data-bs-toggle="tooltip"]'));
@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"os/exec"
@@ -16,10 +19,76 @@ import (
 
 // SystemStats represents system statistics
 type SystemStats struct {
-	CPUUsage     float64
-	MemoryUsage  float64
+	Timestamp time.Time
+	CPUUsage  float64
+	// CPUTimes breaks CPUUsage down by state, and CPUCores gives it per core
+	CPUTimes    CPUTimes
+	CPUCores    []float64
+	MemoryUsage float64
+	// SwapUsage is a percentage; SwapTotal and SwapUsed are in bytes
+	SwapUsage float64
+	SwapTotal uint64
+	SwapUsed  uint64
+	// LoadAverage is the 1, 5 and 15 minute load average
+	LoadAverage  [3]float64
 	TopProcesses []ProcessInfo
 	OpenPorts    []PortInfo
+	Filesystems  []FilesystemInfo
+	Disks        []DiskInfo
+	Network      []NetworkInfo
+}
+
+// CPUTimes is the share of CPU time spent in each state, in percent
+type CPUTimes struct {
+	User    float64
+	Nice    float64
+	System  float64
+	Idle    float64
+	IOWait  float64
+	IRQ     float64
+	SoftIRQ float64
+	// Steal is time a hypervisor gave to other guests
+	Steal float64
+}
+
+// FilesystemInfo represents the usage of a mounted filesystem. Sizes are in
+// bytes; Usage is the share of the space available to users, as in df.
+type FilesystemInfo struct {
+	Mount      string
+	Device     string
+	Type       string
+	Total      uint64
+	Used       uint64
+	Available  uint64
+	Usage      float64
+	Inodes     uint64
+	InodesUsed uint64
+	InodeUsage float64
+}
+
+// DiskInfo represents the throughput of a block device
+type DiskInfo struct {
+	Device           string
+	ReadBytesPerSec  float64
+	WriteBytesPerSec float64
+	ReadsPerSec      float64
+	WritesPerSec     float64
+	// Busy is the share of time the device had I/O in flight
+	Busy float64
+}
+
+// NetworkInfo represents the throughput of a network interface. The error
+// and drop counts are totals since boot.
+type NetworkInfo struct {
+	Interface       string
+	RxBytesPerSec   float64
+	TxBytesPerSec   float64
+	RxPacketsPerSec float64
+	TxPacketsPerSec float64
+	RxErrors        uint64
+	TxErrors        uint64
+	RxDropped       uint64
+	TxDropped       uint64
 }
 
 // ProcessInfo represents process information
@@ -35,14 +104,9 @@ type PortInfo struct {
 	Port     int    `json:"port"`
 	Protocol string `json:"protocol"`
 	State    string `json:"state"`
-}
-
-// NetworkDiagnostics represents network test results
-type NetworkDiagnostics struct {
-	PingResults string
-	MTRResults  string
-	DNSResults  string
-	LastCheck   time.Time
+	// Local and Remote are the socket's address and peer as host:port
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
 }
 
 var (
@@ -50,9 +114,33 @@ var (
 	networkMutex     sync.RWMutex
 	currentStats     SystemStats
 	networkResults   NetworkDiagnostics
+	// diagnosticsConfig is set from the config file at startup
+	diagnosticsConfig = defaultConfig().Diagnostics
+	history           *History
 )
 
 func main() {
+	var config HistoryConfig
+	flag.DurationVar(&config.Resolution, "interval", 5*time.Second, "how often system stats are collected")
+	flag.DurationVar(&config.Retention, "history-retention", 6*time.Hour, "how long samples are kept at full resolution")
+	flag.DurationVar(&config.ArchiveResolution, "archive-resolution", time.Minute, "resolution of the downsampled history used for longer ranges")
+	flag.DurationVar(&config.ArchiveRetention, "archive-retention", 7*24*time.Hour, "how long downsampled history is kept")
+	flag.StringVar(&config.ArchivePath, "history-file", "", "file to keep the downsampled history in across restarts, default memory only")
+	configFile := flag.String("config", "", "YAML config file with the process_actions and diagnostics settings")
+	flag.Parse()
+
+	settings, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	processActionsConfig = settings.ProcessActions
+	diagnosticsConfig = settings.Diagnostics
+
+	if history, err = NewHistory(config); err != nil {
+		log.Fatal(err)
+	}
+	defer history.Close()
+
 	// Serve static files
 	fs := http.FileServer(http.Dir("static"))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
@@ -60,11 +148,12 @@ func main() {
 	// Handle routes
 	http.HandleFunc("/", handleHome)
 	http.HandleFunc("/api/system/stats", handleSystemStats)
+	http.HandleFunc("/api/system/history", handleSystemHistory)
 	http.HandleFunc("/api/network/diagnostics", handleNetworkDiagnostics)
 	http.HandleFunc("/api/process/", handleProcessInfo)
 
 	// Start background system stats collection
-	go collectSystemStats()
+	go collectSystemStats(config.Resolution)
 
 	fmt.Println("Starting SystemHelper server on :8081")
 	if err := http.ListenAndServe(":8081", nil); err != nil {
@@ -95,13 +184,21 @@ func handleSystemStats(w http.ResponseWriter, r *http.Request) {
 
 func handleNetworkDiagnostics(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
-		target := r.FormValue("target")
-		if target == "" {
-			http.Error(w, "Target is required", http.StatusBadRequest)
+		if !sameOrigin(r) {
+			http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+		req, err := parseDiagnosticsRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		results := runNetworkDiagnostics(target)
+		results, err := runNetworkDiagnostics(r.Context(), diagnosticsConfig, req)
+		if errors.Is(err, errTargetDenied) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		networkMutex.Lock()
 		networkResults = results
 		networkMutex.Unlock()
@@ -119,30 +216,72 @@ func handleNetworkDiagnostics(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleProcessInfo(w http.ResponseWriter, r *http.Request) {
-	pidStr := strings.TrimPrefix(r.URL.Path, "/api/process/")
+	pidStr, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/process/"), "/")
 	pid, err := strconv.Atoi(pidStr)
-	if err != nil {
+	if err != nil || pid <= 0 {
 		http.Error(w, "Invalid process ID", http.StatusBadRequest)
 		return
 	}
+	switch sub {
+	case "":
+	case "actions":
+		handleProcessAction(w, r, pid)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if runtime.GOOS != "linux" {
+		info := getProcessInfo(pid)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+		return
+	}
 
-	info := getProcessInfo(pid)
+	details, err := procStats.fs.readProcessDetails(pid)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, fmt.Sprintf("No process %d", pid), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if details.IOPriority, err = getIOPriority(pid); err != nil {
+		details.Errors = append(details.Errors, fmt.Sprintf("I/O priority: %v", err))
+	}
+	details.ActionsAllowed = processActionsConfig.allows(details.UID, details.User, details.Command)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(info)
+	json.NewEncoder(w).Encode(details)
 }
 
-func collectSystemStats() {
+func collectSystemStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
 		stats := getSystemStats()
 		systemStatsMutex.Lock()
 		currentStats = stats
 		systemStatsMutex.Unlock()
-		time.Sleep(5 * time.Second)
+		if err := history.Add(stats); err != nil {
+			log.Printf("Error recording history: %v", err)
+		}
+		<-ticker.C
 	}
 }
 
 func getSystemStats() SystemStats {
-	var stats SystemStats
+	// On Linux everything is read from /proc
+	if runtime.GOOS == "linux" {
+		stats, err := procStats.collect()
+		if err != nil {
+			log.Printf("Error collecting system stats: %v", err)
+		}
+		stats.Timestamp = time.Now()
+		return stats
+	}
+
+	stats := SystemStats{Timestamp: time.Now()}
 
 	// Get CPU usage
 	if runtime.GOOS == "darwin" {
@@ -150,10 +289,6 @@ func getSystemStats() SystemStats {
 		cmd := exec.Command("ps", "-A", "-o", "%cpu")
 		output, _ := cmd.Output()
 		stats.CPUUsage = parseCPUUsage(string(output))
-	} else if runtime.GOOS == "linux" {
-		cmd := exec.Command("top", "-bn1")
-		output, _ := cmd.Output()
-		stats.CPUUsage = parseCPUUsage(string(output))
 	}
 
 	// Get memory usage
@@ -162,10 +297,13 @@ func getSystemStats() SystemStats {
 		cmd := exec.Command("vm_stat")
 		output, _ := cmd.Output()
 		stats.MemoryUsage = parseMemoryUsage(string(output))
-	} else if runtime.GOOS == "linux" {
-		cmd := exec.Command("free")
+	}
+
+	// Get load average
+	if runtime.GOOS == "darwin" {
+		cmd := exec.Command("sysctl", "-n", "vm.loadavg")
 		output, _ := cmd.Output()
-		stats.MemoryUsage = parseMemoryUsage(string(output))
+		stats.LoadAverage = parseLoadAverageMacOS(string(output))
 	}
 
 	// Get top processes
@@ -173,10 +311,6 @@ func getSystemStats() SystemStats {
 		cmd := exec.Command("ps", "-A", "-o", "pid,command,%cpu,%mem", "-r")
 		output, _ := cmd.Output()
 		stats.TopProcesses = parseTopProcessesMacOS(string(output))
-	} else if runtime.GOOS == "linux" {
-		cmd := exec.Command("ps", "-eo", "pid,comm,%cpu,%mem", "--sort=-%cpu")
-		output, _ := cmd.Output()
-		stats.TopProcesses = parseTopProcessesLinux(string(output))
 	}
 
 	// Get open ports
@@ -184,37 +318,11 @@ func getSystemStats() SystemStats {
 		cmd := exec.Command("netstat", "-anv", "-p", "tcp,udp")
 		output, _ := cmd.Output()
 		stats.OpenPorts = parseOpenPortsMacOS(string(output))
-	} else if runtime.GOOS == "linux" {
-		cmd := exec.Command("netstat", "-tuln")
-		output, _ := cmd.Output()
-		stats.OpenPorts = parseOpenPortsLinux(string(output))
 	}
 
 	return stats
 }
 
-func runNetworkDiagnostics(target string) NetworkDiagnostics {
-	var results NetworkDiagnostics
-
-	// Run ping
-	pingCmd := exec.Command("ping", "-c", "4", target)
-	pingOutput, _ := pingCmd.Output()
-	results.PingResults = string(pingOutput)
-
-	// Run MTR if available
-	mtrCmd := exec.Command("mtr", "--report", target)
-	mtrOutput, _ := mtrCmd.Output()
-	results.MTRResults = string(mtrOutput)
-
-	// Run DNS lookup
-	dnsCmd := exec.Command("dig", target)
-	dnsOutput, _ := dnsCmd.Output()
-	results.DNSResults = string(dnsOutput)
-
-	results.LastCheck = time.Now()
-	return results
-}
-
 func getProcessInfo(pid int) map[string]interface{} {
 	info := make(map[string]interface{})
 
@@ -231,38 +339,6 @@ func getProcessInfo(pid int) map[string]interface{} {
 	return info
 }
 
-func getTopProcesses() []ProcessInfo {
-	var processes []ProcessInfo
-
-	if runtime.GOOS == "linux" {
-		cmd := exec.Command("ps", "-eo", "pid,comm,%cpu,%mem", "--sort=-%cpu")
-		output, _ := cmd.Output()
-		processes = parseTopProcessesLinux(string(output))
-	} else {
-		cmd := exec.Command("ps", "-A", "-o", "pid,command,%cpu,%mem", "-r")
-		output, _ := cmd.Output()
-		processes = parseTopProcessesMacOS(string(output))
-	}
-
-	return processes
-}
-
-func getOpenPorts() []PortInfo {
-	var ports []PortInfo
-
-	if runtime.GOOS == "linux" {
-		cmd := exec.Command("netstat", "-tuln")
-		output, _ := cmd.Output()
-		ports = parseOpenPortsLinux(string(output))
-	} else {
-		cmd := exec.Command("netstat", "-an")
-		output, _ := cmd.Output()
-		ports = parseOpenPortsMacOS(string(output))
-	}
-
-	return ports
-}
-
 // Helper functions for parsing command outputs
 func parseCPUUsage(output string) float64 {
 	if runtime.GOOS == "darwin" {
@@ -287,7 +363,7 @@ func parseCPUUsage(output string) float64 {
 		}
 		return totalCPU
 	}
-	return 0.0 // Placeholder for other OS
+	return 0.0 // Linux is read from /proc instead
 }
 
 func parseMemoryUsage(output string) float64 {
@@ -333,9 +409,14 @@ func parseMemoryUsage(output string) float64 {
 	return 0.0
 }
 
-func parseTopProcessesLinux(output string) []ProcessInfo {
-	// Implement Linux process parsing
-	return []ProcessInfo{}
+// parseLoadAverageMacOS parses `sysctl -n vm.loadavg`, e.g. "{ 1.52 1.61 1.70 }"
+func parseLoadAverageMacOS(output string) [3]float64 {
+	var load [3]float64
+	fields := strings.Fields(strings.Trim(strings.TrimSpace(output), "{}"))
+	for i := 0; i < len(load) && i < len(fields); i++ {
+		load[i], _ = strconv.ParseFloat(fields[i], 64)
+	}
+	return load
 }
 
 func parseTopProcessesMacOS(output string) []ProcessInfo {
@@ -383,11 +464,6 @@ func parseTopProcessesMacOS(output string) []ProcessInfo {
 	return processes
 }
 
-func parseOpenPortsLinux(output string) []PortInfo {
-	// Implement Linux port parsing
-	return []PortInfo{}
-}
-
 func parseOpenPortsMacOS(output string) []PortInfo {
 	var ports []PortInfo
 	lines := strings.Split(output, "\n")
@@ -404,6 +480,10 @@ func parseOpenPortsMacOS(output string) []PortInfo {
 
 		proto := fields[0]
 		localAddr := fields[3]
+		var remoteAddr string
+		if len(fields) > 4 {
+			remoteAddr = fields[4]
+		}
 
 		// Extract port number
 		var port int
@@ -424,6 +504,8 @@ func parseOpenPortsMacOS(output string) []PortInfo {
 				Port:     port,
 				Protocol: proto,
 				State:    "LISTEN",
+				Local:    localAddr,
+				Remote:   remoteAddr,
 			})
 		}
 	}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// TracerouteResult is the path to an address, one hop per TTL
+type TracerouteResult struct {
+	DiagnosticStep
+	Address string
+	Hops    []TracerouteHop
+	// Reached reports whether the address answered within tracerouteMaxHops
+	Reached bool
+}
+
+// TracerouteHop is the router that answered the probe with this TTL. A hop
+// that did not answer in time has no address.
+type TracerouteHop struct {
+	TTL     int
+	Address string `json:",omitempty"`
+	Host    string `json:",omitempty"`
+	// RTT is the round trip in milliseconds
+	RTT float64 `json:",omitempty"`
+}
+
+const (
+	tracerouteMaxHops    = 30
+	tracerouteHopTimeout = time.Second
+	// tracerouteNameTimeout bounds the reverse lookups of the hops
+	tracerouteNameTimeout = 2 * time.Second
+)
+
+var tracerouteSequence uint32
+
+// tracerouteProtocol holds what differs between ICMP and ICMPv6
+type tracerouteProtocol struct {
+	network   string
+	listen    string
+	number    int
+	echo      icmp.Type
+	echoReply icmp.Type
+	// echoType is the echo request's type byte, as quoted in errors
+	echoType   byte
+	headerSize func(packet []byte) int
+	setTTL     func(conn *icmp.PacketConn, ttl int) error
+}
+
+var (
+	traceroute4 = tracerouteProtocol{
+		network:   "ip4:icmp",
+		listen:    "0.0.0.0",
+		number:    1,
+		echo:      ipv4.ICMPTypeEcho,
+		echoReply: ipv4.ICMPTypeEchoReply,
+		echoType:  byte(ipv4.ICMPTypeEcho),
+		headerSize: func(packet []byte) int {
+			return int(packet[0]&0x0f) * 4
+		},
+		setTTL: func(conn *icmp.PacketConn, ttl int) error {
+			return conn.IPv4PacketConn().SetTTL(ttl)
+		},
+	}
+	traceroute6 = tracerouteProtocol{
+		network:   "ip6:ipv6-icmp",
+		listen:    "::",
+		number:    58,
+		echo:      ipv6.ICMPTypeEchoRequest,
+		echoReply: ipv6.ICMPTypeEchoReply,
+		echoType:  byte(ipv6.ICMPTypeEchoRequest),
+		headerSize: func([]byte) int {
+			return ipv6.HeaderLen
+		},
+		setTTL: func(conn *icmp.PacketConn, ttl int) error {
+			return conn.IPv6PacketConn().SetHopLimit(ttl)
+		},
+	}
+)
+
+// traceroute sends ICMP echo requests with increasing TTLs and records the
+// routers that report them expired, until the address itself answers. It
+// needs a raw socket, so root or CAP_NET_RAW.
+func traceroute(ctx context.Context, ip net.IP) TracerouteResult {
+	start := time.Now()
+	result := TracerouteResult{Address: ip.String()}
+	err := runTraceroute(ctx, ip, &result)
+	nameHops(ctx, result.Hops)
+	result.finish(start, err)
+	return result
+}
+
+func runTraceroute(ctx context.Context, ip net.IP, result *TracerouteResult) error {
+	protocol := traceroute6
+	if ip.To4() != nil {
+		protocol = traceroute4
+	}
+	conn, err := icmp.ListenPacket(protocol.network, protocol.listen)
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("traceroute needs root or CAP_NET_RAW: %v", err)
+	} else if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Wake a blocked read when the step times out
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	id := os.Getpid() & 0xffff
+	dst := &net.IPAddr{IP: ip}
+	buf := make([]byte, 1500)
+	for ttl := 1; ttl <= tracerouteMaxHops; ttl++ {
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after %d hops", ttl-1)
+		}
+		if err := protocol.setTTL(conn, ttl); err != nil {
+			return err
+		}
+		seq := int(atomic.AddUint32(&tracerouteSequence, 1) & 0xffff)
+		message := icmp.Message{
+			Type: protocol.echo,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("systemhelper")},
+		}
+		packet, err := message.Marshal(nil)
+		if err != nil {
+			return err
+		}
+
+		sent := time.Now()
+		if _, err := conn.WriteTo(packet, dst); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(sent.Add(tracerouteHopTimeout))
+		hop := TracerouteHop{TTL: ttl}
+		reached, unreachable := false, false
+		for hop.Address == "" {
+			n, peer, err := conn.ReadFrom(buf)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			} else if err != nil {
+				return err
+			}
+			reply, err := icmp.ParseMessage(protocol.number, buf[:n])
+			if err != nil {
+				continue
+			}
+			switch body := reply.Body.(type) {
+			case *icmp.Echo:
+				if reply.Type != protocol.echoReply || body.ID != id || body.Seq != seq {
+					continue
+				}
+				reached = true
+			case *icmp.TimeExceeded:
+				if !protocol.quotes(body.Data, id, seq) {
+					continue
+				}
+			case *icmp.DstUnreach:
+				if !protocol.quotes(body.Data, id, seq) {
+					continue
+				}
+				// The path ends here, whether at the address or before it
+				reached = peer.String() == ip.String()
+				unreachable = !reached
+			default:
+				continue
+			}
+			hop.Address = peer.String()
+			hop.RTT = float64(time.Since(sent)) / float64(time.Millisecond)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after %d hops", ttl-1)
+		}
+		result.Hops = append(result.Hops, hop)
+		if reached {
+			result.Reached = true
+			return nil
+		}
+		if unreachable {
+			return fmt.Errorf("%s reported the address unreachable", hop.Address)
+		}
+	}
+	return nil
+}
+
+// quotes reports whether an ICMP error carries our echo request. Errors
+// quote the IP header and the start of the packet that caused them.
+func (p tracerouteProtocol) quotes(data []byte, id, seq int) bool {
+	if len(data) == 0 {
+		return false
+	}
+	header := p.headerSize(data)
+	if len(data) < header+8 {
+		return false
+	}
+	echo := data[header:]
+	return echo[0] == p.echoType &&
+		int(binary.BigEndian.Uint16(echo[4:6])) == id && int(binary.BigEndian.Uint16(echo[6:8])) == seq
+}
+
+// nameHops looks up the hosts of the hops side by side
+func nameHops(ctx context.Context, hops []TracerouteHop) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tracerouteNameTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := range hops {
+		if hops[i].Address == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(hop *TracerouteHop) {
+			defer wg.Done()
+			if names, err := resolver.LookupAddr(ctx, hop.Address); err == nil && len(names) > 0 {
+				hop.Host = names[0]
+			}
+		}(&hops[i])
+	}
+	wg.Wait()
+}
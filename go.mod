@@ -1,3 +1,11 @@
 module github.com/haarithd/number_operations
 
-go 1.21 
\ No newline at end of file
+go 1.21
+
+require (
+	golang.org/x/crypto v0.31.0
+	golang.org/x/net v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.28.0 // indirect
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role decides what a user may do on the dashboard
+type Role string
+
+const (
+	// RoleViewer can see status, history and incidents
+	RoleViewer Role = "viewer"
+	// RoleAdmin can also trigger refreshes and acknowledge incidents
+	RoleAdmin Role = "admin"
+)
+
+// Auth modes
+const (
+	authNone  = ""
+	authBasic = "basic"
+	authProxy = "proxy"
+)
+
+// AuthConfig protects the dashboard. With no mode set everyone is an admin,
+// as before authentication existed.
+type AuthConfig struct {
+	// Mode is empty, basic or proxy
+	Mode string `yaml:"mode"`
+	// Realm is shown by the browser's basic auth prompt
+	Realm string `yaml:"realm"`
+	// Users are the basic auth accounts
+	Users []AuthUser `yaml:"users"`
+	// Proxy configures trust in a reverse proxy that has already
+	// authenticated the user
+	Proxy ProxyAuthConfig `yaml:"proxy"`
+}
+
+// AuthUser is a basic auth account. Create the hash with
+// `hyperscaler hash-password`.
+type AuthUser struct {
+	Name         string `yaml:"name"`
+	PasswordHash string `yaml:"password_hash"`
+	Role         Role   `yaml:"role"`
+}
+
+// ProxyAuthConfig reads the user and groups from headers set by a reverse
+// proxy. Requests from addresses outside TrustedProxies are rejected, so
+// the headers cannot be forged by connecting directly.
+type ProxyAuthConfig struct {
+	UserHeader   string `yaml:"user_header"`
+	GroupsHeader string `yaml:"groups_header"`
+	// AdminUsers and AdminGroups get the admin role; everyone else is a viewer
+	AdminUsers     []string `yaml:"admin_users"`
+	AdminGroups    []string `yaml:"admin_groups"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	trusted []*net.IPNet
+}
+
+// defaultAuthConfig leaves the dashboard open
+func defaultAuthConfig() AuthConfig {
+	return AuthConfig{
+		Realm: "hyperscaler",
+		Proxy: ProxyAuthConfig{
+			UserHeader:     "X-Forwarded-User",
+			GroupsHeader:   "X-Forwarded-Groups",
+			TrustedProxies: []string{"127.0.0.1/32", "::1/128"},
+		},
+	}
+}
+
+func (c *AuthConfig) validate() error {
+	switch c.Mode {
+	case authNone:
+	case authBasic:
+		if len(c.Users) == 0 {
+			return fmt.Errorf("auth.users is required for basic auth")
+		}
+		seen := make(map[string]bool)
+		for _, user := range c.Users {
+			if user.Name == "" {
+				return fmt.Errorf("auth.users: user without a name")
+			}
+			if seen[user.Name] {
+				return fmt.Errorf("auth.users: user %q is declared twice", user.Name)
+			}
+			seen[user.Name] = true
+			if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+				return fmt.Errorf("auth.users: user %q: password_hash is not a bcrypt hash", user.Name)
+			}
+			if user.Role != RoleViewer && user.Role != RoleAdmin {
+				return fmt.Errorf("auth.users: user %q: role must be viewer or admin", user.Name)
+			}
+		}
+	case authProxy:
+		if c.Proxy.UserHeader == "" {
+			return fmt.Errorf("auth.proxy.user_header is required for proxy auth")
+		}
+		c.Proxy.trusted = nil
+		for _, cidr := range c.Proxy.TrustedProxies {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("auth.proxy.trusted_proxies: %v", err)
+			}
+			c.Proxy.trusted = append(c.Proxy.trusted, network)
+		}
+	default:
+		return fmt.Errorf("auth.mode must be basic or proxy, got %q", c.Mode)
+	}
+	return nil
+}
+
+// Principal is the user making a request
+type Principal struct {
+	Name string
+	Role Role
+}
+
+// Admin reports whether the user may change state
+func (p Principal) Admin() bool {
+	return p.Role == RoleAdmin
+}
+
+type principalKey struct{}
+
+// requestPrincipal returns the user authenticated by withAuth
+func requestPrincipal(r *http.Request) Principal {
+	if principal, ok := r.Context().Value(principalKey{}).(Principal); ok {
+		return principal
+	}
+	return Principal{Role: RoleViewer}
+}
+
+// dummyHash is compared against when the user does not exist, so unknown
+// and known users take the same time to reject
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("hyperscaler"), bcrypt.DefaultCost)
+
+// authenticate identifies the user behind a request. It returns the HTTP
+// status to reply with when the request is not authenticated.
+func (c AuthConfig) authenticate(r *http.Request) (Principal, int, error) {
+	switch c.Mode {
+	case authBasic:
+		name, password, ok := r.BasicAuth()
+		if !ok {
+			return Principal{}, http.StatusUnauthorized, fmt.Errorf("authentication required")
+		}
+		var found *AuthUser
+		hash := dummyHash
+		for i, user := range c.Users {
+			if subtle.ConstantTimeCompare([]byte(user.Name), []byte(name)) == 1 {
+				found, hash = &c.Users[i], []byte(user.PasswordHash)
+			}
+		}
+		if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || found == nil {
+			return Principal{}, http.StatusUnauthorized, fmt.Errorf("invalid username or password")
+		}
+		return Principal{Name: found.Name, Role: found.Role}, 0, nil
+
+	case authProxy:
+		if !c.Proxy.trusts(r.RemoteAddr) {
+			return Principal{}, http.StatusForbidden, fmt.Errorf("request did not come through a trusted proxy")
+		}
+		name := strings.TrimSpace(r.Header.Get(c.Proxy.UserHeader))
+		if name == "" {
+			return Principal{}, http.StatusUnauthorized, fmt.Errorf("missing %s header", c.Proxy.UserHeader)
+		}
+		principal := Principal{Name: name, Role: RoleViewer}
+		if containsFold(c.Proxy.AdminUsers, name) {
+			principal.Role = RoleAdmin
+		}
+		if c.Proxy.GroupsHeader != "" {
+			for _, group := range strings.Split(r.Header.Get(c.Proxy.GroupsHeader), ",") {
+				if containsFold(c.Proxy.AdminGroups, strings.TrimSpace(group)) {
+					principal.Role = RoleAdmin
+				}
+			}
+		}
+		return principal, 0, nil
+	}
+	return Principal{Role: RoleAdmin}, 0, nil
+}
+
+func (c ProxyAuthConfig) trusts(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range c.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// currentAuth returns the auth settings in effect
+func currentAuth() AuthConfig {
+	if config := currentConfig(); config != nil {
+		return config.Auth
+	}
+	return defaultAuthConfig()
+}
+
+// withAuth authenticates every request before passing it on. The settings
+// are read per request, so a SIGHUP reload applies immediately.
+func withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := currentAuth()
+		principal, status, err := auth.authenticate(r)
+		if err != nil {
+			if status == http.StatusUnauthorized && auth.Mode == authBasic {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", auth.Realm))
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// requireAdmin allows only POSTs by admins. Cross-origin POSTs are rejected,
+// since browsers send basic auth credentials with them automatically.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+		if !requestPrincipal(r).Admin() {
+			http.Error(w, "admin role required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// sameOrigin reports whether the request's Origin, when present, is the
+// host it was sent to
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// runHashPassword implements `hyperscaler hash-password`: it reads a
+// password from stdin and prints its bcrypt hash for auth.users
+func runHashPassword(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hyperscaler hash-password < password.txt")
+		return 2
+	}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Password: ")
+	}
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		log.Printf("Error reading password: %v", err)
+		return 1
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "hash-password: empty password")
+		return 1
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hash-password: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(hash))
+	return 0
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// useAuth puts the auth settings in effect for the duration of the test
+func useAuth(t *testing.T, auth AuthConfig) {
+	t.Helper()
+	restoreGlobals(t)
+	if err := auth.validate(); err != nil {
+		t.Fatal(err)
+	}
+	configMutex.Lock()
+	activeConfig = &Config{Auth: auth}
+	configMutex.Unlock()
+}
+
+// authHandler serves a viewer page at / and an admin action at /refresh
+func authHandler() http.Handler {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(requestPrincipal(r).Name)) }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", ok)
+	mux.HandleFunc("/refresh", requireAdmin(ok))
+	return withAuth(mux)
+}
+
+type authRequest struct {
+	name       string
+	method     string
+	path       string
+	remoteAddr string
+	headers    map[string]string
+	user       string
+	password   string
+	wantStatus int
+}
+
+func (test authRequest) run(t *testing.T, handler http.Handler) {
+	t.Helper()
+	r := httptest.NewRequest(test.method, "http://dashboard.example.com"+test.path, nil)
+	if test.remoteAddr != "" {
+		r.RemoteAddr = test.remoteAddr
+	}
+	for name, value := range test.headers {
+		r.Header.Set(name, value)
+	}
+	if test.user != "" {
+		r.SetBasicAuth(test.user, test.password)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != test.wantStatus {
+		t.Errorf("%s: status %d, want %d (%s)", test.name, w.Code, test.wantStatus, w.Body.String())
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash := func(password string) string {
+		h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(h)
+	}
+	auth := defaultAuthConfig()
+	auth.Mode = authBasic
+	auth.Users = []AuthUser{
+		{Name: "alice", PasswordHash: hash("alice-secret"), Role: RoleAdmin},
+		{Name: "bob", PasswordHash: hash("bob-secret"), Role: RoleViewer},
+	}
+	useAuth(t, auth)
+	handler := authHandler()
+
+	tests := []authRequest{
+		{name: "anonymous", method: "GET", path: "/", wantStatus: http.StatusUnauthorized},
+		{name: "anonymous refresh", method: "POST", path: "/refresh", wantStatus: http.StatusUnauthorized},
+		{name: "wrong password", method: "GET", path: "/", user: "alice", password: "bob-secret", wantStatus: http.StatusUnauthorized},
+		{name: "unknown user", method: "GET", path: "/", user: "mallory", password: "alice-secret", wantStatus: http.StatusUnauthorized},
+		// Proxy headers mean nothing unless proxy auth is on
+		{name: "proxy header", method: "POST", path: "/refresh", remoteAddr: "127.0.0.1:4321",
+			headers: map[string]string{"X-Forwarded-User": "alice"}, wantStatus: http.StatusUnauthorized},
+		{name: "viewer", method: "GET", path: "/", user: "bob", password: "bob-secret", wantStatus: http.StatusOK},
+		{name: "viewer refresh", method: "POST", path: "/refresh", user: "bob", password: "bob-secret", wantStatus: http.StatusForbidden},
+		{name: "admin refresh", method: "POST", path: "/refresh", user: "alice", password: "alice-secret", wantStatus: http.StatusOK},
+		{name: "admin GET refresh", method: "GET", path: "/refresh", user: "alice", password: "alice-secret", wantStatus: http.StatusMethodNotAllowed},
+		{name: "cross-origin refresh", method: "POST", path: "/refresh", user: "alice", password: "alice-secret",
+			headers: map[string]string{"Origin": "https://evil.example.com"}, wantStatus: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		test.run(t, handler)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("WWW-Authenticate"); got != `Basic realm="hyperscaler", charset="UTF-8"` {
+		t.Errorf("WWW-Authenticate %q", got)
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	auth := defaultAuthConfig()
+	auth.Mode = authProxy
+	auth.Proxy.AdminUsers = []string{"alice"}
+	auth.Proxy.AdminGroups = []string{"sre"}
+	useAuth(t, auth)
+	handler := authHandler()
+
+	proxied := func(user, groups string) map[string]string {
+		return map[string]string{"X-Forwarded-User": user, "X-Forwarded-Groups": groups}
+	}
+	tests := []authRequest{
+		{name: "no user header", method: "GET", path: "/", remoteAddr: "127.0.0.1:4321", wantStatus: http.StatusUnauthorized},
+		{name: "untrusted proxy", method: "POST", path: "/refresh", remoteAddr: "192.0.2.10:4321",
+			headers: proxied("alice", ""), wantStatus: http.StatusForbidden},
+		{name: "viewer", method: "GET", path: "/", remoteAddr: "127.0.0.1:4321", headers: proxied("bob", "dev"), wantStatus: http.StatusOK},
+		{name: "viewer refresh", method: "POST", path: "/refresh", remoteAddr: "127.0.0.1:4321",
+			headers: proxied("bob", "dev"), wantStatus: http.StatusForbidden},
+		{name: "admin user", method: "POST", path: "/refresh", remoteAddr: "[::1]:4321", headers: proxied("Alice", ""), wantStatus: http.StatusOK},
+		{name: "admin group", method: "POST", path: "/refresh", remoteAddr: "127.0.0.1:4321",
+			headers: proxied("carol", "dev, SRE"), wantStatus: http.StatusOK},
+	}
+	for _, test := range tests {
+		test.run(t, handler)
+	}
+}
+
+func TestNoAuthMakesEveryoneAdmin(t *testing.T) {
+	useAuth(t, defaultAuthConfig())
+	authRequest{name: "anonymous refresh", method: "POST", path: "/refresh", wantStatus: http.StatusOK}.run(t, authHandler())
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Exit codes of the check subcommand
+const (
+	checkPassed = 0
+	// checkFailed means a selected service is at or above the threshold
+	checkFailed = 1
+	// checkError means bad flags or config, or that a selected provider
+	// could not be checked while -fail-on-unknown is set
+	checkError = 2
+)
+
+// CheckOutcome is the result of `hyperscaler check`, and its JSON output
+type CheckOutcome struct {
+	Timestamp time.Time
+	Threshold Status
+	Passed    bool
+	// Failures are the selected services at or above the threshold
+	Failures []Service
+	// Unchecked are the selected providers whose check failed
+	Unchecked []CheckResult `json:",omitempty"`
+	Report    StatusReport
+}
+
+// checkOptions are the flags specific to the check subcommand
+type checkOptions struct {
+	format    string
+	output    string
+	providers string
+	regions   string
+	failOn    string
+	// failOnUnknown fails the check when a provider cannot be checked, so
+	// an unreachable feed cannot pass the gate
+	failOnUnknown bool
+	probes        bool
+}
+
+// runCheck implements `hyperscaler check`: it generates one report, writes
+// it as text, JSON or JUnit XML and returns the process exit code
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: hyperscaler check [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Generates one report and exits with %d when every selected service is below\n", checkPassed)
+		fmt.Fprintf(fs.Output(), "the -fail-on status, %d when one is at or above it and %d on errors, including\n", checkFailed, checkError)
+		fmt.Fprintf(fs.Output(), "a provider that could not be checked unless -fail-on-unknown=false.\n\n")
+		fs.PrintDefaults()
+	}
+	flags := newCLIFlags(fs, false)
+	var opts checkOptions
+	fs.StringVar(&opts.format, "format", "text", "output format: text, json or junit")
+	fs.StringVar(&opts.output, "output", "", "file to write the output to, default stdout")
+	fs.StringVar(&opts.providers, "providers", "", "comma-separated providers to check, default all")
+	fs.StringVar(&opts.regions, "regions", "", "comma-separated regions that count toward the threshold, wildcards allowed, default all")
+	fs.StringVar(&opts.failOn, "fail-on", "major_outage", "fail when a selected service reaches this status")
+	fs.BoolVar(&opts.failOnUnknown, "fail-on-unknown", true, "exit with an error when a selected provider cannot be checked")
+	fs.BoolVar(&opts.probes, "probes", false, "run one round of network probes before the report")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return checkPassed
+		}
+		return checkError
+	}
+	flags.visit(fs)
+
+	outcome, err := check(flags, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hyperscaler check: %v\n", err)
+		return checkError
+	}
+
+	out := io.Writer(os.Stdout)
+	if opts.output != "" {
+		file, err := os.Create(opts.output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hyperscaler check: %v\n", err)
+			return checkError
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := writeCheckOutcome(out, opts.format, outcome); err != nil {
+		fmt.Fprintf(os.Stderr, "hyperscaler check: %v\n", err)
+		return checkError
+	}
+
+	switch {
+	case len(outcome.Unchecked) > 0 && opts.failOnUnknown:
+		return checkError
+	case !outcome.Passed:
+		return checkFailed
+	}
+	return checkPassed
+}
+
+// check loads the config, runs the selected providers once and compares
+// every selected service with the threshold
+func check(flags *cliFlags, opts checkOptions) (CheckOutcome, error) {
+	switch opts.format {
+	case "text", "json", "junit":
+	default:
+		return CheckOutcome{}, fmt.Errorf("unknown format %q", opts.format)
+	}
+	threshold, err := ParseStatus(opts.failOn)
+	if err != nil {
+		return CheckOutcome{}, fmt.Errorf("invalid -fail-on: %v", err)
+	}
+	config, err := loadConfig(flags)
+	if err != nil {
+		return CheckOutcome{}, err
+	}
+	if config.Providers, err = selectProviders(config.Providers, splitList(opts.providers)); err != nil {
+		return CheckOutcome{}, err
+	}
+	regions := splitList(opts.regions)
+
+	// Ctrl+C aborts the checks instead of killing the process mid-write
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	applyConfig(config)
+	if opts.probes {
+		probes.round(ctx)
+	}
+	report := generateReport(ctx)
+	if ctx.Err() != nil {
+		return CheckOutcome{}, fmt.Errorf("interrupted")
+	}
+
+	outcome := CheckOutcome{
+		Timestamp: report.Timestamp,
+		Threshold: threshold,
+		Passed:    true,
+		Report:    report,
+	}
+	for _, result := range report.Checks {
+		if result.Error != "" {
+			outcome.Unchecked = append(outcome.Unchecked, result)
+			if opts.failOnUnknown {
+				outcome.Passed = false
+			}
+		}
+	}
+	for _, provider := range report.Providers {
+		for _, service := range provider.Services {
+			if checkSelected(service, regions) && service.Status.Severity() >= threshold.Severity() {
+				outcome.Failures = append(outcome.Failures, service)
+				outcome.Passed = false
+			}
+		}
+	}
+	return outcome, nil
+}
+
+// selectProviders keeps the named providers, case-insensitively. A name
+// that is not configured is an error, so a typo cannot pass a gate.
+func selectProviders(providers []ProviderConfig, names []string) ([]ProviderConfig, error) {
+	if len(names) == 0 {
+		return providers, nil
+	}
+	var selected []ProviderConfig
+	for _, name := range names {
+		found := false
+		for _, provider := range providers {
+			if strings.EqualFold(provider.Name, name) {
+				if provider.Disabled {
+					return nil, fmt.Errorf("provider %q is disabled", provider.Name)
+				}
+				selected = append(selected, provider)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown provider %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// checkSelected reports whether a service row counts toward the threshold.
+// Rows for the Global region count for every region.
+func checkSelected(service Service, regions []string) bool {
+	if len(regions) == 0 || service.Region == "Global" {
+		return true
+	}
+	for _, region := range regions {
+		if matchField(region, service.Region) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func writeCheckOutcome(w io.Writer, format string, outcome CheckOutcome) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(outcome)
+	case "junit":
+		return writeJUnit(w, outcome)
+	}
+
+	var b strings.Builder
+	b.WriteString(outcome.Report.Content)
+	if len(outcome.Unchecked) > 0 {
+		fmt.Fprintf(&b, "\nCould not check %d provider(s):\n", len(outcome.Unchecked))
+		for _, result := range outcome.Unchecked {
+			fmt.Fprintf(&b, "- %s: %s\n", result.Provider, result.Error)
+		}
+	}
+	switch {
+	case outcome.Passed:
+		fmt.Fprintf(&b, "\nCheck passed: no selected service at or above %s\n", outcome.Threshold.Label())
+	case len(outcome.Failures) > 0:
+		fmt.Fprintf(&b, "\nCheck failed: %d selected service(s) at or above %s\n", len(outcome.Failures), outcome.Threshold.Label())
+		for _, service := range outcome.Failures {
+			fmt.Fprintf(&b, "- %s %s (%s): %s\n", service.Provider, service.Name, service.Region, service.Status.Label())
+		}
+	default:
+		fmt.Fprintf(&b, "\nCheck failed: the status of %d provider(s) could not be confirmed\n", len(outcome.Unchecked))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes one test suite per provider and one test case per
+// service; the cases in outcome.Failures are marked failed. The UNKNOWN row
+// of a provider that could not be checked is marked as an error.
+func writeJUnit(w io.Writer, outcome CheckOutcome) error {
+	failed := make(map[string]bool)
+	for _, service := range outcome.Failures {
+		failed[service.Provider+"|"+service.Name+"|"+service.Region] = true
+	}
+	durations := make(map[string]time.Duration)
+	for _, check := range outcome.Report.Checks {
+		durations[check.Provider] = check.Duration
+	}
+
+	suites := junitTestSuites{Name: "hyperscaler"}
+	for _, provider := range outcome.Report.Providers {
+		suite := junitTestSuite{
+			Name:      provider.Name,
+			Time:      fmt.Sprintf("%.3f", durations[provider.Name].Seconds()),
+			Timestamp: outcome.Timestamp.UTC().Format("2006-01-02T15:04:05"),
+		}
+		for _, service := range provider.Services {
+			testCase := junitTestCase{
+				Name:      fmt.Sprintf("%s (%s)", service.Name, service.Region),
+				Classname: provider.Name,
+				SystemOut: fmt.Sprintf("%s: %s", service.Status.Label(), service.Details),
+			}
+			if failed[service.Provider+"|"+service.Name+"|"+service.Region] {
+				testCase.Failure = &junitFailure{
+					Message: fmt.Sprintf("%s is at or above %s", service.Status.Label(), outcome.Threshold.Label()),
+					Type:    string(service.Status),
+					Text:    service.Details,
+				}
+				suite.Failures++
+			}
+			if provider.Error != "" && service.Status == StatusUnknown {
+				testCase.Error = &junitFailure{
+					Message: "Status check failed",
+					Type:    "CheckError",
+					Text:    provider.Error,
+				}
+				suite.Errors++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+			suite.Tests++
+		}
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// statuspageServer serves a summary with one component in the given state,
+// or fails every request when status is empty
+func statuspageServer(t *testing.T, status string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == "" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"components":[{"id":"c1","name":"API","status":%q,"group":false}],"incidents":[],"scheduled_maintenances":[]}`, status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// checkConfig writes a config with one statuspage provider per server
+func checkConfig(t *testing.T, servers map[string]*httptest.Server) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("http:\n  retries: 0\nproviders:\n")
+	for name, server := range servers {
+		fmt.Fprintf(&b, "  - name: %s\n    type: statuspage\n    url: %s/\n    feed_url: %s/api/v2/summary.json\n", name, server.URL, server.URL)
+	}
+	path := filepath.Join(t.TempDir(), "hyperscaler.yaml")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// restoreGlobals undoes the changes runCheck makes to the shared state
+func restoreGlobals(t *testing.T) {
+	t.Helper()
+	checkers := registeredCheckers()
+	config := currentConfig()
+	t.Cleanup(func() {
+		setCheckers(checkers)
+		httpClient.Configure(defaultHTTPConfig())
+		configMutex.Lock()
+		activeConfig = config
+		configMutex.Unlock()
+	})
+}
+
+func TestRunCheckExitCodes(t *testing.T) {
+	up := statuspageServer(t, "operational")
+	down := statuspageServer(t, "major_outage")
+	slow := statuspageServer(t, "degraded_performance")
+	broken := statuspageServer(t, "")
+
+	tests := []struct {
+		name      string
+		servers   map[string]*httptest.Server
+		args      []string
+		want      int
+		wantLines []string
+	}{
+		{"all operational", map[string]*httptest.Server{"Up": up}, nil, checkPassed,
+			[]string{"Check passed"}},
+		{"outage", map[string]*httptest.Server{"Up": up, "Down": down}, nil, checkFailed,
+			[]string{"- Down API (Global): Major Outage"}},
+		{"below threshold", map[string]*httptest.Server{"Slow": slow}, nil, checkPassed,
+			[]string{"Check passed"}},
+		{"lower threshold", map[string]*httptest.Server{"Slow": slow}, []string{"-fail-on", "degraded"}, checkFailed,
+			[]string{"- Slow API (Global): Degraded"}},
+		{"unknown provider", map[string]*httptest.Server{"Down": down}, []string{"-providers", "up"}, checkError,
+			nil},
+		{"unfetchable provider", map[string]*httptest.Server{"Up": up, "Broken": broken}, nil, checkError,
+			[]string{"Could not check 1 provider(s):", "- Broken: ", "could not be confirmed"}},
+		{"unfetchable provider allowed", map[string]*httptest.Server{"Up": up, "Broken": broken}, []string{"-fail-on-unknown=false"}, checkPassed,
+			[]string{"Could not check 1 provider(s):", "Check passed"}},
+		{"outage and unfetchable provider", map[string]*httptest.Server{"Down": down, "Broken": broken}, nil, checkError,
+			[]string{"- Broken: ", "- Down API (Global): Major Outage"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			restoreGlobals(t)
+			output := filepath.Join(t.TempDir(), "out.txt")
+			args := append([]string{"-config", checkConfig(t, test.servers), "-output", output}, test.args...)
+			if got := runCheck(args); got != test.want {
+				t.Errorf("exit code %d, want %d", got, test.want)
+			}
+			data, _ := os.ReadFile(output)
+			for _, line := range test.wantLines {
+				if !strings.Contains(string(data), line) {
+					t.Errorf("output does not contain %q:\n%s", line, data)
+				}
+			}
+		})
+	}
+}
+
+func TestRunCheckJUnit(t *testing.T) {
+	restoreGlobals(t)
+	servers := map[string]*httptest.Server{
+		"Up":     statuspageServer(t, "operational"),
+		"Down":   statuspageServer(t, "major_outage"),
+		"Broken": statuspageServer(t, ""),
+	}
+	output := filepath.Join(t.TempDir(), "junit.xml")
+	if got := runCheck([]string{"-config", checkConfig(t, servers), "-format", "junit", "-output", output}); got != checkError {
+		t.Errorf("exit code %d, want %d", got, checkError)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("invalid JUnit XML: %v\n%s", err, data)
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Errors != 1 || len(suites.Suites) != 3 {
+		t.Fatalf("got %d tests, %d failures, %d errors in %d suites; want 3, 1, 1 in 3", suites.Tests, suites.Failures, suites.Errors, len(suites.Suites))
+	}
+	for _, suite := range suites.Suites {
+		if len(suite.Cases) != 1 {
+			t.Fatalf("%s: %d cases, want 1", suite.Name, len(suite.Cases))
+		}
+		testCase := suite.Cases[0]
+		switch suite.Name {
+		case "Up":
+			if testCase.Failure != nil || testCase.Error != nil || suite.Failures != 0 || suite.Errors != 0 {
+				t.Errorf("Up: %+v, want a passing case", suite)
+			}
+		case "Down":
+			if testCase.Failure == nil || testCase.Failure.Type != string(StatusMajorOutage) || suite.Failures != 1 {
+				t.Errorf("Down: %+v, want a MAJOR_OUTAGE failure", suite)
+			}
+		case "Broken":
+			if testCase.Error == nil || !strings.Contains(testCase.Error.Text, "503") || suite.Errors != 1 || testCase.Failure != nil {
+				t.Errorf("Broken: %+v, want an error with the fetch failure", suite)
+			}
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatusChecker checks the status page of a single provider
+type StatusChecker interface {
+	// Name is the provider name shown on the dashboard
+	Name() string
+	// URL is the provider's public status page
+	URL() string
+	// Check fetches the provider status and returns one Service per component
+	Check(ctx context.Context) ([]Service, error)
+}
+
+// FeedResult is everything a provider's feed describes
+type FeedResult struct {
+	Services    []Service
+	Incidents   []Incident
+	Maintenance []Maintenance
+}
+
+// FeedChecker is implemented by checkers whose feed describes incidents or
+// maintenance as well as component status. CheckFeed is used instead of
+// Check so all of it comes from one fetch.
+type FeedChecker interface {
+	StatusChecker
+	CheckFeed(ctx context.Context) (FeedResult, error)
+}
+
+var (
+	checkers      []StatusChecker
+	checkersMutex sync.RWMutex
+)
+
+// RegisterChecker adds a checker to the set used by generateReport,
+// replacing any checker already registered under the same name
+func RegisterChecker(c StatusChecker) {
+	checkersMutex.Lock()
+	defer checkersMutex.Unlock()
+
+	for i, existing := range checkers {
+		if existing.Name() == c.Name() {
+			checkers[i] = c
+			return
+		}
+	}
+	checkers = append(checkers, c)
+}
+
+// registeredCheckers returns a snapshot of the registered checkers
+func registeredCheckers() []StatusChecker {
+	checkersMutex.RLock()
+	defer checkersMutex.RUnlock()
+
+	return append([]StatusChecker(nil), checkers...)
+}
+
+// setCheckers replaces every registered checker
+func setCheckers(list []StatusChecker) {
+	checkersMutex.Lock()
+	defer checkersMutex.Unlock()
+
+	checkers = list
+}
+
+// newChecker creates the checker described by a provider config, wrapped
+// with its timeout and poll interval
+func newChecker(config ProviderConfig) (StatusChecker, error) {
+	var checker StatusChecker
+	switch config.Type {
+	case "statuspage":
+		checker = &statuspageChecker{
+			ProviderName: config.Name,
+			StatusURL:    config.URL,
+			FeedURL:      config.FeedURL,
+		}
+	case "google":
+		checker = &googleIncidentsChecker{
+			ProviderName: config.Name,
+			StatusURL:    config.URL,
+			FeedURL:      config.FeedURL,
+			ProductsURL:  config.ProductsURL,
+			ServiceName:  config.ServiceName,
+		}
+	case "feed":
+		checker = &feedChecker{
+			ProviderName: config.Name,
+			StatusURL:    config.URL,
+			FeedURL:      config.FeedURL,
+			ServiceName:  config.ServiceName,
+			Window:       config.Window,
+		}
+	case "keyword":
+		if len(config.Match.Up) == 0 && len(config.Match.Down) == 0 {
+			return nil, fmt.Errorf("provider %q: keyword checker needs match.up or match.down", config.Name)
+		}
+		checker = &keywordChecker{
+			ProviderName: config.Name,
+			StatusURL:    config.URL,
+			ServiceName:  config.ServiceName,
+			UpKeywords:   config.Match.Up,
+			DownKeywords: config.Match.Down,
+			DownDetails:  config.Match.DownDetails,
+			DownStatus:   config.Match.DownStatus,
+		}
+	default:
+		return nil, fmt.Errorf("provider %q: unknown checker type %q", config.Name, config.Type)
+	}
+
+	if config.URL == "" {
+		return nil, fmt.Errorf("provider %q: url is required", config.Name)
+	}
+	if config.Type != "keyword" && config.FeedURL == "" {
+		return nil, fmt.Errorf("provider %q: feed_url is required for %s checkers", config.Name, config.Type)
+	}
+	if config.ServiceName == "" {
+		if sc, ok := checker.(*keywordChecker); ok {
+			sc.ServiceName = config.Name
+		}
+	}
+
+	if config.Timeout == 0 && config.Interval == 0 && config.MinInterval == 0 {
+		return checker, nil
+	}
+	return &scheduledChecker{
+		StatusChecker: checker,
+		Timeout:       config.Timeout,
+		Interval:      config.Interval,
+		MinInterval:   config.MinInterval,
+	}, nil
+}
+
+// scheduledChecker applies a per-provider timeout and poll interval to a
+// checker. Within the interval the previous result is returned unchanged;
+// the interval runs from the start of the last check, with scheduleSlack
+// so a tick that arrives a little early is not skipped.
+type scheduledChecker struct {
+	StatusChecker
+	Timeout  time.Duration
+	Interval time.Duration
+	// MinInterval rate-limits manual refreshes; it works like Interval but
+	// is set for every provider from min_refresh_interval, and a failed
+	// check is retried without waiting for it
+	MinInterval time.Duration
+
+	// now is the clock; tests replace it
+	now func() time.Time
+
+	mu      sync.Mutex
+	lastRun time.Time
+	result  FeedResult
+	err     error
+}
+
+func (c *scheduledChecker) Check(ctx context.Context) ([]Service, error) {
+	result, err := c.CheckFeed(ctx)
+	return result.Services, err
+}
+
+// CheckFeed forwards to the wrapped checker's CheckFeed when it has one, so
+// wrapping a checker never hides its incidents or maintenance
+func (c *scheduledChecker) CheckFeed(ctx context.Context) (FeedResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wait := c.Interval
+	if c.err == nil && c.MinInterval > wait {
+		wait = c.MinInterval
+	}
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	start := now()
+	if wait > 0 && !c.lastRun.IsZero() && start.Sub(c.lastRun) < wait-wait/scheduleSlack {
+		return c.result, c.err
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	if checker, ok := c.StatusChecker.(FeedChecker); ok {
+		c.result, c.err = checker.CheckFeed(ctx)
+	} else {
+		c.result = FeedResult{}
+		c.result.Services, c.err = c.StatusChecker.Check(ctx)
+	}
+	c.lastRun = start
+	return c.result, c.err
+}
+
+// scheduleSlack lets a check run up to 1/scheduleSlack of its interval early
+const scheduleSlack = 20
+
+// keywordChecker decides the status by looking for keywords in a status page.
+// If UpKeywords is set the service is operational only when one of them is
+// present, otherwise it has a problem when any of DownKeywords is present.
+// It is a fallback for pages without a feed, and its details say so.
+type keywordChecker struct {
+	ProviderName string
+	StatusURL    string
+	ServiceName  string
+	UpKeywords   []string
+	DownKeywords []string
+	DownDetails  string
+	// DownStatus is reported when the page shows a problem; defaults to PartialOutage
+	DownStatus Status
+}
+
+// keywordConfidence is appended to keyword checker details. A reworded page,
+// or one rendered by JavaScript, silently reads as operational.
+const keywordConfidence = " (keyword match, low confidence)"
+
+func (c *keywordChecker) Name() string { return c.ProviderName }
+
+func (c *keywordChecker) URL() string { return c.StatusURL }
+
+func (c *keywordChecker) Check(ctx context.Context) ([]Service, error) {
+	body, err := fetchBody(ctx, c.StatusURL)
+	if err != nil {
+		return nil, fmt.Errorf("error checking %s status: %v", c.ProviderName, err)
+	}
+
+	content := string(body)
+	up := true
+	if len(c.UpKeywords) > 0 {
+		up = containsAny(content, c.UpKeywords)
+	} else if containsAny(content, c.DownKeywords) {
+		up = false
+	}
+
+	service := Service{
+		Name:      c.ServiceName,
+		Provider:  c.ProviderName,
+		Status:    StatusOperational,
+		LastCheck: time.Now(),
+		Details:   "All services operational",
+		Region:    "Global",
+	}
+	if !up {
+		service.Status = c.DownStatus
+		if service.Status == "" {
+			service.Status = StatusPartialOutage
+		}
+		service.Details = c.DownDetails
+	}
+	service.Details += keywordConfidence
+	return []Service{service}, nil
+}
+
+// fetchBody fetches a status page through the shared client
+func fetchBody(ctx context.Context, url string) ([]byte, error) {
+	return httpClient.Get(ctx, url)
+}
+
+func containsAny(content string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(content, keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// feedServer serves the fixtures, plus paths that fail in the ways a status
+// page can: /404, /500, /html, /truncated, /huge, which is larger than
+// maxResponseSize, and /slow, which answers only once the request is
+// cancelled
+func feedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/404", func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) })
+	mux.HandleFunc("/500", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>Maintenance page</body></html>"))
+	})
+	mux.HandleFunc("/truncated", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"components":[{"id":"c1","name":"API"`))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte(" "), maxResponseSize+1))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	mux.Handle("/testdata/", http.StripPrefix("/testdata/", http.FileServer(http.Dir("testdata"))))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// withoutRetries makes failed fetches return at once for the duration of the test
+func withoutRetries(t *testing.T) {
+	t.Helper()
+	config := defaultHTTPConfig()
+	config.Retries = 0
+	httpClient.Configure(config)
+	t.Cleanup(func() { httpClient.Configure(defaultHTTPConfig()) })
+}
+
+func TestCheckersReportFetchAndParseErrors(t *testing.T) {
+	withoutRetries(t)
+	server := feedServer(t)
+
+	checkers := []struct {
+		name    string
+		fixture string
+		build   func(feedURL string) FeedChecker
+	}{
+		{"statuspage", "statuspage_summary.json", func(feedURL string) FeedChecker {
+			return &statuspageChecker{ProviderName: "Example", StatusURL: server.URL, FeedURL: feedURL}
+		}},
+		{"google", "google_incidents.json", func(feedURL string) FeedChecker {
+			return &googleIncidentsChecker{ProviderName: "Example", StatusURL: server.URL, FeedURL: feedURL, ServiceName: "Example Cloud"}
+		}},
+		{"rss", "aws_all.rss", func(feedURL string) FeedChecker {
+			return &feedChecker{ProviderName: "Example", StatusURL: server.URL, FeedURL: feedURL, ServiceName: "Example Cloud"}
+		}},
+		{"atom", "github_history.atom", func(feedURL string) FeedChecker {
+			return &feedChecker{ProviderName: "Example", StatusURL: server.URL, FeedURL: feedURL, ServiceName: "Example Cloud"}
+		}},
+	}
+	failures := []struct {
+		path    string
+		wantErr string
+	}{
+		{"/404", "404 Not Found"},
+		{"/500", "500 Internal Server Error"},
+		{"/html", "error parsing Example"},
+		{"/truncated", "error parsing Example"},
+		{"/huge", "larger than"},
+		{"/slow", "context deadline exceeded"},
+	}
+
+	for _, checker := range checkers {
+		t.Run(checker.name, func(t *testing.T) {
+			result, err := checker.build(server.URL + "/testdata/" + checker.fixture).CheckFeed(context.Background())
+			if err != nil || len(result.Services) == 0 {
+				t.Fatalf("fixture: got %d services and error %v", len(result.Services), err)
+			}
+
+			for _, failure := range failures {
+				// Long enough to read /huge under the race detector
+				timeout := 2 * time.Second
+				if failure.path == "/slow" {
+					timeout = 100 * time.Millisecond
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				start := time.Now()
+				result, err := checker.build(server.URL + failure.path).CheckFeed(ctx)
+				cancel()
+				if err == nil || !strings.Contains(err.Error(), failure.wantErr) || !strings.Contains(err.Error(), "Example") {
+					t.Errorf("%s: error %v, want one naming the provider and containing %q", failure.path, err, failure.wantErr)
+				}
+				if len(result.Services) != 0 || len(result.Incidents) != 0 {
+					t.Errorf("%s: got %+v alongside the error", failure.path, result)
+				}
+				if elapsed := time.Since(start); elapsed > 5*time.Second {
+					t.Errorf("%s: took %s", failure.path, elapsed)
+				}
+			}
+		})
+	}
+}
+
+func TestGoogleCheckerSurvivesMissingProducts(t *testing.T) {
+	withoutRetries(t)
+	server := feedServer(t)
+
+	checker := &googleIncidentsChecker{
+		ProviderName: "Google Cloud",
+		StatusURL:    server.URL,
+		FeedURL:      server.URL + "/testdata/google_incidents.json",
+		ProductsURL:  server.URL + "/500",
+		ServiceName:  "Google Cloud Platform",
+	}
+	result, err := checker.CheckFeed(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without the catalog only the products with an open incident are listed
+	if len(result.Services) != 2 || result.Services[0].Name != "Cloud SQL" {
+		t.Errorf("services %+v, want the two Cloud SQL rows", result.Services)
+	}
+}
+
+func TestScheduledCheckerAppliesTimeout(t *testing.T) {
+	withoutRetries(t)
+	server := feedServer(t)
+
+	checker := &scheduledChecker{
+		StatusChecker: &statuspageChecker{ProviderName: "Example", StatusURL: server.URL, FeedURL: server.URL + "/slow"},
+		Timeout:       50 * time.Millisecond,
+	}
+	start := time.Now()
+	if _, err := checker.CheckFeed(context.Background()); err == nil || !strings.Contains(err.Error(), "context deadline exceeded") {
+		t.Errorf("error %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s despite a 50ms timeout", elapsed)
+	}
+}
+
+func TestOversizedResponseIsNotRetried(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(bytes.Repeat([]byte(" "), maxResponseSize+1))
+	}))
+	defer server.Close()
+
+	if _, err := fetchBody(context.Background(), server.URL); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("error %v, want one about the size", err)
+	}
+	if requests != 1 {
+		t.Errorf("made %d requests, want 1", requests)
+	}
+}
+
+// countingChecker counts its checks and fails while err is set
+type countingChecker struct {
+	calls int
+	err   error
+}
+
+func (c *countingChecker) Name() string { return "Example" }
+
+func (c *countingChecker) URL() string { return "https://status.example.com/" }
+
+func (c *countingChecker) Check(ctx context.Context) ([]Service, error) {
+	c.calls++
+	return nil, c.err
+}
+
+func TestScheduledCheckerInterval(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	stub := &countingChecker{}
+	checker := &scheduledChecker{StatusChecker: stub, Interval: 5 * time.Minute, now: func() time.Time { return now }}
+
+	steps := []struct {
+		at        time.Duration
+		wantCalls int
+	}{
+		{0, 1},
+		{time.Minute, 1},
+		// A tick a few seconds early still runs the check
+		{5*time.Minute - 3*time.Second, 2},
+		{9 * time.Minute, 2},
+		{10 * time.Minute, 3},
+	}
+	for _, step := range steps {
+		now = start.Add(step.at)
+		checker.Check(context.Background())
+		if stub.calls != step.wantCalls {
+			t.Errorf("at %s: %d checks, want %d", step.at, stub.calls, step.wantCalls)
+		}
+	}
+}
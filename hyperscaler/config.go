@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the hyperscaler configuration, loaded from a YAML file and
+// overridden by environment variables and command-line flags
+type Config struct {
+	Listen   string        `yaml:"listen"`
+	Timezone string        `yaml:"timezone"`
+	Interval time.Duration `yaml:"interval"`
+	// MinRefreshInterval is the shortest time between two fetches of a
+	// provider's status page, however often refreshes are requested
+	MinRefreshInterval time.Duration `yaml:"min_refresh_interval"`
+	HistoryPath        string        `yaml:"history_path"`
+	// ShutdownTimeout bounds how long a shutdown waits for requests and the
+	// report in flight before cancelling its checks
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// ReadyIntervals is how many intervals may pass since the last finished
+	// report cycle before /readyz fails
+	ReadyIntervals int `yaml:"ready_intervals"`
+	// DependenciesPath is the manifest mapping our services to provider components
+	DependenciesPath string `yaml:"dependencies_path"`
+	// ThemeDir holds templates/*.html and static/* files that replace the built-in ones
+	ThemeDir string      `yaml:"theme_dir"`
+	HTTP     HTTPConfig  `yaml:"http"`
+	Probes   ProbeConfig `yaml:"probes"`
+	// Maintenance selects the maintenance windows shown on the dashboard
+	Maintenance MaintenanceConfig `yaml:"maintenance"`
+	Alerts      AlertConfig       `yaml:"alerts"`
+	// Auth protects the dashboard; see AuthConfig
+	Auth      AuthConfig       `yaml:"auth"`
+	Providers []ProviderConfig `yaml:"providers"`
+
+	location     *time.Location
+	dependencies *DependencyManifest
+}
+
+// ProviderConfig declares a single provider checker
+type ProviderConfig struct {
+	Name string `yaml:"name"`
+	// Type is one of statuspage, google, feed or keyword
+	Type        string        `yaml:"type"`
+	URL         string        `yaml:"url"`
+	FeedURL     string        `yaml:"feed_url"`
+	ProductsURL string        `yaml:"products_url"`
+	ServiceName string        `yaml:"service_name"`
+	Match       MatchRules    `yaml:"match"`
+	Window      time.Duration `yaml:"window"`
+	Timeout     time.Duration `yaml:"timeout"`
+	Interval    time.Duration `yaml:"interval"`
+	// MinInterval overrides the global min_refresh_interval for this provider
+	MinInterval time.Duration `yaml:"min_interval"`
+	Disabled    bool          `yaml:"disabled"`
+}
+
+// MatchRules are the keywords used by the keyword checker type
+type MatchRules struct {
+	Up          []string `yaml:"up"`
+	Down        []string `yaml:"down"`
+	DownDetails string   `yaml:"down_details"`
+	// DownStatus is the status reported on a match, e.g. major_outage
+	DownStatus Status `yaml:"down_status"`
+}
+
+// defaultConfig returns the configuration used when no file is given
+func defaultConfig() *Config {
+	return &Config{
+		Listen:             ":8080",
+		Timezone:           "America/Los_Angeles",
+		Interval:           5 * time.Minute,
+		MinRefreshInterval: time.Minute,
+		HistoryPath:        "hyperscaler_history.jsonl",
+		ShutdownTimeout:    30 * time.Second,
+		ReadyIntervals:     3,
+		HTTP:               defaultHTTPConfig(),
+		Probes:             defaultProbeConfig(),
+		Maintenance:        defaultMaintenanceConfig(),
+		Auth:               defaultAuthConfig(),
+		Alerts: AlertConfig{
+			SMTPFrom: "hyperscaler@localhost",
+			Debounce: 15 * time.Minute,
+		},
+		Providers: defaultProviders(),
+	}
+}
+
+// defaultProviders are the built-in provider checkers
+func defaultProviders() []ProviderConfig {
+	return []ProviderConfig{
+		{
+			Name:        "Google",
+			Type:        "google",
+			URL:         "https://www.google.com/appsstatus/dashboard/",
+			FeedURL:     "https://www.google.com/appsstatus/dashboard/incidents.json",
+			ProductsURL: "https://www.google.com/appsstatus/dashboard/products.json",
+			ServiceName: "Google Workspace",
+		},
+		{
+			Name:        "Google Cloud",
+			Type:        "google",
+			URL:         "https://status.cloud.google.com/",
+			FeedURL:     "https://status.cloud.google.com/incidents.json",
+			ProductsURL: "https://status.cloud.google.com/products.json",
+			ServiceName: "Google Cloud Platform",
+		},
+		{
+			Name:        "Oracle Cloud",
+			Type:        "feed",
+			URL:         "https://ocistatus.oraclecloud.com/#/",
+			FeedURL:     "https://ocistatus.oraclecloud.com/api/v2/incident-summary.rss",
+			ServiceName: "Oracle Cloud Infrastructure",
+		},
+		{
+			Name:        "Azure",
+			Type:        "feed",
+			URL:         "https://azure.status.microsoft/en-us/status",
+			FeedURL:     "https://azure.status.microsoft/en-us/status/feed/",
+			ServiceName: "Azure Services",
+		},
+		{
+			Name:        "AWS",
+			Type:        "feed",
+			URL:         "https://health.aws.amazon.com/health/status",
+			FeedURL:     "https://status.aws.amazon.com/rss/all.rss",
+			ServiceName: "AWS Services",
+		},
+		{
+			Name:    "GitHub",
+			Type:    "statuspage",
+			URL:     "https://www.githubstatus.com/",
+			FeedURL: "https://www.githubstatus.com/api/v2/summary.json",
+		},
+		{
+			Name:    "Cloudflare",
+			Type:    "statuspage",
+			URL:     "https://www.cloudflarestatus.com/",
+			FeedURL: "https://www.cloudflarestatus.com/api/v2/summary.json",
+		},
+	}
+}
+
+// loadConfigFile reads a YAML config on top of the defaults. Providers listed
+// in the file replace the built-in list entirely.
+func loadConfigFile(path string) (*Config, error) {
+	config := defaultConfig()
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %v", err)
+	}
+
+	config.Providers = nil
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+	if len(config.Providers) == 0 {
+		config.Providers = defaultProviders()
+	}
+	return config, nil
+}
+
+// applyEnv overrides config values from HYPERSCALER_* environment variables
+func (c *Config) applyEnv() error {
+	if v := os.Getenv("HYPERSCALER_LISTEN"); v != "" {
+		c.Listen = v
+	}
+	if v := os.Getenv("HYPERSCALER_TIMEZONE"); v != "" {
+		c.Timezone = v
+	}
+	if v := os.Getenv("HYPERSCALER_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid HYPERSCALER_INTERVAL: %v", err)
+		}
+		c.Interval = interval
+	}
+	if v, ok := os.LookupEnv("HYPERSCALER_HISTORY"); ok {
+		c.HistoryPath = v
+	}
+	if v, ok := os.LookupEnv("HYPERSCALER_DEPENDENCIES"); ok {
+		c.DependenciesPath = v
+	}
+	if v := os.Getenv("HYPERSCALER_SMTP_PASSWORD"); v != "" {
+		c.Alerts.SMTPPassword = v
+	}
+	return nil
+}
+
+// validate checks the config and resolves the display timezone
+func (c *Config) validate() error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if c.MinRefreshInterval < 0 {
+		return fmt.Errorf("min_refresh_interval must not be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown_timeout must be positive")
+	}
+	if c.ReadyIntervals < 1 {
+		return fmt.Errorf("ready_intervals must be at least 1")
+	}
+	if c.HTTP.Retries < 0 {
+		return fmt.Errorf("http.retries must not be negative")
+	}
+	if c.HTTP.RequestTimeout <= 0 || c.HTTP.CheckTimeout <= 0 {
+		return fmt.Errorf("http.request_timeout and http.check_timeout must be positive")
+	}
+	if err := c.Probes.validate(); err != nil {
+		return err
+	}
+	if err := c.Maintenance.validate(); err != nil {
+		return err
+	}
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
+	if c.ThemeDir != "" {
+		if info, err := os.Stat(c.ThemeDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("theme_dir %q is not a directory", c.ThemeDir)
+		}
+	}
+
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %v", c.Timezone, err)
+	}
+	c.location = location
+	c.Alerts.Location = location
+
+	if c.Alerts.QuietHours != "" {
+		if _, _, err := parseQuietHours(c.Alerts.QuietHours); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, provider := range c.Providers {
+		if provider.Name == "" {
+			return fmt.Errorf("provider is missing a name")
+		}
+		if seen[provider.Name] {
+			return fmt.Errorf("provider %q is declared twice", provider.Name)
+		}
+		seen[provider.Name] = true
+
+		if _, err := newChecker(provider); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cliFlags holds the command-line overrides; only flags that were set
+// explicitly take precedence over the file and environment
+type cliFlags struct {
+	configPath  string
+	listen      string
+	timezone    string
+	interval    time.Duration
+	historyPath string
+	depsPath    string
+	themeDir    string
+	dev         bool
+	devDir      string
+	alerts      AlertConfig
+	smtpTo      string
+	set         map[string]bool
+}
+
+func parseFlags() *cliFlags {
+	f := newCLIFlags(flag.CommandLine, true)
+	flag.Parse()
+	f.visit(flag.CommandLine)
+	return f
+}
+
+// newCLIFlags registers the config flags on fs. The server flags (listen
+// address, schedule, history, theme and alerts) are only registered for the
+// dashboard, not for one-shot subcommands.
+func newCLIFlags(fs *flag.FlagSet, server bool) *cliFlags {
+	f := &cliFlags{set: make(map[string]bool)}
+	fs.StringVar(&f.configPath, "config", os.Getenv("HYPERSCALER_CONFIG"), "path of the YAML config file")
+	fs.StringVar(&f.timezone, "timezone", "America/Los_Angeles", "timezone used to display timestamps")
+	fs.StringVar(&f.depsPath, "dependencies", "", "path of the dependency manifest mapping our services to provider components")
+	if !server {
+		return f
+	}
+	fs.StringVar(&f.listen, "listen", ":8080", "HTTP listen address")
+	fs.DurationVar(&f.interval, "interval", 5*time.Minute, "time between scheduled reports")
+	fs.StringVar(&f.historyPath, "history", "hyperscaler_history.jsonl", "path of the status history file, empty to disable")
+	fs.StringVar(&f.themeDir, "theme", "", "directory of templates and static files overriding the built-in ones")
+	fs.BoolVar(&f.dev, "dev", false, "reload templates and static files from the source tree on every request")
+	fs.StringVar(&f.devDir, "dev-dir", "", "source directory read by -dev, which it implies; defaults to where the binary was built from")
+	fs.StringVar(&f.alerts.WebhookURL, "alert-webhook", "", "URL to POST JSON alerts to")
+	fs.StringVar(&f.alerts.SlackWebhookURL, "alert-slack", "", "Slack incoming webhook URL for alerts")
+	fs.StringVar(&f.alerts.SMTPAddr, "alert-smtp", "", "SMTP relay host:port for email alerts")
+	fs.StringVar(&f.alerts.SMTPFrom, "alert-smtp-from", "hyperscaler@localhost", "sender address for email alerts")
+	fs.StringVar(&f.smtpTo, "alert-smtp-to", "", "comma-separated recipients for email alerts")
+	fs.StringVar(&f.alerts.SMTPUsername, "alert-smtp-user", "", "SMTP username, password is read from HYPERSCALER_SMTP_PASSWORD")
+	fs.StringVar(&f.alerts.ExecCommand, "alert-exec", "", "shell command run with alerts as JSON on stdin")
+	fs.DurationVar(&f.alerts.Debounce, "alert-debounce", 15*time.Minute, "minimum time between alerts for the same provider")
+	fs.StringVar(&f.alerts.QuietHours, "alert-quiet-hours", "", "suppress alerts during HH:MM-HH:MM")
+	return f
+}
+
+// visit records which flags were set explicitly, after fs has been parsed
+func (f *cliFlags) visit(fs *flag.FlagSet) {
+	fs.Visit(func(fl *flag.Flag) {
+		f.set[fl.Name] = true
+	})
+}
+
+// templatesDir is the source tree templates are read from in dev mode, or
+// empty to use the embedded ones
+func (f *cliFlags) templatesDir() string {
+	if f.devDir != "" {
+		return f.devDir
+	}
+	if f.dev {
+		return sourceDir()
+	}
+	return ""
+}
+
+// apply overrides config values with the flags that were set
+func (f *cliFlags) apply(c *Config) {
+	if f.set["listen"] {
+		c.Listen = f.listen
+	}
+	if f.set["timezone"] {
+		c.Timezone = f.timezone
+	}
+	if f.set["interval"] {
+		c.Interval = f.interval
+	}
+	if f.set["history"] {
+		c.HistoryPath = f.historyPath
+	}
+	if f.set["dependencies"] {
+		c.DependenciesPath = f.depsPath
+	}
+	if f.set["theme"] {
+		c.ThemeDir = f.themeDir
+	}
+	if f.set["alert-webhook"] {
+		c.Alerts.WebhookURL = f.alerts.WebhookURL
+	}
+	if f.set["alert-slack"] {
+		c.Alerts.SlackWebhookURL = f.alerts.SlackWebhookURL
+	}
+	if f.set["alert-smtp"] {
+		c.Alerts.SMTPAddr = f.alerts.SMTPAddr
+	}
+	if f.set["alert-smtp-from"] {
+		c.Alerts.SMTPFrom = f.alerts.SMTPFrom
+	}
+	if f.set["alert-smtp-to"] {
+		c.Alerts.SMTPTo = strings.Split(f.smtpTo, ",")
+	}
+	if f.set["alert-smtp-user"] {
+		c.Alerts.SMTPUsername = f.alerts.SMTPUsername
+	}
+	if f.set["alert-exec"] {
+		c.Alerts.ExecCommand = f.alerts.ExecCommand
+	}
+	if f.set["alert-debounce"] {
+		c.Alerts.Debounce = f.alerts.Debounce
+	}
+	if f.set["alert-quiet-hours"] {
+		c.Alerts.QuietHours = f.alerts.QuietHours
+	}
+}
+
+// loadConfig builds the effective config from file, environment and flags
+func loadConfig(flags *cliFlags) (*Config, error) {
+	config, err := loadConfigFile(flags.configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+	flags.apply(config)
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.dependencies, err = loadDependencies(config.DependenciesPath); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+var (
+	activeConfig *Config
+	configMutex  sync.RWMutex
+)
+
+// currentConfig returns the config in effect
+func currentConfig() *Config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return activeConfig
+}
+
+// displayLocation returns the timezone used for report timestamps
+func displayLocation() *time.Location {
+	if config := currentConfig(); config != nil && config.location != nil {
+		return config.location
+	}
+	return time.Local
+}
+
+// applyConfig makes a validated config active: it rebuilds the checkers and
+// reconfigures alerting. Listen address and history path changes need a restart.
+func applyConfig(config *Config) {
+	var built []StatusChecker
+	for _, provider := range config.Providers {
+		if provider.Disabled {
+			continue
+		}
+		if provider.MinInterval == 0 {
+			provider.MinInterval = config.MinRefreshInterval
+		}
+		checker, err := newChecker(provider)
+		if err != nil {
+			// validate has already rejected bad providers
+			log.Printf("Error creating checker %s: %v", provider.Name, err)
+			continue
+		}
+		built = append(built, checker)
+	}
+	setCheckers(built)
+	httpClient.Configure(config.HTTP)
+	probes.Configure(config.Probes)
+
+	configMutex.Lock()
+	previous := activeConfig
+	activeConfig = config
+	configMutex.Unlock()
+
+	if alerts != nil {
+		if err := alerts.Reconfigure(config.Alerts); err != nil {
+			log.Printf("Error reconfiguring alerts: %v", err)
+		}
+	}
+
+	if previous != nil {
+		if previous.Listen != config.Listen {
+			log.Printf("Listen address changed to %s; restart to apply", config.Listen)
+		}
+		if previous.HistoryPath != config.HistoryPath {
+			log.Printf("History path changed to %s; restart to apply", config.HistoryPath)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DependencyManifest maps our own services to the provider components they use
+type DependencyManifest struct {
+	Services []OwnService `yaml:"services"`
+}
+
+// OwnService is one of our services and what it depends on
+type OwnService struct {
+	Name      string       `yaml:"name"`
+	Owner     string       `yaml:"owner"`
+	DependsOn []Dependency `yaml:"depends_on"`
+}
+
+// Dependency names a provider component. Service and Region are optional
+// and may use shell-style wildcards; empty matches anything.
+type Dependency struct {
+	Provider string `yaml:"provider"`
+	Service  string `yaml:"service"`
+	Region   string `yaml:"region"`
+}
+
+func (d Dependency) String() string {
+	parts := []string{d.Provider}
+	if d.Service != "" {
+		parts = append(parts, d.Service)
+	}
+	if d.Region != "" {
+		parts = append(parts, d.Region)
+	}
+	return strings.Join(parts, "/")
+}
+
+// matchField compares case-insensitively, with wildcards. Unlike in a
+// path, * also matches a slash, as in "CDN/Cache Delivery".
+func matchField(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	slashless := strings.NewReplacer("/", "\x00")
+	ok, err := path.Match(slashless.Replace(strings.ToLower(pattern)), slashless.Replace(strings.ToLower(value)))
+	return err == nil && ok
+}
+
+// Matches reports whether a service row is covered by the dependency. A
+// row reported for the Global region matches every region.
+func (d Dependency) Matches(service Service) bool {
+	if !strings.EqualFold(d.Provider, service.Provider) || !matchField(d.Service, service.Name) {
+		return false
+	}
+	return service.Region == "Global" || matchField(d.Region, service.Region)
+}
+
+// loadDependencies reads a dependency manifest; an empty path means none
+func loadDependencies(filename string) (*DependencyManifest, error) {
+	manifest := &DependencyManifest{}
+	if filename == "" {
+		return manifest, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dependencies: %v", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(manifest); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error parsing dependencies %s: %v", filename, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, service := range manifest.Services {
+		if service.Name == "" {
+			return nil, fmt.Errorf("dependencies %s: service without a name", filename)
+		}
+		if seen[service.Name] {
+			return nil, fmt.Errorf("dependencies %s: service %q is declared twice", filename, service.Name)
+		}
+		seen[service.Name] = true
+		for _, dependency := range service.DependsOn {
+			if dependency.Provider == "" {
+				return nil, fmt.Errorf("dependencies %s: service %q has a dependency without a provider", filename, service.Name)
+			}
+			for _, pattern := range []string{dependency.Service, dependency.Region} {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("dependencies %s: service %q: bad pattern %q", filename, service.Name, pattern)
+				}
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// ImpactCause is a provider component that affects one of our services
+type ImpactCause struct {
+	Dependency string
+	Provider   string
+	Service    string
+	Region     string
+	Status     Status
+	Details    string
+	IncidentID string `json:",omitempty"`
+}
+
+// ServiceImpact is the computed state of one of our services
+type ServiceImpact struct {
+	Name   string
+	Owner  string `json:",omitempty"`
+	Status Status
+	// Causes lists the dependencies that are not healthy
+	Causes []ImpactCause
+}
+
+// ImpactReport is the response of /api/impact
+type ImpactReport struct {
+	Timestamp time.Time
+	Services  []ServiceImpact
+}
+
+// computeImpact works out which of our services are affected by the report.
+// A dependency with no matching row is operational, since most feeds only
+// list affected components, unless its provider could not be checked.
+func computeImpact(manifest *DependencyManifest, report StatusReport) ImpactReport {
+	impact := ImpactReport{Timestamp: report.Timestamp}
+
+	failed := make(map[string]string)
+	for _, provider := range report.Providers {
+		if provider.Error != "" {
+			failed[strings.ToLower(provider.Name)] = provider.Error
+		}
+	}
+
+	for _, own := range manifest.Services {
+		result := ServiceImpact{Name: own.Name, Owner: own.Owner, Status: StatusOperational}
+		for _, dependency := range own.DependsOn {
+			if reason, ok := failed[strings.ToLower(dependency.Provider)]; ok {
+				result.Status = worstStatus(result.Status, StatusUnknown)
+				result.Causes = append(result.Causes, ImpactCause{
+					Dependency: dependency.String(),
+					Provider:   dependency.Provider,
+					Service:    dependency.Service,
+					Region:     dependency.Region,
+					Status:     StatusUnknown,
+					Details:    fmt.Sprintf("Status check failed: %s", reason),
+				})
+				continue
+			}
+			for _, provider := range report.Providers {
+				for _, service := range provider.Services {
+					if !dependency.Matches(service) || service.Status == StatusOperational {
+						continue
+					}
+					result.Status = worstStatus(result.Status, service.Status)
+					result.Causes = append(result.Causes, ImpactCause{
+						Dependency: dependency.String(),
+						Provider:   service.Provider,
+						Service:    service.Name,
+						Region:     service.Region,
+						Status:     service.Status,
+						Details:    service.Details,
+						IncidentID: service.IncidentID,
+					})
+				}
+			}
+		}
+		impact.Services = append(impact.Services, result)
+	}
+	return impact
+}
+
+// currentDependencies returns the manifest in effect
+func currentDependencies() *DependencyManifest {
+	if config := currentConfig(); config != nil && config.dependencies != nil {
+		return config.dependencies
+	}
+	return &DependencyManifest{}
+}
+
+// handleAPIImpact returns the impact of the current report on our services.
+// With ?affected=1 only services that are not operational are listed.
+func handleAPIImpact(w http.ResponseWriter, r *http.Request) {
+	reportMutex.RLock()
+	report := currentReport
+	reportMutex.RUnlock()
+
+	impact := computeImpact(currentDependencies(), report)
+	if r.URL.Query().Get("affected") == "1" {
+		var affected []ServiceImpact
+		for _, service := range impact.Services {
+			if service.Status != StatusOperational {
+				affected = append(affected, service)
+			}
+		}
+		impact.Services = affected
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(impact)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testManifest = `
+services:
+  - name: checkout-api
+    owner: payments
+    depends_on:
+      - provider: Azure
+        service: Storage
+        region: westus2
+      - provider: cloudflare
+        service: "CDN*"
+  - name: build-pipeline
+    depends_on:
+      - provider: GitHub
+        service: Actions
+  - name: analytics
+    depends_on:
+      - provider: Google Cloud
+        region: "us-*"
+`
+
+// impactSummaries lists each service as "name STATUS" followed by its causes
+func impactSummaries(impact ImpactReport) []string {
+	var summaries []string
+	for _, service := range impact.Services {
+		summary := service.Name + " " + string(service.Status)
+		for _, cause := range service.Causes {
+			summary += " [" + cause.Dependency + ": " + cause.Service + "@" + cause.Region + " " + string(cause.Status) + "]"
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func TestComputeImpact(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "dependencies.yaml")
+	if err := os.WriteFile(filename, []byte(testManifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := loadDependencies(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := func(provider, name, region string, status Status) Service {
+		return Service{Provider: provider, Name: name, Region: region, Status: status}
+	}
+	tests := []struct {
+		name      string
+		providers []Provider
+		want      []string
+	}{
+		{
+			name: "nothing reported",
+			want: []string{"checkout-api OPERATIONAL", "build-pipeline OPERATIONAL", "analytics OPERATIONAL"},
+		},
+		{
+			name: "unmatched components",
+			providers: []Provider{
+				{Name: "Azure", Services: []Service{
+					row("Azure", "Storage", "eastus", StatusMajorOutage),
+					row("Azure", "Compute", "westus2", StatusMajorOutage),
+				}},
+				{Name: "GitHub", Services: []Service{row("GitHub", "Pages", "Global", StatusPartialOutage)}},
+				{Name: "Google Cloud", Services: []Service{row("Google Cloud", "Cloud SQL", "europe-west1", StatusDegraded)}},
+			},
+			want: []string{"checkout-api OPERATIONAL", "build-pipeline OPERATIONAL", "analytics OPERATIONAL"},
+		},
+		{
+			name: "worst status wins",
+			providers: []Provider{
+				{Name: "Azure", Services: []Service{row("Azure", "Storage", "westus2", StatusDegraded)}},
+				{Name: "Cloudflare", Services: []Service{
+					row("Cloudflare", "CDN/Cache", "Global", StatusPartialOutage),
+					row("Cloudflare", "DNS", "Global", StatusMajorOutage),
+				}},
+				{Name: "Google Cloud", Services: []Service{
+					row("Google Cloud", "Cloud SQL", "us-east1", StatusDegraded),
+					row("Google Cloud", "BigQuery", "us-central1", StatusMaintenance),
+				}},
+			},
+			want: []string{
+				"checkout-api PARTIAL_OUTAGE [Azure/Storage/westus2: Storage@westus2 DEGRADED] [cloudflare/CDN*: CDN/Cache@Global PARTIAL_OUTAGE]",
+				"build-pipeline OPERATIONAL",
+				"analytics DEGRADED [Google Cloud/us-*: Cloud SQL@us-east1 DEGRADED] [Google Cloud/us-*: BigQuery@us-central1 MAINTENANCE]",
+			},
+		},
+		{
+			name: "global row matches every region",
+			providers: []Provider{
+				{Name: "Azure", Services: []Service{row("Azure", "storage", "Global", StatusMajorOutage)}},
+			},
+			want: []string{"checkout-api MAJOR_OUTAGE [Azure/Storage/westus2: storage@Global MAJOR_OUTAGE]", "build-pipeline OPERATIONAL", "analytics OPERATIONAL"},
+		},
+		{
+			name: "failed check",
+			providers: []Provider{
+				{Name: "GitHub", Error: "feed unavailable", Services: []Service{row("GitHub", "GitHub", "Global", StatusUnknown)}},
+			},
+			want: []string{"checkout-api OPERATIONAL", "build-pipeline UNKNOWN [GitHub/Actions: Actions@ UNKNOWN]", "analytics OPERATIONAL"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := StatusReport{Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Providers: test.providers}
+			got := impactSummaries(computeImpact(manifest, report))
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// serverEvent is a single Server-Sent Event
+type serverEvent struct {
+	Name string
+	Data []byte
+}
+
+// eventBroker fans published events out to every connected dashboard.
+// Dashboards only listen; reports are still generated once per cycle by
+// the background loop, however many browsers are open.
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan serverEvent]bool
+	closed      bool
+}
+
+// subscriberBuffer is how many events a slow client may fall behind before
+// it is disconnected; the browser reconnects and receives a fresh report
+const subscriberBuffer = 32
+
+// sseKeepAlive is how often an idle stream sends a comment so proxies keep it open
+const sseKeepAlive = 30 * time.Second
+
+var events = &eventBroker{subscribers: make(map[chan serverEvent]bool)}
+
+// Subscribe registers a new listener
+func (b *eventBroker) Subscribe() chan serverEvent {
+	ch := make(chan serverEvent, subscriberBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subscribers[ch] = true
+	return ch
+}
+
+// Close ends every stream, so a graceful shutdown does not wait on them
+func (b *eventBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Unsubscribe removes a listener and closes its channel
+func (b *eventBroker) Unsubscribe(ch chan serverEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[ch] {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish sends an event to every listener without blocking
+func (b *eventBroker) Publish(name string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", name, err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- serverEvent{Name: name, Data: data}:
+		default:
+			// Too far behind; drop it so it reconnects with a full report
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishReport pushes a new report followed by each service that changed
+// since the previous one
+func publishReport(previous, report StatusReport) {
+	events.Publish("report", report)
+	if previous.Timestamp.IsZero() {
+		return
+	}
+	for _, transition := range diffSnapshots(snapshotReport(previous), snapshotReport(report)) {
+		events.Publish("change", transition)
+	}
+}
+
+// handleEvents streams reports and service changes as Server-Sent Events
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	// Start every stream with the current report
+	reportMutex.RLock()
+	initial, err := json.Marshal(currentReport)
+	reportMutex.RUnlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeEvent(w, serverEvent{Name: "report", Data: initial})
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event serverEvent) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, event.Data)
+}
@@ -0,0 +1,825 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statuspageChecker reads an Atlassian Statuspage v2 summary.json feed
+type statuspageChecker struct {
+	ProviderName string
+	StatusURL    string
+	FeedURL      string
+}
+
+func (c *statuspageChecker) Name() string { return c.ProviderName }
+
+func (c *statuspageChecker) URL() string { return c.StatusURL }
+
+func (c *statuspageChecker) Check(ctx context.Context) ([]Service, error) {
+	result, err := c.CheckFeed(ctx)
+	return result.Services, err
+}
+
+func (c *statuspageChecker) CheckFeed(ctx context.Context) (FeedResult, error) {
+	body, err := fetchBody(ctx, c.FeedURL)
+	if err != nil {
+		return FeedResult{}, fmt.Errorf("error checking %s status: %v", c.ProviderName, err)
+	}
+	return parseStatuspageSummary(body, c.ProviderName, time.Now())
+}
+
+// statuspageSummary is the subset of /api/v2/summary.json we use
+type statuspageSummary struct {
+	Components            []statuspageComponent `json:"components"`
+	Incidents             []statuspageIncident  `json:"incidents"`
+	ScheduledMaintenances []statuspageIncident  `json:"scheduled_maintenances"`
+}
+
+type statuspageComponent struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Status  string  `json:"status"`
+	Group   bool    `json:"group"`
+	GroupID *string `json:"group_id"`
+}
+
+type statuspageIncident struct {
+	ID              string                `json:"id"`
+	Name            string                `json:"name"`
+	Status          string                `json:"status"`
+	Impact          string                `json:"impact"`
+	Shortlink       string                `json:"shortlink"`
+	CreatedAt       string                `json:"created_at"`
+	UpdatedAt       string                `json:"updated_at"`
+	StartedAt       string                `json:"started_at"`
+	ResolvedAt      string                `json:"resolved_at"`
+	ScheduledFor    string                `json:"scheduled_for"`
+	ScheduledUntil  string                `json:"scheduled_until"`
+	Components      []statuspageComponent `json:"components"`
+	IncidentUpdates []struct {
+		Body      string `json:"body"`
+		Status    string `json:"status"`
+		CreatedAt string `json:"created_at"`
+	} `json:"incident_updates"`
+}
+
+// parseStatuspageSummary converts a Statuspage summary into one Service per
+// component, plus the incidents and scheduled maintenance it lists
+func parseStatuspageSummary(data []byte, provider string, now time.Time) (FeedResult, error) {
+	var summary statuspageSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return FeedResult{}, fmt.Errorf("error parsing %s summary: %v", provider, err)
+	}
+
+	// Map components to the incident currently affecting them
+	incidentTitles := make(map[string]string)
+	incidentIDs := make(map[string]string)
+	var incidents []Incident
+	for _, incident := range summary.Incidents {
+		incidents = append(incidents, statuspageIncidentDetails(incident, provider))
+		if incident.Status == "resolved" || incident.Status == "postmortem" {
+			continue
+		}
+		for _, component := range incident.Components {
+			incidentTitles[component.ID] = incident.Name
+			incidentIDs[component.ID] = incident.ID
+		}
+	}
+
+	// Component groups usually name a region or product area
+	groupNames := make(map[string]string)
+	for _, component := range summary.Components {
+		if component.Group {
+			groupNames[component.ID] = component.Name
+		}
+	}
+
+	var services []Service
+	for _, component := range summary.Components {
+		if component.Group {
+			continue
+		}
+
+		region := "Global"
+		if component.GroupID != nil {
+			if name, ok := groupNames[*component.GroupID]; ok {
+				region = name
+			}
+		}
+
+		service := Service{
+			Name:      component.Name,
+			Provider:  provider,
+			Status:    statuspageStatus(component.Status),
+			LastCheck: now,
+			Details:   "All services operational",
+			Region:    region,
+		}
+		if component.Status != "operational" {
+			service.Details = humanizeStatus(component.Status)
+		}
+		if title, ok := incidentTitles[component.ID]; ok {
+			service.Details = title
+			service.IncidentID = incidentIDs[component.ID]
+		}
+		services = append(services, service)
+	}
+
+	var windows []Maintenance
+	for _, scheduled := range summary.ScheduledMaintenances {
+		windows = append(windows, statuspageMaintenance(scheduled, provider, groupNames))
+	}
+	return FeedResult{Services: services, Incidents: incidents, Maintenance: windows}, nil
+}
+
+// statuspageMaintenance converts a scheduled maintenance. Its regions are
+// the groups of the components it affects.
+func statuspageMaintenance(scheduled statuspageIncident, provider string, groupNames map[string]string) Maintenance {
+	window := Maintenance{
+		ID:       scheduled.ID,
+		Provider: provider,
+		Title:    scheduled.Name,
+		State:    scheduled.Status,
+		Start:    parseFeedTime(scheduled.ScheduledFor),
+		End:      parseFeedTime(scheduled.ScheduledUntil),
+		Updated:  parseFeedTime(scheduled.UpdatedAt),
+		URL:      scheduled.Shortlink,
+	}
+	regions := make(map[string]bool)
+	for _, component := range scheduled.Components {
+		window.Services = append(window.Services, component.Name)
+		if component.GroupID == nil {
+			continue
+		}
+		if name, ok := groupNames[*component.GroupID]; ok && !regions[name] {
+			regions[name] = true
+			window.Regions = append(window.Regions, name)
+		}
+	}
+	if len(scheduled.IncidentUpdates) > 0 {
+		window.Description = strings.TrimSpace(scheduled.IncidentUpdates[0].Body)
+	}
+	return window
+}
+
+// statuspageIncidentDetails converts a Statuspage incident. An incident in
+// the postmortem state links to its page, where the postmortem is published.
+func statuspageIncidentDetails(incident statuspageIncident, provider string) Incident {
+	result := Incident{
+		ID:       incident.ID,
+		Provider: provider,
+		Title:    incident.Name,
+		Status:   statuspageImpact(incident.Impact),
+		Started:  parseFeedTime(incident.StartedAt),
+		Updated:  parseFeedTime(incident.UpdatedAt),
+		URL:      incident.Shortlink,
+	}
+	if result.Started.IsZero() {
+		result.Started = parseFeedTime(incident.CreatedAt)
+	}
+	if incident.Status == "resolved" || incident.Status == "postmortem" {
+		result.Resolved = parseFeedTime(incident.ResolvedAt)
+		if result.Resolved.IsZero() {
+			result.Resolved = result.Updated
+		}
+	}
+	for _, component := range incident.Components {
+		result.Services = append(result.Services, component.Name)
+	}
+	for _, update := range incident.IncidentUpdates {
+		result.Updates = append(result.Updates, IncidentUpdate{Time: parseFeedTime(update.CreatedAt), Text: strings.TrimSpace(update.Body)})
+		if result.RCAURL == "" {
+			result.RCAURL = findRCALink(update.Body, "")
+		}
+	}
+	if len(result.Updates) > 0 {
+		result.LatestUpdate = result.Updates[0].Text
+		if result.Updated.IsZero() {
+			result.Updated = result.Updates[0].Time
+		}
+	}
+	if incident.Status == "postmortem" && result.RCAURL == "" {
+		result.RCAURL = incident.Shortlink
+	}
+	return result
+}
+
+// humanizeStatus turns a snake_case vendor status into a readable phrase
+func humanizeStatus(status string) string {
+	status = strings.ReplaceAll(status, "_", " ")
+	if status == "" {
+		return status
+	}
+	return strings.ToUpper(status[:1]) + status[1:]
+}
+
+// googleIncidentsChecker reads the incidents.json feed published by
+// Google Cloud and Google Workspace status dashboards. When ProductsURL is
+// set, products.json is used to list unaffected products as well.
+type googleIncidentsChecker struct {
+	ProviderName string
+	StatusURL    string
+	FeedURL      string
+	ProductsURL  string
+	ServiceName  string
+}
+
+func (c *googleIncidentsChecker) Name() string { return c.ProviderName }
+
+func (c *googleIncidentsChecker) URL() string { return c.StatusURL }
+
+func (c *googleIncidentsChecker) Check(ctx context.Context) ([]Service, error) {
+	result, err := c.CheckFeed(ctx)
+	return result.Services, err
+}
+
+// CheckFeed returns the status and incidents; Google's feed does not
+// announce maintenance
+func (c *googleIncidentsChecker) CheckFeed(ctx context.Context) (FeedResult, error) {
+	body, err := fetchBody(ctx, c.FeedURL)
+	if err != nil {
+		return FeedResult{}, fmt.Errorf("error checking %s status: %v", c.ProviderName, err)
+	}
+
+	var products []googleProduct
+	if c.ProductsURL != "" {
+		data, err := fetchBody(ctx, c.ProductsURL)
+		if err == nil {
+			products, err = parseGoogleProducts(data)
+		}
+		if err != nil {
+			log.Printf("Error loading %s product catalog: %v", c.ProviderName, err)
+		}
+	}
+	services, incidents, err := parseGoogleIncidents(body, products, c.ProviderName, c.ServiceName, c.StatusURL, time.Now())
+	return FeedResult{Services: services, Incidents: incidents}, err
+}
+
+type googleIncident struct {
+	ID                         string           `json:"id"`
+	Begin                      string           `json:"begin"`
+	End                        string           `json:"end"`
+	Modified                   string           `json:"modified"`
+	ExternalDesc               string           `json:"external_desc"`
+	Updates                    []googleUpdate   `json:"updates"`
+	StatusImpact               string           `json:"status_impact"`
+	Severity                   string           `json:"severity"`
+	URI                        string           `json:"uri"`
+	AffectedProducts           []googleProduct  `json:"affected_products"`
+	CurrentlyAffectedLocations []googleLocation `json:"currently_affected_locations"`
+}
+
+type googleUpdate struct {
+	When string `json:"when"`
+	Text string `json:"text"`
+}
+
+type googleProduct struct {
+	Title string `json:"title"`
+	ID    string `json:"id"`
+}
+
+type googleLocation struct {
+	Title string `json:"title"`
+	ID    string `json:"id"`
+}
+
+// parseGoogleProducts parses a Google products.json catalog
+func parseGoogleProducts(data []byte) ([]googleProduct, error) {
+	var catalog struct {
+		Products []googleProduct `json:"products"`
+	}
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, err
+	}
+	return catalog.Products, nil
+}
+
+// googleIncidentFollowUp is how long after the end of a Google incident it
+// is still reported, so an incident report published later is picked up
+const googleIncidentFollowUp = 14 * 24 * time.Hour
+
+// parseGoogleIncidents converts the open incidents in a Google incidents.json
+// feed into one Service per affected product and location. Products from the
+// catalog that have no open incident are reported as Operational; with no
+// catalog and no incidents a single Operational Service is returned.
+// Incidents that are open or ended recently are returned as well.
+func parseGoogleIncidents(data []byte, products []googleProduct, provider, serviceName, statusURL string, now time.Time) ([]Service, []Incident, error) {
+	var incidents []googleIncident
+	if err := json.Unmarshal(data, &incidents); err != nil {
+		return nil, nil, fmt.Errorf("error parsing %s incidents: %v", provider, err)
+	}
+
+	var services []Service
+	var details []Incident
+	affected := make(map[string]bool)
+	for _, incident := range incidents {
+		if incident.End != "" {
+			if end := parseFeedTime(incident.End); !end.IsZero() && now.Sub(end) < googleIncidentFollowUp {
+				details = append(details, googleIncidentDetails(incident, provider, statusURL))
+			}
+			continue
+		}
+		details = append(details, googleIncidentDetails(incident, provider, statusURL))
+
+		status := googleStatus(incident.StatusImpact, incident.Severity)
+
+		regions := []string{"Global"}
+		if len(incident.CurrentlyAffectedLocations) > 0 {
+			regions = regions[:0]
+			for _, location := range incident.CurrentlyAffectedLocations {
+				if location.ID != "" {
+					regions = append(regions, location.ID)
+				} else {
+					regions = append(regions, location.Title)
+				}
+			}
+		}
+
+		for _, product := range incident.AffectedProducts {
+			affected[product.Title] = true
+			for _, region := range regions {
+				services = append(services, Service{
+					Name:       product.Title,
+					Provider:   provider,
+					Status:     status,
+					LastCheck:  now,
+					Details:    strings.TrimSpace(incident.ExternalDesc),
+					Region:     region,
+					IncidentID: incident.ID,
+				})
+			}
+		}
+	}
+
+	for _, product := range products {
+		if affected[product.Title] {
+			continue
+		}
+		services = append(services, Service{
+			Name:      product.Title,
+			Provider:  provider,
+			Status:    StatusOperational,
+			LastCheck: now,
+			Details:   "All services operational",
+			Region:    "Global",
+		})
+	}
+
+	if len(services) == 0 {
+		services = append(services, Service{
+			Name:      serviceName,
+			Provider:  provider,
+			Status:    StatusOperational,
+			LastCheck: now,
+			Details:   "All services operational",
+			Region:    "Global",
+		})
+	}
+
+	// Affected products first, then alphabetical
+	sort.SliceStable(services, func(i, j int) bool {
+		if affected[services[i].Name] != affected[services[j].Name] {
+			return affected[services[i].Name]
+		}
+		if services[i].Name != services[j].Name {
+			return services[i].Name < services[j].Name
+		}
+		return services[i].Region < services[j].Region
+	})
+	return services, details, nil
+}
+
+// googleIncidentDetails converts a Google incident. Google publishes its
+// incident report as a final update on the incident page.
+func googleIncidentDetails(incident googleIncident, provider, statusURL string) Incident {
+	result := Incident{
+		ID:       incident.ID,
+		Provider: provider,
+		Title:    strings.TrimSpace(incident.ExternalDesc),
+		Status:   googleStatus(incident.StatusImpact, incident.Severity),
+		Started:  parseFeedTime(incident.Begin),
+		Updated:  parseFeedTime(incident.Modified),
+		Resolved: parseFeedTime(incident.End),
+	}
+	if incident.URI != "" {
+		result.URL = strings.TrimSuffix(statusURL, "/") + "/" + strings.TrimPrefix(incident.URI, "/")
+	}
+	for _, product := range incident.AffectedProducts {
+		result.Services = append(result.Services, product.Title)
+	}
+	for _, location := range incident.CurrentlyAffectedLocations {
+		result.Regions = append(result.Regions, location.Title)
+	}
+
+	updates := append([]googleUpdate(nil), incident.Updates...)
+	sort.SliceStable(updates, func(i, j int) bool {
+		return parseFeedTime(updates[i].When).After(parseFeedTime(updates[j].When))
+	})
+	for _, update := range updates {
+		result.Updates = append(result.Updates, IncidentUpdate{Time: parseFeedTime(update.When), Text: strings.TrimSpace(update.Text)})
+		if result.RCAURL == "" {
+			result.RCAURL = findRCALink(update.Text, result.URL)
+		}
+	}
+	if len(result.Updates) > 0 {
+		result.LatestUpdate = result.Updates[0].Text
+		if result.Updated.IsZero() {
+			result.Updated = result.Updates[0].Time
+		}
+	}
+	return result
+}
+
+// feedChecker reads an RSS or Atom incident feed. Each feed entry is treated
+// as an incident; the latest entry per key decides whether it is still open.
+type feedChecker struct {
+	ProviderName string
+	StatusURL    string
+	FeedURL      string
+	ServiceName  string
+	// Window is how long a resolved incident stays listed; zero means 24
+	// hours. Open incidents stay listed until they go feedStaleWindows
+	// windows without an update.
+	Window time.Duration
+}
+
+func (c *feedChecker) Name() string { return c.ProviderName }
+
+func (c *feedChecker) URL() string { return c.StatusURL }
+
+func (c *feedChecker) Check(ctx context.Context) ([]Service, error) {
+	result, err := c.CheckFeed(ctx)
+	return result.Services, err
+}
+
+// CheckFeed returns the status and incidents. RSS and Atom entries have no
+// start and end times, so no maintenance windows are read from them.
+func (c *feedChecker) CheckFeed(ctx context.Context) (FeedResult, error) {
+	body, err := fetchBody(ctx, c.FeedURL)
+	if err != nil {
+		return FeedResult{}, fmt.Errorf("error checking %s status: %v", c.ProviderName, err)
+	}
+
+	items, err := parseFeed(body)
+	if err != nil {
+		return FeedResult{}, fmt.Errorf("error parsing %s feed: %v", c.ProviderName, err)
+	}
+
+	window := c.Window
+	if window == 0 {
+		window = 24 * time.Hour
+	}
+	services, incidents := feedItemsToServices(items, c.ProviderName, c.ServiceName, window, time.Now())
+	return FeedResult{Services: services, Incidents: incidents}, nil
+}
+
+// feedItem is a single RSS item or Atom entry. RSS items have one date, so
+// Published and Updated are the same; an Atom entry that is edited as its
+// incident progresses keeps its published date.
+type feedItem struct {
+	Title       string
+	Link        string
+	GUID        string
+	Description string
+	Published   time.Time
+	Updated     time.Time
+}
+
+type rssDocument struct {
+	Channel struct {
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			GUID        string `xml:"guid"`
+			Description string `xml:"description"`
+			PubDate     string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomDocument struct {
+	Entries []struct {
+		Title string `xml:"title"`
+		ID    string `xml:"id"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Updated   string `xml:"updated"`
+		Published string `xml:"published"`
+	} `xml:"entry"`
+}
+
+// parseFeed parses an RSS 2.0 or Atom document
+func parseFeed(data []byte) ([]feedItem, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	var items []feedItem
+	switch root.XMLName.Local {
+	case "rss":
+		var doc rssDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		for _, item := range doc.Channel.Items {
+			published := parseFeedTime(item.PubDate)
+			items = append(items, feedItem{
+				Title:       strings.TrimSpace(item.Title),
+				Link:        strings.TrimSpace(item.Link),
+				GUID:        strings.TrimSpace(item.GUID),
+				Description: strings.TrimSpace(item.Description),
+				Published:   published,
+				Updated:     published,
+			})
+		}
+	case "feed":
+		var doc atomDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		for _, entry := range doc.Entries {
+			item := feedItem{
+				Title:       strings.TrimSpace(entry.Title),
+				GUID:        strings.TrimSpace(entry.ID),
+				Description: strings.TrimSpace(entry.Summary),
+				Published:   parseFeedTime(entry.Published),
+				Updated:     parseFeedTime(entry.Updated),
+			}
+			if item.Description == "" {
+				item.Description = strings.TrimSpace(entry.Content)
+			}
+			if item.Published.IsZero() {
+				item.Published = item.Updated
+			}
+			if item.Updated.IsZero() {
+				item.Updated = item.Published
+			}
+			for _, link := range entry.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					item.Link = link.Href
+					break
+				}
+			}
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported feed type %q", root.XMLName.Local)
+	}
+	return items, nil
+}
+
+var feedTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	time.RFC3339,
+}
+
+// feedZoneOffsets are the zone abbreviations seen in feeds. time.Parse gives
+// an abbreviation it does not know a zero offset, which would put AWS's
+// "PDT" timestamps hours out.
+var feedZoneOffsets = map[string]int{
+	"EST": -5 * 3600, "EDT": -4 * 3600,
+	"CST": -6 * 3600, "CDT": -5 * 3600,
+	"MST": -7 * 3600, "MDT": -6 * 3600,
+	"PST": -8 * 3600, "PDT": -7 * 3600,
+}
+
+func parseFeedTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range feedTimeLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if name, offset := t.Zone(); offset == 0 {
+			if fixed, ok := feedZoneOffsets[name]; ok {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.FixedZone(name, fixed))
+			}
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+var (
+	awsRegionPattern = regexp.MustCompile(`(?:af|ap|ca|cn|eu|il|me|mx|sa|us)(?:-gov)?-[a-z]+-\d+$`)
+	htmlTagPattern   = regexp.MustCompile(`<[^>]*>`)
+	// awsGUIDPattern matches the service and timestamp in an AWS GUID
+	awsGUIDPattern = regexp.MustCompile(`#([a-z0-9-]+)_\d+$`)
+	// feedTitlePrefixPattern matches the state some feeds put before a title
+	feedTitlePrefixPattern = regexp.MustCompile(`(?i)^\s*(?:\[(?:resolved|mitigated|updated?)\]|(?:resolved|mitigated|updated?)\s*:)\s*`)
+	// feedUpdateStatePattern matches the state of the newest update in
+	// Statuspage-style content, e.g. "<strong>Resolved</strong> - ..."
+	feedUpdateStatePattern = regexp.MustCompile(`<strong>\s*([A-Za-z ]+?)\s*</strong>\s*-`)
+)
+
+// feedResolvedPhrases mark an entry body that announces a resolution
+var feedResolvedPhrases = []string{
+	"has been resolved", "have been resolved", "is now resolved",
+	"has been mitigated", "have been mitigated",
+	"is operating normally", "are operating normally",
+}
+
+// feedStaleWindows is how many windows an open incident may go without an
+// update before it is dropped. Some feeds never post a resolution.
+const feedStaleWindows = 7
+
+// feedItemKey identifies the incident an entry belongs to. AWS GUIDs carry
+// the service in the fragment, e.g. "...#ec2-us-east-1_1700000000", so all
+// entries about a service share a key. Other GUIDs and Atom IDs name the
+// incident. Without one the title is used, less any "Resolved:" prefix, so
+// that the entry closing an incident shares the key of the one opening it.
+func feedItemKey(item feedItem) string {
+	if m := awsGUIDPattern.FindStringSubmatch(item.GUID); m != nil {
+		return m[1]
+	}
+	if item.GUID != "" {
+		return item.GUID
+	}
+	return feedItemTitle(item)
+}
+
+// feedItemTitle returns the title without the state prefixes of feedItemKey
+func feedItemTitle(item feedItem) string {
+	title := item.Title
+	for {
+		trimmed := feedTitlePrefixPattern.ReplaceAllString(title, "")
+		if trimmed == title {
+			return title
+		}
+		title = trimmed
+	}
+}
+
+// feedItemResolved reports whether an entry announces the end of an
+// incident. The title is checked first. Statuspage-style content lists the
+// updates newest first, so the state of the first one decides; any other
+// body is searched for a phrase announcing a resolution.
+func feedItemResolved(item feedItem) bool {
+	title := strings.ToLower(item.Title)
+	if strings.Contains(title, "resolved") ||
+		strings.Contains(title, "mitigated") ||
+		strings.Contains(title, "operating normally") {
+		return true
+	}
+	if m := feedUpdateStatePattern.FindStringSubmatch(item.Description); m != nil {
+		switch strings.ToLower(m[1]) {
+		case "resolved", "completed", "postmortem":
+			return true
+		}
+		return false
+	}
+	text := strings.ToLower(feedItemText(item))
+	for _, phrase := range feedResolvedPhrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// feedItemsToServices turns the entries into one Service per open incident,
+// and one Incident per key. All entries sharing a key are updates to the
+// same incident. Incidents resolved before the window are left out, as are
+// open ones without an update for feedStaleWindows windows; the incident
+// tracker resolves those once they are gone.
+func feedItemsToServices(items []feedItem, provider, serviceName string, window time.Duration, now time.Time) ([]Service, []Incident) {
+	byKey := make(map[string][]feedItem)
+	for _, item := range items {
+		key := feedItemKey(item)
+		byKey[key] = append(byKey[key], item)
+	}
+
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var services []Service
+	var incidents []Incident
+	for _, key := range keys {
+		// Newest first
+		entries := byKey[key]
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Updated.After(entries[j].Updated) })
+		item := entries[0]
+		if age := now.Sub(item.Updated); !item.Updated.IsZero() &&
+			(age > feedStaleWindows*window || age > window && feedItemResolved(item)) {
+			continue
+		}
+
+		name := feedItemTitle(item)
+		region := "Global"
+		if r := awsRegionPattern.FindString(key); r != "" {
+			region = r
+			name = strings.TrimSuffix(strings.TrimSuffix(key, r), "-")
+		}
+
+		incident := feedIncident(entries, key, provider, name, region)
+		incidents = append(incidents, incident)
+		if !incident.Open() {
+			continue
+		}
+
+		services = append(services, Service{
+			Name:       name,
+			Provider:   provider,
+			Status:     feedItemStatus(item),
+			LastCheck:  now,
+			Details:    feedItemDetails(item),
+			Region:     region,
+			IncidentID: incident.ID,
+		})
+	}
+
+	if len(services) == 0 {
+		services = append(services, Service{
+			Name:      serviceName,
+			Provider:  provider,
+			Status:    StatusOperational,
+			LastCheck: now,
+			Details:   "All services operational",
+			Region:    "Global",
+		})
+	}
+	return services, incidents
+}
+
+// feedIncident builds an incident from the entries sharing a key, newest
+// first. The oldest entry names and dates it, so its ID stays stable while
+// updates are posted.
+func feedIncident(entries []feedItem, key, provider, service, region string) Incident {
+	first, latest := entries[len(entries)-1], entries[0]
+	incident := Incident{
+		ID:       key + "@" + first.Published.UTC().Format("20060102T150405Z"),
+		Provider: provider,
+		Title:    feedItemTitle(first),
+		Status:   StatusOperational,
+		Services: []string{service},
+		Started:  first.Published,
+		Updated:  latest.Updated,
+		URL:      latest.Link,
+	}
+	if region != "Global" {
+		incident.Regions = []string{region}
+	}
+	for _, entry := range entries {
+		text := entry.Title
+		if body := feedItemText(entry); body != "" && body != entry.Title {
+			text += "\n" + body
+		}
+		incident.Updates = append(incident.Updates, IncidentUpdate{Time: entry.Updated, Text: text})
+		if !feedItemResolved(entry) {
+			incident.Status = worstStatus(incident.Status, feedItemStatus(entry))
+		}
+		if incident.RCAURL == "" {
+			incident.RCAURL = findRCALink(entry.Description, "")
+		}
+	}
+	incident.LatestUpdate = incident.Updates[0].Text
+	if feedItemResolved(latest) {
+		incident.Resolved = latest.Updated
+	}
+	if incident.Status == StatusOperational {
+		// Every entry announces a resolution; judge it by the first one
+		incident.Status = feedItemStatus(first)
+	}
+	return incident
+}
+
+// feedItemText returns the entry body as plain text
+func feedItemText(item feedItem) string {
+	text := html.UnescapeString(htmlTagPattern.ReplaceAllString(item.Description, " "))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// feedItemDetails returns the entry title plus a plain-text excerpt of its body
+func feedItemDetails(item feedItem) string {
+	text := feedItemText(item)
+	if runes := []rune(text); len(runes) > 200 {
+		text = string(runes[:200]) + "..."
+	}
+	if text == "" || text == item.Title {
+		return item.Title
+	}
+	return item.Title + ": " + text
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serviceRow is the part of a Service the parser tests compare
+type serviceRow struct {
+	Name, Region string
+	Status       Status
+	Details      string
+	IncidentID   string
+}
+
+func serviceRows(services []Service) []serviceRow {
+	var rows []serviceRow
+	for _, service := range services {
+		rows = append(rows, serviceRow{service.Name, service.Region, service.Status, service.Details, service.IncidentID})
+	}
+	return rows
+}
+
+// incidentRow is the part of an Incident the parser tests compare
+type incidentRow struct {
+	ID       string
+	Status   Status
+	Open     bool
+	Services []string
+	Regions  []string
+	URL      string
+	RCAURL   string
+}
+
+func incidentRows(incidents []Incident) []incidentRow {
+	var rows []incidentRow
+	for _, incident := range incidents {
+		rows = append(rows, incidentRow{incident.ID, incident.Status, incident.Open(), incident.Services, incident.Regions, incident.URL, incident.RCAURL})
+	}
+	return rows
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseStatuspageSummary(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 45, 0, 0, time.UTC)
+	result, err := parseStatuspageSummary(readFixture(t, "statuspage_summary.json"), "Example", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantServices := []serviceRow{
+		{"Compute", "US East", StatusPartialOutage, "Elevated error rates launching instances", "inc-compute"},
+		{"Object Storage", "US East", StatusOperational, "All services operational", ""},
+		// The DNS incident is in its postmortem, so it no longer names the component
+		{"DNS", "Global", StatusDegraded, "Degraded performance", ""},
+		{"API", "Global", StatusMaintenance, "Under maintenance", ""},
+	}
+	if got := serviceRows(result.Services); !reflect.DeepEqual(got, wantServices) {
+		t.Errorf("services\n got %+v\nwant %+v", got, wantServices)
+	}
+
+	wantIncidents := []incidentRow{
+		{"inc-compute", StatusPartialOutage, true, []string{"Compute"}, nil, "https://stspg.io/abc123", ""},
+		{"inc-dns", StatusDegraded, false, []string{"DNS"}, nil, "https://stspg.io/def456", "https://stspg.io/def456"},
+	}
+	if got := incidentRows(result.Incidents); !reflect.DeepEqual(got, wantIncidents) {
+		t.Errorf("incidents\n got %+v\nwant %+v", got, wantIncidents)
+	}
+	compute := result.Incidents[0]
+	if !compute.Started.Equal(time.Date(2024, 5, 1, 9, 58, 0, 0, time.UTC)) || len(compute.Updates) != 2 ||
+		!strings.HasPrefix(compute.LatestUpdate, "We have identified") {
+		t.Errorf("inc-compute started %s with %d updates, latest %q", compute.Started, len(compute.Updates), compute.LatestUpdate)
+	}
+	if resolved := result.Incidents[1].Resolved; !resolved.Equal(time.Date(2024, 4, 30, 22, 15, 0, 0, time.UTC)) {
+		t.Errorf("inc-dns resolved at %s, want its resolved_at", resolved)
+	}
+
+	if len(result.Maintenance) != 1 {
+		t.Fatalf("got %d maintenance windows, want 1", len(result.Maintenance))
+	}
+	window := result.Maintenance[0]
+	if window.ID != "mnt-api" || window.State != "in_progress" ||
+		!reflect.DeepEqual(window.Services, []string{"API", "Object Storage"}) || !reflect.DeepEqual(window.Regions, []string{"US East"}) ||
+		!window.Start.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) || !window.End.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("maintenance %+v", window)
+	}
+}
+
+func TestParseGoogleIncidents(t *testing.T) {
+	products, err := parseGoogleProducts(readFixture(t, "google_products.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const statusURL = "https://status.cloud.google.com/"
+	sqlDetails := "Cloud SQL instances in us-central1 and europe-west1 are experiencing elevated connection failures."
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		products     []googleProduct
+		wantServices []serviceRow
+	}{
+		{
+			name:     "with product catalog",
+			products: products,
+			wantServices: []serviceRow{
+				{"Cloud SQL", "europe-west1", StatusPartialOutage, sqlDetails, "kXo1nK7bcPzRq4EtJuCy"},
+				{"Cloud SQL", "us-central1", StatusPartialOutage, sqlDetails, "kXo1nK7bcPzRq4EtJuCy"},
+				{"BigQuery", "Global", StatusOperational, "All services operational", ""},
+				{"Cloud Storage", "Global", StatusOperational, "All services operational", ""},
+				{"Compute Engine", "Global", StatusOperational, "All services operational", ""},
+			},
+		},
+		{
+			name: "without product catalog",
+			wantServices: []serviceRow{
+				{"Cloud SQL", "europe-west1", StatusPartialOutage, sqlDetails, "kXo1nK7bcPzRq4EtJuCy"},
+				{"Cloud SQL", "us-central1", StatusPartialOutage, sqlDetails, "kXo1nK7bcPzRq4EtJuCy"},
+			},
+		},
+	}
+	// The BigQuery incident ended more than googleIncidentFollowUp ago
+	wantIncidents := []incidentRow{
+		{"kXo1nK7bcPzRq4EtJuCy", StatusPartialOutage, true, []string{"Cloud SQL"}, []string{"Iowa (us-central1)", "Belgium (europe-west1)"},
+			statusURL + "incidents/kXo1nK7bcPzRq4EtJuCy", ""},
+		{"pQ9rS2tUvW3xY4zA5bC6", StatusMajorOutage, false, []string{"Cloud Storage"}, nil,
+			statusURL + "incidents/pQ9rS2tUvW3xY4zA5bC6", statusURL + "incidents/pQ9rS2tUvW3xY4zA5bC6/incident-report"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			services, incidents, err := parseGoogleIncidents(readFixture(t, "google_incidents.json"), test.products, "Google Cloud", "Google Cloud Platform", statusURL, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := serviceRows(services); !reflect.DeepEqual(got, test.wantServices) {
+				t.Errorf("services\n got %+v\nwant %+v", got, test.wantServices)
+			}
+			if got := incidentRows(incidents); !reflect.DeepEqual(got, wantIncidents) {
+				t.Errorf("incidents\n got %+v\nwant %+v", got, wantIncidents)
+			}
+			if latest := incidents[0].LatestUpdate; !strings.HasPrefix(latest, "Mitigation is being rolled out") {
+				t.Errorf("latest update %q, want the newest one", latest)
+			}
+		})
+	}
+
+	services, incidents, err := parseGoogleIncidents([]byte("[]"), nil, "Google Cloud", "Google Cloud Platform", statusURL, now)
+	if err != nil || len(incidents) != 0 || !reflect.DeepEqual(serviceRows(services), []serviceRow{{"Google Cloud Platform", "Global", StatusOperational, "All services operational", ""}}) {
+		t.Errorf("empty feed: got %+v, %+v, %v; want a single operational row", services, incidents, err)
+	}
+}
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		fixture       string
+		now           time.Time
+		wantServices  []serviceRow
+		wantIncidents []incidentRow
+	}{
+		{
+			fixture: "aws_all.rss",
+			now:     time.Date(2024, 5, 1, 17, 30, 0, 0, time.UTC),
+			wantServices: []serviceRow{
+				{"ec2", "us-east-1", StatusPartialOutage,
+					"Informational message: Increased API Error Rates: We are investigating increased API error rates for a subset of instances in the US-EAST-1 Region.",
+					"ec2-us-east-1@20240501T172000Z"},
+				{"rds", "us-west-2", StatusDegraded,
+					"Increased Error Rates: We are investigating increased error rates for RDS instance creation in the US-WEST-2 Region.",
+					"rds-us-west-2@20240429T160000Z"},
+			},
+			// Lambda was resolved before the window; RDS is older than the
+			// window but was never resolved, so it is still open
+			wantIncidents: []incidentRow{
+				{"ec2-us-east-1@20240501T172000Z", StatusPartialOutage, true, []string{"ec2"}, []string{"us-east-1"}, "http://status.aws.amazon.com/", ""},
+				{"rds-us-west-2@20240429T160000Z", StatusDegraded, true, []string{"rds"}, []string{"us-west-2"}, "http://status.aws.amazon.com/", ""},
+				{"s3-eu-west-1@20240501T151500Z", StatusDegraded, false, []string{"s3"}, []string{"eu-west-1"}, "http://status.aws.amazon.com/", ""},
+			},
+		},
+		{
+			fixture: "github_history.atom",
+			now:     time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC),
+			wantServices: []serviceRow{
+				{"Incident with Actions", "Global", StatusDegraded,
+					"Incident with Actions: May 1 , 10:35 UTC Update - Actions is experiencing degraded availability. We are continuing to investigate. " +
+						"May 1 , 10:05 UTC Investigating - We are investigating reports of degraded performance for A...",
+					"tag:www.githubstatus.com,2005:Incident/20481234@20240501T100500Z"},
+			},
+			// Each entry is one incident, whose content lists its updates
+			// newest first. Pages was resolved before the window.
+			wantIncidents: []incidentRow{
+				{"tag:www.githubstatus.com,2005:Incident/20470000@20240501T060000Z", StatusDegraded, false, []string{"Disruption with some GitHub services"}, nil, "https://www.githubstatus.com/incidents/a9b8c7", ""},
+				{"tag:www.githubstatus.com,2005:Incident/20481234@20240501T100500Z", StatusDegraded, true, []string{"Incident with Actions"}, nil, "https://www.githubstatus.com/incidents/x1y2z3", ""},
+			},
+		},
+		{
+			fixture: "oci_incidents.rss",
+			now:     time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			wantServices: []serviceRow{
+				{"Service Disruption: Object Storage in US East (Ashburn)", "Global", StatusMajorOutage,
+					"Service Disruption: Object Storage in US East (Ashburn): Customers may experience elevated error rates when accessing Object Storage buckets.",
+					"ocid1.oraclecloudincident.oc1.iad.aaaa@20240501T095000Z"},
+			},
+			// London is resolved in the body; Frankfurt has had no update
+			// for more than feedStaleWindows windows
+			wantIncidents: []incidentRow{
+				{"ocid1.oraclecloudincident.oc1.iad.aaaa@20240501T095000Z", StatusMajorOutage, true,
+					[]string{"Service Disruption: Object Storage in US East (Ashburn)"}, nil, "https://ocistatus.oraclecloud.com/#/incidents/ocid1.oraclecloudincident.oc1.iad.aaaa", ""},
+				{"ocid1.oraclecloudincident.oc1.lhr.bbbb@20240501T073000Z", StatusPartialOutage, false,
+					[]string{"Compute instance launch failures in UK South (London)"}, nil, "https://ocistatus.oraclecloud.com/#/incidents/ocid1.oraclecloudincident.oc1.lhr.bbbb", ""},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			items, err := parseFeed(readFixture(t, test.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			services, incidents := feedItemsToServices(items, "Provider", "Provider Services", 24*time.Hour, test.now)
+			if got := serviceRows(services); !reflect.DeepEqual(got, test.wantServices) {
+				t.Errorf("services\n got %+v\nwant %+v", got, test.wantServices)
+			}
+			if got := incidentRows(incidents); !reflect.DeepEqual(got, test.wantIncidents) {
+				t.Errorf("incidents\n got %+v\nwant %+v", got, test.wantIncidents)
+			}
+		})
+	}
+
+	if _, err := parseFeed([]byte(`<html><body>Not a feed</body></html>`)); err == nil {
+		t.Errorf("parseFeed accepted an HTML page")
+	}
+}
+
+func TestFeedEntriesWithoutGUID(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2024, 5, 1, hour, 0, 0, 0, time.UTC) }
+	entry := func(title, body string, hour int) feedItem {
+		return feedItem{Title: title, Description: body, Published: at(hour), Updated: at(hour)}
+	}
+	tests := []struct {
+		name     string
+		items    []feedItem
+		now      time.Time
+		wantOpen []string
+	}{
+		{
+			name:     "resolved by a prefixed title",
+			items:    []feedItem{entry("Resolved: Storage latency in West Europe", "", 9), entry("Storage latency in West Europe", "We are investigating.", 8)},
+			now:      at(10),
+			wantOpen: nil,
+		},
+		{
+			name:     "resolved by a bracketed title",
+			items:    []feedItem{entry("[RESOLVED] Storage latency", "", 9), entry("Storage latency", "We are investigating.", 8)},
+			now:      at(10),
+			wantOpen: nil,
+		},
+		{
+			name:     "resolved in the body",
+			items:    []feedItem{entry("Storage latency", "Mitigation is complete and the issue has been resolved.", 9), entry("Storage latency", "We are investigating.", 8)},
+			now:      at(10),
+			wantOpen: nil,
+		},
+		{
+			name:     "an older update mentions resolving",
+			items:    []feedItem{entry("Storage latency", "<p><strong>Monitoring</strong> - A fix is in place; we expect the issue to be resolved soon.</p>", 9)},
+			now:      at(10),
+			wantOpen: []string{"Storage latency"},
+		},
+		{
+			name:     "open past the window",
+			items:    []feedItem{entry("Storage latency", "We are investigating.", 8)},
+			now:      at(8).Add(6 * 24 * time.Hour),
+			wantOpen: []string{"Storage latency"},
+		},
+		{
+			name:     "stale",
+			items:    []feedItem{entry("Storage latency", "We are investigating.", 8)},
+			now:      at(8).Add(feedStaleWindows*24*time.Hour + time.Minute),
+			wantOpen: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, incidents := feedItemsToServices(test.items, "Azure", "Azure Services", 24*time.Hour, test.now)
+			var open []string
+			for _, incident := range incidents {
+				if incident.Open() {
+					open = append(open, incident.Title)
+				}
+			}
+			if !reflect.DeepEqual(open, test.wantOpen) {
+				t.Errorf("open incidents %q, want %q", open, test.wantOpen)
+			}
+			if len(incidents) > 1 {
+				t.Errorf("got %d incidents, want the entries merged into one", len(incidents))
+			}
+		})
+	}
+}
+
+func TestKeywordCheckerIsLowConfidence(t *testing.T) {
+	page := readFixture(t, "oci_status.html")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(page)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		down        []string
+		wantStatus  Status
+		wantDetails string
+	}{
+		{[]string{"Service Disruption", "Service Outage"}, StatusPartialOutage, "Service disruption or outage detected" + keywordConfidence},
+		{[]string{"Service Outage"}, StatusOperational, "All services operational" + keywordConfidence},
+	}
+	for _, test := range tests {
+		checker := &keywordChecker{
+			ProviderName: "Oracle Cloud",
+			StatusURL:    server.URL,
+			ServiceName:  "Oracle Cloud Infrastructure",
+			DownKeywords: test.down,
+			DownDetails:  "Service disruption or outage detected",
+		}
+		services, err := checker.Check(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(services) != 1 || services[0].Status != test.wantStatus || services[0].Details != test.wantDetails {
+			t.Errorf("down keywords %q: got %+v, want %s with details %q", test.down, services, test.wantStatus, test.wantDetails)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// draining is set once shutdown has begun, so /readyz takes the instance
+// out of rotation while in-flight requests finish
+var draining atomic.Bool
+
+// startTime is when the process started
+var startTime = time.Now()
+
+// Readiness is the response of /readyz
+type Readiness struct {
+	Ready bool
+	// Reason explains why the instance is not ready
+	Reason     string    `json:",omitempty"`
+	LastReport time.Time `json:",omitempty"`
+	LastCycle  time.Time `json:",omitempty"`
+}
+
+// handleHealthz reports that the process is alive and serving
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"uptime": time.Since(startTime).Round(time.Second).String(),
+	})
+}
+
+// handleReadyz reports whether a report has been generated and the last
+// cycle finished within ready_intervals report intervals
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	readiness := checkReadiness(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	if !readiness.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(readiness)
+}
+
+func checkReadiness(now time.Time) Readiness {
+	reportMutex.RLock()
+	readiness := Readiness{LastReport: currentReport.Timestamp, LastCycle: refresher.LastFinished()}
+	reportMutex.RUnlock()
+
+	interval, intervals := 5*time.Minute, 3
+	if config := currentConfig(); config != nil {
+		interval, intervals = config.Interval, config.ReadyIntervals
+	}
+
+	switch {
+	case draining.Load():
+		readiness.Reason = "shutting down"
+	case readiness.LastReport.IsZero():
+		readiness.Reason = "no report generated yet"
+	case now.Sub(readiness.LastCycle) > time.Duration(intervals)*interval:
+		readiness.Reason = "last report cycle finished " + now.Sub(readiness.LastCycle).Round(time.Second).String() + " ago"
+	default:
+		readiness.Ready = true
+	}
+	return readiness
+}
+
+// withHealth serves the health endpoints ahead of authentication, so
+// orchestrators can probe them without credentials
+func withHealth(next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
+	mux.Handle("/", next)
+	return mux
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useReadiness sets the last report and report cycle for the duration of
+// the test
+func useReadiness(t *testing.T, lastReport, lastCycle time.Time) {
+	t.Helper()
+	reportMutex.Lock()
+	previous := currentReport
+	currentReport = StatusReport{Timestamp: lastReport}
+	reportMutex.Unlock()
+	refresher.mu.Lock()
+	finished := refresher.finished
+	refresher.finished = lastCycle
+	refresher.mu.Unlock()
+	t.Cleanup(func() {
+		reportMutex.Lock()
+		currentReport = previous
+		reportMutex.Unlock()
+		refresher.mu.Lock()
+		refresher.finished = finished
+		refresher.mu.Unlock()
+		draining.Store(false)
+	})
+}
+
+func TestCheckReadiness(t *testing.T) {
+	restoreGlobals(t)
+	configMutex.Lock()
+	activeConfig = &Config{Interval: time.Minute, ReadyIntervals: 3}
+	configMutex.Unlock()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		lastReport time.Time
+		lastCycle  time.Time
+		draining   bool
+		wantReason string
+	}{
+		{name: "no report yet", wantReason: "no report generated yet"},
+		{name: "fresh", lastReport: now.Add(-time.Minute), lastCycle: now.Add(-time.Minute)},
+		{name: "within ready_intervals", lastReport: now.Add(-3 * time.Minute), lastCycle: now.Add(-3 * time.Minute)},
+		{name: "stale", lastReport: now.Add(-4 * time.Minute), lastCycle: now.Add(-4 * time.Minute),
+			wantReason: "last report cycle finished 4m0s ago"},
+		// An aborted cycle keeps the instance ready while the old report is recent
+		{name: "cycle without a report", lastReport: now.Add(-10 * time.Minute), lastCycle: now.Add(-time.Minute)},
+		{name: "draining", lastReport: now.Add(-time.Minute), lastCycle: now.Add(-time.Minute), draining: true,
+			wantReason: "shutting down"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useReadiness(t, test.lastReport, test.lastCycle)
+			draining.Store(test.draining)
+			readiness := checkReadiness(now)
+			if readiness.Ready != (test.wantReason == "") || readiness.Reason != test.wantReason {
+				t.Errorf("got %+v, want reason %q", readiness, test.wantReason)
+			}
+		})
+	}
+}
+
+func TestReadyzSkipsAuthentication(t *testing.T) {
+	auth := defaultAuthConfig()
+	auth.Mode = authProxy
+	useAuth(t, auth)
+	configMutex.Lock()
+	activeConfig.Interval, activeConfig.ReadyIntervals = time.Minute, 3
+	configMutex.Unlock()
+	handler := withHealth(withAuth(http.NotFoundHandler()))
+
+	now := time.Now()
+	useReadiness(t, now, now)
+	for _, step := range []struct {
+		draining   bool
+		wantStatus int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusServiceUnavailable},
+	} {
+		draining.Store(step.draining)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "http://192.0.2.10/readyz", nil))
+		if w.Code != step.wantStatus || !strings.Contains(w.Body.String(), `"Ready"`) {
+			t.Errorf("draining %v: status %d (%s), want %d", step.draining, w.Code, w.Body.String(), step.wantStatus)
+		}
+	}
+}
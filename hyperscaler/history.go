@@ -0,0 +1,612 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Transition records a service changing status between two reports
+type Transition struct {
+	Time     time.Time
+	Provider string
+	Service  string
+	Region   string
+	From     Status
+	To       Status
+	Details  string
+}
+
+// ProviderSnapshot is the rolled-up status of a provider in one report
+type ProviderSnapshot struct {
+	Name   string
+	Status Status
+	Down   int
+	Total  int
+}
+
+// ReportSnapshot is the part of a StatusReport kept in history. Only
+// services that are not operational are kept; the rest are implied.
+type ReportSnapshot struct {
+	Timestamp time.Time
+	Providers []ProviderSnapshot
+	Services  []Service
+}
+
+// Outage is a window during which a provider had a known problem
+type Outage struct {
+	Provider string
+	Start    time.Time
+	End      time.Time `json:",omitempty"`
+	Ongoing  bool
+	// Worst is the most severe status seen during the window
+	Worst Status
+}
+
+// historyRecord is a single line of the history file
+type historyRecord struct {
+	Report     *ReportSnapshot `json:",omitempty"`
+	Transition *Transition     `json:",omitempty"`
+	// Incident is written when an incident opens, resolves or gets a
+	// postmortem link; the last record for an incident wins
+	Incident *Incident `json:",omitempty"`
+}
+
+// HistoryStore keeps every report and service transition in an
+// append-only JSON-lines file and an in-memory copy for queries. Records
+// older than the retention period are dropped as new ones arrive, and the
+// file is compacted to match from time to time.
+type HistoryStore struct {
+	mu          sync.RWMutex
+	path        string
+	retention   time.Duration
+	file        *os.File
+	snapshots   []ReportSnapshot
+	transitions []Transition
+	incidents   []Incident
+	// lines counts the records in the file, including expired and
+	// superseded ones no longer held in memory
+	lines     int
+	compacted time.Time
+}
+
+const (
+	// historyRetention is how long records are kept
+	historyRetention = 30 * 24 * time.Hour
+	// historyCompactInterval is how often expired records are removed from
+	// the file. It is compacted sooner once more than half of it is stale.
+	historyCompactInterval = 24 * time.Hour
+)
+
+// OpenHistoryStore loads the history file at path, dropping records older
+// than the retention period, and opens it for appending
+func OpenHistoryStore(path string) (*HistoryStore, error) {
+	store := &HistoryStore{path: path, retention: historyRetention}
+
+	pruned, err := store.load()
+	if err != nil {
+		return nil, err
+	}
+	if pruned {
+		if err := store.rewrite(); err != nil {
+			return nil, err
+		}
+		store.lines = store.live()
+	}
+	store.compacted = time.Now()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening history file: %v", err)
+	}
+	store.file = file
+	return store, nil
+}
+
+// load reads the history file and reports whether any expired records were skipped
+func (h *HistoryStore) load() (bool, error) {
+	file, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading history file: %v", err)
+	}
+	defer file.Close()
+
+	cutoff := time.Now().Add(-h.retention)
+	pruned := false
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		h.lines++
+		var record historyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// Skip a torn final line from an interrupted write
+			continue
+		}
+		switch {
+		case record.Report != nil:
+			if record.Report.Timestamp.Before(cutoff) {
+				pruned = true
+				continue
+			}
+			h.snapshots = append(h.snapshots, *record.Report)
+		case record.Transition != nil:
+			if record.Transition.Time.Before(cutoff) {
+				pruned = true
+				continue
+			}
+			h.transitions = append(h.transitions, *record.Transition)
+		case record.Incident != nil:
+			if !record.Incident.Open() && record.Incident.Resolved.Before(cutoff) {
+				pruned = true
+				continue
+			}
+			if h.upsertIncident(*record.Incident) {
+				// An older record for the same incident is superseded
+				pruned = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("error reading history file: %v", err)
+	}
+	return pruned, nil
+}
+
+// rewrite replaces the history file with the records currently in memory
+func (h *HistoryStore) rewrite() error {
+	tmp := h.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error compacting history file: %v", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for i := range h.snapshots {
+		encoder.Encode(historyRecord{Report: &h.snapshots[i]})
+	}
+	for i := range h.transitions {
+		encoder.Encode(historyRecord{Transition: &h.transitions[i]})
+	}
+	for i := range h.incidents {
+		encoder.Encode(historyRecord{Incident: &h.incidents[i]})
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("error compacting history file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error compacting history file: %v", err)
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// live returns the number of records held in memory
+func (h *HistoryStore) live() int {
+	return len(h.snapshots) + len(h.transitions) + len(h.incidents)
+}
+
+// prune drops the records that are older than the retention period
+func (h *HistoryStore) prune(now time.Time) {
+	cutoff := now.Add(-h.retention)
+	expired := sort.Search(len(h.snapshots), func(i int) bool { return !h.snapshots[i].Timestamp.Before(cutoff) })
+	h.snapshots = append(h.snapshots[:0], h.snapshots[expired:]...)
+	expired = sort.Search(len(h.transitions), func(i int) bool { return !h.transitions[i].Time.Before(cutoff) })
+	h.transitions = append(h.transitions[:0], h.transitions[expired:]...)
+
+	incidents := h.incidents[:0]
+	for _, incident := range h.incidents {
+		if incident.Open() || !incident.Resolved.Before(cutoff) {
+			incidents = append(incidents, incident)
+		}
+	}
+	h.incidents = incidents
+}
+
+// compact rewrites the file with the records in memory and reopens it
+func (h *HistoryStore) compact(now time.Time) error {
+	if err := h.rewrite(); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %v", err)
+	}
+	h.file.Close()
+	h.file = file
+	h.lines = h.live()
+	h.compacted = now
+	return nil
+}
+
+// Close closes the underlying file
+func (h *HistoryStore) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
+
+// Record stores a report along with any service transitions since the previous one
+func (h *HistoryStore) Record(report StatusReport) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := snapshotReport(report)
+
+	var transitions []Transition
+	if len(h.snapshots) > 0 {
+		transitions = diffSnapshots(h.snapshots[len(h.snapshots)-1], snapshot)
+	}
+
+	encoder := json.NewEncoder(h.file)
+	if err := encoder.Encode(historyRecord{Report: &snapshot}); err != nil {
+		return fmt.Errorf("error writing history: %v", err)
+	}
+	for i := range transitions {
+		if err := encoder.Encode(historyRecord{Transition: &transitions[i]}); err != nil {
+			return fmt.Errorf("error writing history: %v", err)
+		}
+	}
+
+	h.snapshots = append(h.snapshots, snapshot)
+	h.transitions = append(h.transitions, transitions...)
+	h.lines += 1 + len(transitions)
+
+	h.prune(snapshot.Timestamp)
+	if stale := h.lines - h.live(); stale > 0 && (stale > h.live() || snapshot.Timestamp.Sub(h.compacted) >= historyCompactInterval) {
+		if err := h.compact(snapshot.Timestamp); err != nil {
+			// Keep appending to the old file; the next report tries again
+			log.Printf("Error compacting history: %v", err)
+		}
+	}
+	return nil
+}
+
+// RecordIncident stores the latest state of an incident
+func (h *HistoryStore) RecordIncident(incident Incident) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := json.NewEncoder(h.file).Encode(historyRecord{Incident: &incident}); err != nil {
+		return fmt.Errorf("error writing history: %v", err)
+	}
+	h.lines++
+	h.upsertIncident(incident)
+	return nil
+}
+
+// upsertIncident replaces or adds an incident and reports whether it replaced one
+func (h *HistoryStore) upsertIncident(incident Incident) bool {
+	for i := range h.incidents {
+		if h.incidents[i].Provider == incident.Provider && h.incidents[i].ID == incident.ID {
+			h.incidents[i] = incident
+			return true
+		}
+	}
+	h.incidents = append(h.incidents, incident)
+	return false
+}
+
+// Incidents returns every stored incident
+func (h *HistoryStore) Incidents() []Incident {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]Incident(nil), h.incidents...)
+}
+
+// TransitionsFor returns the transitions of a provider's services between
+// from and to. With no services listed every service of the provider matches.
+func (h *HistoryStore) TransitionsFor(provider string, services []string, from, to time.Time) []Transition {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	wanted := make(map[string]bool)
+	for _, service := range services {
+		wanted[service] = true
+	}
+	var transitions []Transition
+	for _, transition := range h.transitions {
+		if transition.Provider != provider || transition.Time.Before(from) || transition.Time.After(to) {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[transition.Service] {
+			continue
+		}
+		transitions = append(transitions, transition)
+	}
+	return transitions
+}
+
+// snapshotReport reduces a report to what history needs. Operational
+// services are left out, since diffSnapshots treats a missing service as
+// operational.
+func snapshotReport(report StatusReport) ReportSnapshot {
+	snapshot := ReportSnapshot{Timestamp: report.Timestamp}
+	for _, provider := range report.Providers {
+		ps := ProviderSnapshot{Name: provider.Name, Status: provider.Status(), Total: len(provider.Services)}
+		for _, service := range provider.Services {
+			if service.Status.Problem() {
+				ps.Down++
+			}
+			if service.Status != StatusOperational {
+				snapshot.Services = append(snapshot.Services, service)
+			}
+		}
+		snapshot.Providers = append(snapshot.Providers, ps)
+	}
+	return snapshot
+}
+
+func serviceKey(service Service) string {
+	return service.Provider + "\x00" + service.Name + "\x00" + service.Region
+}
+
+// diffSnapshots returns the services whose status differs between two snapshots.
+// A service that disappears from a provider that was checked is treated as
+// having returned to Operational, since most feeds only list affected components.
+func diffSnapshots(prev, next ReportSnapshot) []Transition {
+	previous := make(map[string]Service)
+	for _, service := range prev.Services {
+		previous[serviceKey(service)] = service
+	}
+
+	var transitions []Transition
+	seen := make(map[string]bool)
+	for _, service := range next.Services {
+		key := serviceKey(service)
+		seen[key] = true
+
+		from := StatusOperational
+		if old, ok := previous[key]; ok {
+			from = old.Status
+		}
+		if from != service.Status {
+			transitions = append(transitions, Transition{
+				Time:     next.Timestamp,
+				Provider: service.Provider,
+				Service:  service.Name,
+				Region:   service.Region,
+				From:     from,
+				To:       service.Status,
+				Details:  service.Details,
+			})
+		}
+	}
+
+	// Providers whose check failed are missing or UNKNOWN; leave their services alone
+	checked := make(map[string]bool)
+	for _, provider := range next.Providers {
+		checked[provider.Name] = provider.Status != StatusUnknown
+	}
+	for _, service := range prev.Services {
+		if seen[serviceKey(service)] || service.Status == StatusOperational || !checked[service.Provider] {
+			continue
+		}
+		transitions = append(transitions, Transition{
+			Time:     next.Timestamp,
+			Provider: service.Provider,
+			Service:  service.Name,
+			Region:   service.Region,
+			From:     service.Status,
+			To:       StatusOperational,
+			Details:  "No longer reported",
+		})
+	}
+	return transitions
+}
+
+// ProviderHistory summarizes a provider's availability over a time range
+type ProviderHistory struct {
+	Provider string
+	Uptime   map[string]float64
+	Outages  []Outage
+}
+
+// HistorySummary is the response of the /history endpoint
+type HistorySummary struct {
+	Generated   time.Time
+	Since       time.Time
+	Providers   []ProviderHistory
+	Transitions []Transition
+	// Incidents are those open or resolved since the start of the range,
+	// newest first, with their postmortem links
+	Incidents []Incident
+}
+
+// uptimeWindows are the ranges reported by Summary, keyed by label
+var uptimeWindows = []struct {
+	Label    string
+	Duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// Summary returns uptime percentages for each window, plus outages and
+// transitions since the given time
+func (h *HistoryStore) Summary(since, now time.Time) HistorySummary {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	summary := HistorySummary{Generated: now, Since: since}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, snapshot := range h.snapshots {
+		for _, provider := range snapshot.Providers {
+			if !seen[provider.Name] {
+				seen[provider.Name] = true
+				names = append(names, provider.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ph := ProviderHistory{Provider: name, Uptime: make(map[string]float64)}
+		for _, window := range uptimeWindows {
+			ph.Uptime[window.Label] = h.uptime(name, now.Add(-window.Duration), now)
+		}
+		for _, outage := range h.outages(name, now) {
+			if outage.Ongoing || outage.End.After(since) {
+				ph.Outages = append(ph.Outages, outage)
+			}
+		}
+		summary.Providers = append(summary.Providers, ph)
+	}
+
+	for _, transition := range h.transitions {
+		if !transition.Time.Before(since) {
+			summary.Transitions = append(summary.Transitions, transition)
+		}
+	}
+
+	for _, incident := range h.incidents {
+		if incident.Open() || !incident.Resolved.Before(since) {
+			summary.Incidents = append(summary.Incidents, incident)
+		}
+	}
+	sort.Slice(summary.Incidents, func(i, j int) bool {
+		return summary.Incidents[i].Started.After(summary.Incidents[j].Started)
+	})
+	return summary
+}
+
+// providerStatus returns the rolled-up status of a provider in a snapshot
+func providerStatus(snapshot ReportSnapshot, name string) (Status, bool) {
+	for _, provider := range snapshot.Providers {
+		if provider.Name == name {
+			return provider.Status, true
+		}
+	}
+	return "", false
+}
+
+// uptime returns the percentage of [from, to] during which the provider was
+// healthy; planned maintenance counts as up.
+// Each snapshot's status is assumed to hold until the next snapshot; time
+// before the first snapshot and time spent UNKNOWN are not counted.
+func (h *HistoryStore) uptime(name string, from, to time.Time) float64 {
+	var up, total time.Duration
+	for i, snapshot := range h.snapshots {
+		status, ok := providerStatus(snapshot, name)
+		if !ok || status == StatusUnknown {
+			continue
+		}
+
+		start := snapshot.Timestamp
+		end := to
+		if i+1 < len(h.snapshots) {
+			end = h.snapshots[i+1].Timestamp
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		total += end.Sub(start)
+		if status.Healthy() {
+			up += end.Sub(start)
+		}
+	}
+	if total == 0 {
+		return 100
+	}
+	return float64(up) / float64(total) * 100
+}
+
+// outages returns the windows during which the provider had a known problem
+func (h *HistoryStore) outages(name string, now time.Time) []Outage {
+	var outages []Outage
+	var current *Outage
+	for _, snapshot := range h.snapshots {
+		status, ok := providerStatus(snapshot, name)
+		if !ok || status == StatusUnknown {
+			continue
+		}
+		if status.Problem() {
+			if current == nil {
+				current = &Outage{Provider: name, Start: snapshot.Timestamp}
+			}
+			current.Worst = worstStatus(current.Worst, status)
+		} else if current != nil {
+			current.End = snapshot.Timestamp
+			outages = append(outages, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		current.End = now
+		current.Ongoing = true
+		outages = append(outages, *current)
+	}
+	return outages
+}
+
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if history == nil {
+		http.Error(w, "History is not enabled", http.StatusNotFound)
+		return
+	}
+
+	rangeParam := r.URL.Query().Get("range")
+	if rangeParam == "" {
+		rangeParam = "24h"
+	}
+	var window time.Duration
+	for _, uw := range uptimeWindows {
+		if uw.Label == rangeParam {
+			window = uw.Duration
+		}
+	}
+	if window == 0 {
+		http.Error(w, "Invalid range, expected 24h, 7d or 30d", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	summary := history.Summary(now.Add(-window), now)
+
+	if provider := r.URL.Query().Get("provider"); provider != "" {
+		var providers []ProviderHistory
+		for _, ph := range summary.Providers {
+			if ph.Provider == provider {
+				providers = append(providers, ph)
+			}
+		}
+		var transitions []Transition
+		for _, transition := range summary.Transitions {
+			if transition.Provider == provider {
+				transitions = append(transitions, transition)
+			}
+		}
+		var providerIncidents []Incident
+		for _, incident := range summary.Incidents {
+			if incident.Provider == provider {
+				providerIncidents = append(providerIncidents, incident)
+			}
+		}
+		summary.Providers = providers
+		summary.Transitions = transitions
+		summary.Incidents = providerIncidents
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// providerReport builds a report with one provider and the given services
+func providerReport(at time.Time, provider string, services ...Service) StatusReport {
+	for i := range services {
+		services[i].Provider = provider
+	}
+	return StatusReport{Timestamp: at, Providers: []Provider{{Name: provider, Services: services}}}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	compute := Service{Name: "Compute", Region: "us-east-1"}
+	storage := Service{Name: "Storage", Region: "Global"}
+	with := func(service Service, status Status) Service {
+		service.Status = status
+		return service
+	}
+
+	tests := []struct {
+		name       string
+		prev, next StatusReport
+		want       []Transition
+	}{
+		{
+			name: "no change",
+			prev: providerReport(at, "P", with(compute, StatusDegraded), with(storage, StatusOperational)),
+			next: providerReport(at, "P", with(compute, StatusDegraded), with(storage, StatusOperational)),
+		},
+		{
+			name: "service degrades",
+			prev: providerReport(at, "P", with(compute, StatusOperational), with(storage, StatusOperational)),
+			next: providerReport(at, "P", with(compute, StatusMajorOutage), with(storage, StatusOperational)),
+			want: []Transition{{Time: at, Provider: "P", Service: "Compute", Region: "us-east-1", From: StatusOperational, To: StatusMajorOutage}},
+		},
+		{
+			name: "new service appears with a problem",
+			prev: providerReport(at, "P", with(storage, StatusOperational)),
+			next: providerReport(at, "P", with(compute, StatusDegraded), with(storage, StatusOperational)),
+			want: []Transition{{Time: at, Provider: "P", Service: "Compute", Region: "us-east-1", From: StatusOperational, To: StatusDegraded}},
+		},
+		{
+			name: "affected service drops out of the feed",
+			prev: providerReport(at, "P", with(compute, StatusPartialOutage)),
+			next: providerReport(at, "P", with(storage, StatusOperational)),
+			want: []Transition{{Time: at, Provider: "P", Service: "Compute", Region: "us-east-1", From: StatusPartialOutage, To: StatusOperational, Details: "No longer reported"}},
+		},
+		{
+			name: "failed check leaves services alone",
+			prev: providerReport(at, "P", with(compute, StatusPartialOutage)),
+			next: providerReport(at, "P", Service{Name: "P", Region: "Global", Status: StatusUnknown}),
+			want: []Transition{{Time: at, Provider: "P", Service: "P", Region: "Global", From: StatusOperational, To: StatusUnknown}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffSnapshots(snapshotReport(test.prev), snapshotReport(test.next))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got  %+v\nwant %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotReportOmitsOperationalServices(t *testing.T) {
+	report := providerReport(time.Now(), "P",
+		Service{Name: "A", Status: StatusOperational},
+		Service{Name: "B", Status: StatusDegraded},
+		Service{Name: "C", Status: StatusMaintenance},
+	)
+	snapshot := snapshotReport(report)
+	if len(snapshot.Services) != 2 || snapshot.Services[0].Name != "B" || snapshot.Services[1].Name != "C" {
+		t.Errorf("services %+v, want only B and C", snapshot.Services)
+	}
+	want := []ProviderSnapshot{{Name: "P", Status: StatusDegraded, Down: 1, Total: 3}}
+	if !reflect.DeepEqual(snapshot.Providers, want) {
+		t.Errorf("providers %+v, want %+v", snapshot.Providers, want)
+	}
+}
+
+func TestHistoryUptimeAndOutages(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	snapshot := func(hour int, status Status) ReportSnapshot {
+		return ReportSnapshot{Timestamp: start.Add(time.Duration(hour) * time.Hour), Providers: []ProviderSnapshot{{Name: "P", Status: status}}}
+	}
+	h := &HistoryStore{snapshots: []ReportSnapshot{
+		snapshot(0, StatusOperational),
+		snapshot(2, StatusDegraded),
+		snapshot(3, StatusMajorOutage),
+		snapshot(4, StatusMaintenance),
+		// Unknown time counts as neither up nor down
+		snapshot(6, StatusUnknown),
+		snapshot(8, StatusOperational),
+		snapshot(9, StatusPartialOutage),
+	}}
+	now := start.Add(10 * time.Hour)
+
+	// 8 of the 10 hours are known; 2h degraded or worse before the
+	// maintenance and 1h at the end
+	if got, want := h.uptime("P", start, now), 5.0/8*100; got != want {
+		t.Errorf("uptime %.2f, want %.2f", got, want)
+	}
+	if got := h.uptime("P", start.Add(4*time.Hour), start.Add(6*time.Hour)); got != 100 {
+		t.Errorf("uptime during maintenance %.2f, want 100", got)
+	}
+	if got := h.uptime("Other", start, now); got != 100 {
+		t.Errorf("uptime of a provider with no history %.2f, want 100", got)
+	}
+
+	want := []Outage{
+		{Provider: "P", Start: start.Add(2 * time.Hour), End: start.Add(4 * time.Hour), Worst: StatusMajorOutage},
+		{Provider: "P", Start: start.Add(9 * time.Hour), End: now, Ongoing: true, Worst: StatusPartialOutage},
+	}
+	if got := h.outages("P", now); !reflect.DeepEqual(got, want) {
+		t.Errorf("outages\n got %+v\nwant %+v", got, want)
+	}
+}
+
+// countLines returns the number of lines in a file
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		lines++
+	}
+	return lines
+}
+
+func TestHistoryRecordPrunesAndCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store, err := OpenHistoryStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { store.Close() }()
+	store.retention = 10 * time.Hour
+
+	// Recent enough that reopening the store keeps every record
+	start := time.Now().Add(-40 * time.Hour).Truncate(time.Hour)
+	store.compacted = start
+	services := make([]Service, 50)
+	for i := range services {
+		services[i] = Service{Name: string(rune('A' + i%26)), Region: string(rune('a' + i/26)), Status: StatusOperational}
+	}
+	for hour := 0; hour < 30; hour++ {
+		report := providerReport(start.Add(time.Duration(hour)*time.Hour), "P", append([]Service(nil), services...)...)
+		if hour%4 == 0 {
+			report.Providers[0].Services[0].Status = StatusDegraded
+		}
+		if err := store.Record(report); err != nil {
+			t.Fatal(err)
+		}
+		if lines := countLines(t, path); lines > 2*store.live()+1 {
+			t.Fatalf("hour %d: file has %d lines for %d live records", hour, lines, store.live())
+		}
+	}
+
+	cutoff := start.Add(29*time.Hour - store.retention)
+	if first := store.snapshots[0].Timestamp; first.Before(cutoff) {
+		t.Errorf("oldest snapshot %s is older than the retention period", first)
+	}
+	for _, transition := range store.transitions {
+		if transition.Time.Before(cutoff) {
+			t.Errorf("transition at %s is older than the retention period", transition.Time)
+		}
+	}
+	for _, snapshot := range store.snapshots {
+		if len(snapshot.Services) > 1 {
+			t.Errorf("snapshot at %s stored %d services, want only the degraded one", snapshot.Timestamp, len(snapshot.Services))
+		}
+	}
+
+	// A day after the last compaction the file is rewritten even though it
+	// is mostly live
+	store.Record(providerReport(start.Add(30*time.Hour), "P", append([]Service(nil), services...)...))
+	store.compacted = start
+	store.Record(providerReport(start.Add(31*time.Hour), "P", append([]Service(nil), services...)...))
+	if lines := countLines(t, path); lines != store.live() {
+		t.Errorf("file has %d lines after compaction, want %d", lines, store.live())
+	}
+
+	snapshots, transitions := len(store.snapshots), len(store.transitions)
+	store.Close()
+	store, err = OpenHistoryStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.snapshots) != snapshots || len(store.transitions) != transitions {
+		t.Errorf("reloaded %d snapshots and %d transitions, want %d and %d", len(store.snapshots), len(store.transitions), snapshots, transitions)
+	}
+}
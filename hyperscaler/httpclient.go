@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HTTPConfig controls how status pages are fetched
+type HTTPConfig struct {
+	UserAgent string `yaml:"user_agent"`
+	// RequestTimeout bounds a single HTTP attempt
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// Retries is the number of extra attempts after a failed request
+	Retries int `yaml:"retries"`
+	// BackoffBase is the delay before the first retry; it doubles each attempt
+	BackoffBase time.Duration `yaml:"backoff_base"`
+	BackoffMax  time.Duration `yaml:"backoff_max"`
+	// CheckTimeout bounds a whole provider check, including retries
+	CheckTimeout time.Duration `yaml:"check_timeout"`
+}
+
+// defaultHTTPConfig returns the HTTP settings used when none are configured
+func defaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		UserAgent:      "hyperscaler-monitor/1.0",
+		RequestTimeout: 15 * time.Second,
+		Retries:        2,
+		BackoffBase:    500 * time.Millisecond,
+		BackoffMax:     10 * time.Second,
+		CheckTimeout:   60 * time.Second,
+	}
+}
+
+// maxResponseSize caps a status page body; the largest real feeds are a
+// few hundred kilobytes
+const maxResponseSize = 8 << 20
+
+// cachedResponse is the last successful body for a URL with its validators
+type cachedResponse struct {
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// statusClient fetches status pages with timeouts, retries and conditional GETs
+type statusClient struct {
+	mu     sync.RWMutex
+	config HTTPConfig
+	client *http.Client
+	cache  map[string]cachedResponse
+}
+
+// httpClient is shared by every checker
+var httpClient = newStatusClient(defaultHTTPConfig())
+
+func newStatusClient(config HTTPConfig) *statusClient {
+	return &statusClient{
+		config: config,
+		client: &http.Client{},
+		cache:  make(map[string]cachedResponse),
+	}
+}
+
+// Configure replaces the client settings, keeping the response cache
+func (c *statusClient) Configure(config HTTPConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = config
+}
+
+func (c *statusClient) settings() HTTPConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.config
+}
+
+// retryableError marks failures worth another attempt
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+
+// Get fetches url, retrying transient failures with jittered exponential
+// backoff. A 304 Not Modified response returns the previously cached body.
+func (c *statusClient) Get(ctx context.Context, url string) ([]byte, error) {
+	config := c.settings()
+
+	var lastErr error
+	attempts := 0
+	for attempt := 0; attempt <= config.Retries; attempt++ {
+		if attempt > 0 {
+			delay := backoffDelay(config, attempt)
+			if re, ok := lastErr.(*retryableError); ok && re.retryAfter > delay {
+				delay = re.retryAfter
+			}
+			if delay > config.BackoffMax {
+				delay = config.BackoffMax
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, fmt.Errorf("%v (last error: %v)", ctx.Err(), lastErr)
+			case <-timer.C:
+			}
+		}
+
+		attempts++
+		body, err := c.attempt(ctx, config, url)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if _, ok := err.(*retryableError); !ok || ctx.Err() != nil {
+			break
+		}
+	}
+	if attempts > 1 {
+		return nil, fmt.Errorf("after %d attempts: %v", attempts, lastErr)
+	}
+	return nil, lastErr
+}
+
+// backoffDelay returns a random delay in [0, base*2^(attempt-1)] ("full jitter")
+func backoffDelay(config HTTPConfig, attempt int) time.Duration {
+	ceiling := config.BackoffBase << (attempt - 1)
+	if ceiling <= 0 || ceiling > config.BackoffMax {
+		ceiling = config.BackoffMax
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// attempt performs a single request with its own deadline
+func (c *statusClient) attempt(ctx context.Context, config HTTPConfig, url string) ([]byte, error) {
+	if config.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.RequestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", config.UserAgent)
+
+	c.mu.RLock()
+	cached, hasCache := c.cache[url]
+	c.mu.RUnlock()
+	if hasCache {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// Network errors and per-attempt timeouts are transient
+		return nil, &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && hasCache:
+		return cached.body, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return nil, &retryableError{
+			err:        fmt.Errorf("unexpected status %s", resp.Status),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, &retryableError{err: fmt.Errorf("error reading response: %v", err)}
+	}
+	if len(body) > maxResponseSize {
+		return nil, fmt.Errorf("response is larger than %d bytes", maxResponseSize)
+	}
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag != "" || lastModified != "" {
+		c.mu.Lock()
+		c.cache[url] = cachedResponse{etag: etag, lastModified: lastModified, body: body}
+		c.mu.Unlock()
+	}
+	return body, nil
+}
+
+// parseRetryAfter understands the delay-seconds form of Retry-After
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
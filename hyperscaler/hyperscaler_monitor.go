@@ -1,34 +1,39 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"html/template"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 // SystemInfo represents system and network information
 type SystemInfo struct {
-	IPAddress   string
-	PingLatency string
-	LastCheck   time.Time
+	IPAddress string
+	// Probes holds the latency statistics of each probe target
+	Probes    []ProbeStats
+	LastCheck time.Time
+	// Pending is set until the first probe round has completed
+	Pending bool `json:",omitempty"`
 }
 
 // Service represents a cloud service status
 type Service struct {
 	Name      string
 	Provider  string
-	Status    string
+	Status    Status
 	LastCheck time.Time
 	Details   string
 	Region    string
+	// IncidentID links the service to the incident affecting it, if known
+	IncidentID string `json:",omitempty"`
 }
 
 // Provider represents a cloud provider
@@ -36,6 +41,23 @@ type Provider struct {
 	Name     string
 	URL      string
 	Services []Service
+	// Error is set when the provider could not be checked
+	Error string `json:",omitempty"`
+}
+
+// Status rolls the provider up to its most severe known service status.
+// It is Unknown only when the check failed or nothing else is known.
+func (p Provider) Status() Status {
+	var statuses []Status
+	for _, service := range p.Services {
+		if service.Status != StatusUnknown {
+			statuses = append(statuses, service.Status)
+		}
+	}
+	if len(statuses) == 0 && (p.Error != "" || len(p.Services) > 0) {
+		return StatusUnknown
+	}
+	return worstStatus(statuses...)
 }
 
 // StatusReport represents the overall status report
@@ -43,557 +65,483 @@ type StatusReport struct {
 	Timestamp  time.Time
 	SystemInfo SystemInfo
 	Providers  []Provider
-	Content    string
+	Checks     []CheckResult
+	// Incidents are those the providers' feeds currently describe
+	Incidents []Incident
+	// Maintenance lists the windows the providers' feeds announce
+	Maintenance []Maintenance `json:",omitempty"`
+	Content     string
+}
+
+// CheckResult records how a single provider check went
+type CheckResult struct {
+	Provider string
+	Duration time.Duration
+	Error    string `json:",omitempty"`
 }
 
-// HTML template for the status report
-const htmlTemplate = `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Hyperscaler Status Dashboard</title>
-    <style>
-        body {
-            font-family: Arial, sans-serif;
-            margin: 20px;
-            background-color: #f5f5f5;
-        }
-        .container {
-            max-width: 1200px;
-            margin: 0 auto;
-        }
-        .header {
-            background-color: #333;
-            color: white;
-            padding: 20px;
-            border-radius: 5px;
-            margin-bottom: 20px;
-        }
-        .system-info {
-            background-color: #fff;
-            padding: 15px;
-            border-radius: 5px;
-            margin-bottom: 20px;
-            box-shadow: 0 2px 4px rgba(0,0,0,0.1);
-        }
-        .system-info h2 {
-            margin-top: 0;
-            color: #333;
-        }
-        .system-info p {
-            margin: 5px 0;
-        }
-        .status-table {
-            width: 100%;
-            border-collapse: collapse;
-            background-color: white;
-            box-shadow: 0 2px 4px rgba(0,0,0,0.1);
-            margin-bottom: 20px;
-        }
-        .status-table th, .status-table td {
-            padding: 12px;
-            text-align: left;
-            border-bottom: 1px solid #ddd;
-        }
-        .status-table th {
-            background-color: #f8f9fa;
-            font-weight: bold;
-        }
-        .status-table tr:hover {
-            background-color: #f5f5f5;
-        }
-        .status-up {
-            color: #4caf50;
-            font-weight: bold;
-        }
-        .status-down {
-            color: #f44336;
-            font-weight: bold;
-        }
-        .timestamp {
-            color: #666;
-            font-size: 14px;
-        }
-        .refresh-button {
-            background-color: #4caf50;
-            color: white;
-            padding: 10px 20px;
-            border: none;
-            border-radius: 5px;
-            cursor: pointer;
-            margin-top: 20px;
-        }
-        .refresh-button:hover {
-            background-color: #45a049;
-        }
-        .provider-header {
-            background-color: #e9ecef;
-            padding: 10px;
-            margin-top: 20px;
-            border-radius: 5px;
-            font-size: 18px;
-            font-weight: bold;
-        }
-        .provider-link {
-            color: #0066cc;
-            text-decoration: none;
-            font-size: 14px;
-            margin-left: 10px;
-        }
-        .provider-link:hover {
-            text-decoration: underline;
-        }
-        .tab-container {
-            margin-bottom: 20px;
-        }
-        .tab-buttons {
-            display: flex;
-            gap: 10px;
-            margin-bottom: 20px;
-        }
-        .tab-button {
-            padding: 10px 20px;
-            border: none;
-            border-radius: 5px;
-            cursor: pointer;
-            background-color: #e9ecef;
-            color: #333;
-        }
-        .tab-button.active {
-            background-color: #4caf50;
-            color: white;
-        }
-        .tab-content {
-            display: none;
-        }
-        .tab-content.active {
-            display: block;
-        }
-        .loading {
-            display: none;
-            text-align: center;
-            padding: 20px;
-            font-size: 18px;
-            color: #666;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>Hyperscaler Status Dashboard</h1>
-            <p class="timestamp">Last Updated: {{.Timestamp.Format "2006-01-02 15:04:05 MST"}}</p>
-        </div>
-        <div class="system-info">
-            <h2>System Information</h2>
-            <p><strong>IP Address:</strong> {{.SystemInfo.IPAddress}}</p>
-            <p><strong>Google Ping Latency:</strong> {{.SystemInfo.PingLatency}}</p>
-            <p><strong>Last Network Check:</strong> {{.SystemInfo.LastCheck.Format "15:04:05 MST"}}</p>
-        </div>
-        <div class="tab-container">
-            <div class="tab-buttons">
-                <button class="tab-button active" onclick="showTab('status')">Status</button>
-                <button class="tab-button" onclick="showTab('refresh')">Refresh</button>
-            </div>
-            <div id="status-tab" class="tab-content active">
-                {{range .Providers}}
-                <div class="provider-header">
-                    {{.Name}}
-                    <a href="{{.URL}}" target="_blank" class="provider-link">View Official Status Page</a>
-                </div>
-                <table class="status-table">
-                    <thead>
-                        <tr>
-                            <th>Service</th>
-                            <th>Status</th>
-                            <th>Region</th>
-                            <th>Details</th>
-                            <th>Last Check</th>
-                        </tr>
-                    </thead>
-                    <tbody>
-                        {{range .Services}}
-                        <tr>
-                            <td>{{.Name}}</td>
-                            <td class="{{if eq .Status "UP"}}status-up{{else}}status-down{{end}}">{{.Status}}</td>
-                            <td>{{.Region}}</td>
-                            <td>{{.Details}}</td>
-                            <td>{{.LastCheck.Format "15:04:05 MST"}}</td>
-                        </tr>
-                        {{end}}
-                    </tbody>
-                </table>
-                {{end}}
-            </div>
-            <div id="refresh-tab" class="tab-content">
-                <div class="loading" id="refresh-loading">Refreshing status data...</div>
-                <button class="refresh-button" onclick="refreshStatus()">Refresh Now</button>
-            </div>
-        </div>
-    </div>
-    <script>
-        function showTab(tabName) {
-            // Hide all tabs
-            document.querySelectorAll('.tab-content').forEach(tab => {
-                tab.classList.remove('active');
-            });
-            document.querySelectorAll('.tab-button').forEach(button => {
-                button.classList.remove('active');
-            });
-            
-            // Show selected tab
-            document.getElementById(tabName + '-tab').classList.add('active');
-            event.target.classList.add('active');
-        }
-
-        function refreshStatus() {
-            const loading = document.getElementById('refresh-loading');
-            loading.style.display = 'block';
-            
-            fetch('/refresh')
-                .then(response => response.json())
-                .then(data => {
-                    if (data.success) {
-                        location.reload();
-                    } else {
-                        alert('Error refreshing status: ' + data.error);
-                    }
-                })
-                .catch(error => {
-                    alert('Error refreshing status: ' + error);
-                })
-                .finally(() => {
-                    loading.style.display = 'none';
-                });
-        }
-    </script>
-</body>
-</html>
-`
+// RegionGroup holds the services reported for a single region
+type RegionGroup struct {
+	Region   string
+	Services []Service
+}
+
+// Regions returns the distinct regions in the report, sorted
+func (r StatusReport) Regions() []string {
+	seen := make(map[string]bool)
+	var regions []string
+	for _, provider := range r.Providers {
+		for _, service := range provider.Services {
+			if !seen[service.Region] {
+				seen[service.Region] = true
+				regions = append(regions, service.Region)
+			}
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// ServicesByRegion groups every service in the report by region
+func (r StatusReport) ServicesByRegion() []RegionGroup {
+	var groups []RegionGroup
+	for _, region := range r.Regions() {
+		group := RegionGroup{Region: region}
+		for _, provider := range r.Providers {
+			for _, service := range provider.Services {
+				if service.Region == region {
+					group.Services = append(group.Services, service)
+				}
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
 
 var currentReport StatusReport
 var reportMutex sync.RWMutex
 
-func handleRefresh(w http.ResponseWriter, r *http.Request) {
-	report := generateReport()
+// history is nil when the history store is disabled
+var history *HistoryStore
+
+// alerts sends notifications for service state changes
+var alerts *AlertManager
+
+// setCurrentReport publishes a new report, pushes it to live dashboards
+// and records it in history
+func setCurrentReport(report StatusReport) {
+	// Carry acknowledgements into the report
+	report.Incidents = incidents.Annotate(report.Incidents)
+
 	reportMutex.Lock()
+	previous := currentReport
 	currentReport = report
+	// Publish under the lock so concurrent reports reach clients in order
+	publishReport(previous, report)
 	reportMutex.Unlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-	})
+	if history != nil {
+		if err := history.Record(report); err != nil {
+			log.Printf("Error recording history: %v", err)
+		}
+	}
+	observeIncidents(report)
+	maintenance.Observe(report)
+	if alerts != nil {
+		alerts.Observe(report)
+	}
 }
 
-func handleStatus(w http.ResponseWriter, r *http.Request) {
-	reportMutex.RLock()
-	defer reportMutex.RUnlock()
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "hash-password":
+			os.Exit(runHashPassword(os.Args[2:]))
+		}
+	}
+	os.Exit(serve())
+}
 
-	tmpl, err := template.New("status").Parse(htmlTemplate)
+// serve runs the dashboard until SIGINT or SIGTERM and returns the exit
+// code. Deferred cleanup such as closing the history file runs before exit.
+func serve() int {
+	flags := parseFlags()
+	config, err := loadConfig(flags)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		log.Print(err)
+		return 1
 	}
 
-	if err := tmpl.Execute(w, currentReport); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if err := pages.Configure(flags.templatesDir(), config.ThemeDir); err != nil {
+		log.Print(err)
+		return 1
 	}
-}
 
-func main() {
-	// Create templates directory if it doesn't exist
-	if err := os.MkdirAll("templates", 0755); err != nil {
-		log.Fatal(err)
+	if config.HistoryPath != "" {
+		store, err := OpenHistoryStore(config.HistoryPath)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		defer store.Close()
+		history = store
+		incidents.Load(store.Incidents())
 	}
 
-	// Generate initial report
-	currentReport = generateReport()
+	alerts, err = NewAlertManager(config.Alerts)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	applyConfig(config)
+
+	// ctx ends the scheduler on the first SIGINT or SIGTERM. Reports run
+	// under work, which is only cancelled if they outlast the shutdown timeout.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	work, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	refresher.SetContext(work)
 
 	// Set up HTTP handlers
 	http.HandleFunc("/", handleRoot)
-	http.HandleFunc("/refresh", handleRefresh)
-
-	// Start HTTP server
+	http.Handle("/static/", pages)
+	http.HandleFunc("/refresh", requireAdmin(handleRefresh))
+	http.HandleFunc("/refresh/jobs/", handleRefreshJob)
+	http.HandleFunc("/history", handleHistory)
+	http.HandleFunc("/api/status", handleAPIStatus)
+	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/events", handleEvents)
+	http.HandleFunc("/incident", handleIncident)
+	http.HandleFunc("/incident/ack", requireAdmin(handleIncidentAck))
+	http.HandleFunc("/api/incidents", handleAPIIncidents)
+	http.HandleFunc("/api/impact", handleAPIImpact)
+	http.HandleFunc("/api/maintenance", handleAPIMaintenance)
+	http.HandleFunc("/api/maintenance.ics", handleMaintenanceICS)
+
+	// Start the HTTP server first, so /healthz answers while the first
+	// report is generated
+	server := &http.Server{
+		Addr:              config.Listen,
+		Handler:           withHealth(withAuth(http.DefaultServeMux)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	server.RegisterOnShutdown(events.Close)
+	serverErr := make(chan error, 1)
 	go func() {
-		fmt.Println("Starting HTTP server on :8080")
-		if err := http.ListenAndServe(":8080", nil); err != nil {
-			log.Fatal(err)
+		fmt.Printf("Starting HTTP server on %s\n", config.Listen)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serverErr <- err
 		}
 	}()
 
 	fmt.Println("Starting Hyperscaler Status Monitor...")
-	fmt.Println("Generating reports every 5 minutes...")
-	fmt.Println("Press Ctrl+C to stop")
+	fmt.Printf("Generating reports every %s...\n", config.Interval)
+	fmt.Println("Send SIGHUP to reload the config, press Ctrl+C to stop")
 
-	// Start background report generation
-	for {
-		report := generateReport()
-		reportMutex.Lock()
-		currentReport = report
-		reportMutex.Unlock()
+	probes.Start(ctx, refreshSystemInfo)
+	scheduler := make(chan struct{})
+	go func() {
+		defer close(scheduler)
+		schedule(ctx, flags, config.Interval)
+	}()
 
-		fmt.Printf("Report generated at %s\n", report.Timestamp.Format(time.RFC3339))
-		time.Sleep(5 * time.Minute)
+	code := 0
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down, waiting up to %s", currentConfig().ShutdownTimeout)
+	case err := <-serverErr:
+		log.Printf("HTTP server error: %v", err)
+		code = 1
 	}
+	// A second signal kills the process straight away
+	stop()
+	shutdown(server, cancelWork, scheduler)
+	return code
 }
 
-// getSystemInfo gets IP address and ping latency
-func getSystemInfo() SystemInfo {
-	// Get IP address
-	resp, err := http.Get("https://api.ipify.org?format=text")
-	var ipAddress string
-	if err == nil {
-		ip, _ := io.ReadAll(resp.Body)
-		ipAddress = string(ip)
-		resp.Body.Close()
-	} else {
-		ipAddress = "Unable to determine"
-	}
-
-	// Get ping latency
-	cmd := exec.Command("ping", "-c", "1", "www.google.com")
-	output, err := cmd.Output()
-	var pingLatency string
-	if err == nil {
-		outputStr := string(output)
-		if strings.Contains(outputStr, "time=") {
-			start := strings.Index(outputStr, "time=") + 5
-			end := strings.Index(outputStr[start:], " ") + start
-			pingLatency = outputStr[start:end]
-		} else {
-			pingLatency = "Unable to determine"
+// schedule generates a report straight away and then every interval until
+// ctx is done. SIGHUP reloads the config.
+func schedule(ctx context.Context, flags *cliFlags, interval time.Duration) {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	// Generate initial report
+	refresher.Run()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Joins a manual refresh if one is already running
+			job := refresher.Run()
+
+			fmt.Printf("Report generated at %s\n", job.ReportTimestamp.Format(time.RFC3339))
+		case <-reload:
+			newConfig, err := loadConfig(flags)
+			if err != nil {
+				log.Printf("Error reloading config, keeping the current one: %v", err)
+				continue
+			}
+			applyConfig(newConfig)
+			if err := pages.Configure(flags.templatesDir(), newConfig.ThemeDir); err != nil {
+				log.Printf("Error loading templates, keeping the current ones: %v", err)
+			}
+			ticker.Reset(newConfig.Interval)
+			log.Printf("Config reloaded: %d providers, interval %s", len(newConfig.Providers), newConfig.Interval)
 		}
-	} else {
-		pingLatency = "Unable to determine"
 	}
+}
+
+// shutdown fails readiness, stops accepting requests and waits for those in
+// flight and for the report being generated. Whatever is still running when
+// the shutdown timeout ends is cancelled.
+func shutdown(server *http.Server, cancelWork context.CancelFunc, scheduler <-chan struct{}) {
+	draining.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().ShutdownTimeout)
+	defer cancel()
 
-	return SystemInfo{
-		IPAddress:   ipAddress,
-		PingLatency: pingLatency,
-		LastCheck:   time.Now(),
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down HTTP server: %v", err)
+	}
+	if err := refresher.Wait(ctx); err != nil {
+		log.Printf("Report still running at the shutdown timeout, cancelling its checks")
 	}
+	// Cancelled checks return promptly; their report is discarded
+	cancelWork()
+	<-scheduler
+	if err := refresher.Wait(context.Background()); err != nil {
+		log.Printf("Error waiting for report: %v", err)
+	}
+	log.Printf("Shutdown complete")
 }
 
-// checkGoogleStatus checks Google Workspace status
-func checkGoogleStatus(services *[]Service) error {
-	resp, err := http.Get("https://www.google.com/appsstatus/dashboard/")
-	if err != nil {
-		return fmt.Errorf("error checking Google status: %v", err)
-	}
-	defer resp.Body.Close()
+// getSystemInfo returns the public IP address and the latest probe statistics
+func getSystemInfo() SystemInfo {
+	return probes.SystemInfo()
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("error reading Google response: %v", err)
-	}
-
-	content := string(body)
-	// Check for "No incidents" text
-	if strings.Contains(content, "No incidents") {
-		*services = append(*services, Service{
-			Name:      "Google Workspace",
-			Provider:  "Google",
-			Status:    "UP",
-			LastCheck: time.Now(),
-			Details:   "All services operational",
-			Region:    "Global",
-		})
-	} else {
-		*services = append(*services, Service{
-			Name:      "Google Workspace",
-			Provider:  "Google",
-			Status:    "DOWN",
-			LastCheck: time.Now(),
-			Details:   "Service issues detected",
-			Region:    "Global",
-		})
+// systemInfoContent is the System Information section of a report's text
+func systemInfoContent(info SystemInfo) string {
+	var b strings.Builder
+	b.WriteString("System Information:\n")
+	b.WriteString(fmt.Sprintf("IP Address: %s\n", info.IPAddress))
+	for _, probe := range info.Probes {
+		if probe.Samples == 0 {
+			b.WriteString(fmt.Sprintf("%s (%s): pending\n", probe.Name, probe.Type))
+			continue
+		}
+		b.WriteString(fmt.Sprintf("%s (%s): min %s, avg %s, max %s, jitter %s, loss %.0f%%\n",
+			probe.Name, probe.Type, probe.Min, probe.Avg, probe.Max, probe.Jitter, probe.Loss))
 	}
-	return nil
+	lastCheck := "Pending"
+	if !info.Pending {
+		lastCheck = info.LastCheck.Format("15:04:05 MST")
+	}
+	b.WriteString(fmt.Sprintf("Last Network Check: %s\n\n", lastCheck))
+	return b.String()
 }
 
-// checkOCStatus checks Oracle Cloud status
-func checkOCStatus(services *[]Service) error {
-	resp, err := http.Get("https://ocistatus.oraclecloud.com/#/")
-	if err != nil {
-		return fmt.Errorf("error checking OCI status: %v", err)
+// refreshSystemInfo puts the latest probe statistics into the current
+// report and pushes it to the dashboards, so a report generated while the
+// first probe round was running does not show it pending until the next one
+func refreshSystemInfo() {
+	info := getSystemInfo()
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	if currentReport.Timestamp.IsZero() {
+		return
 	}
-	defer resp.Body.Close()
+	report := currentReport
+	report.Content = systemInfoContent(info) + strings.TrimPrefix(report.Content, systemInfoContent(report.SystemInfo))
+	report.SystemInfo = info
+	currentReport = report
+	events.Publish("report", report)
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("error reading OCI response: %v", err)
-	}
-
-	content := string(body)
-	if strings.Contains(content, "Service Disruption") || strings.Contains(content, "Service Outage") {
-		*services = append(*services, Service{
-			Name:      "Oracle Cloud Infrastructure",
-			Provider:  "Oracle Cloud",
-			Status:    "DOWN",
-			LastCheck: time.Now(),
-			Details:   "Service disruption or outage detected",
-			Region:    "Global",
-		})
-	} else {
-		*services = append(*services, Service{
-			Name:      "Oracle Cloud Infrastructure",
-			Provider:  "Oracle Cloud",
-			Status:    "UP",
-			LastCheck: time.Now(),
-			Details:   "All services operational",
-			Region:    "Global",
-		})
-	}
-	return nil
+// providerResult is what one checker returned, with its timing and error
+type providerResult struct {
+	check CheckResult
+	feed  FeedResult
 }
 
-// checkAzureStatus checks Azure status
-func checkAzureStatus(services *[]Service) error {
-	resp, err := http.Get("https://status.azure.com/en-us/status")
-	if err != nil {
-		return fmt.Errorf("error checking Azure status: %v", err)
-	}
-	defer resp.Body.Close()
+// checkProvider runs one checker under the check timeout. Errors, and
+// panics in the checker, are captured in the result so one bad provider
+// never affects the others.
+func checkProvider(ctx context.Context, checker StatusChecker, timeout time.Duration) (result providerResult) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("checker panicked: %v", r)
+		}
+		result.check = CheckResult{Provider: checker.Name(), Duration: time.Since(start)}
+		recordCheckMetrics(checker.Name(), err)
+		if err != nil {
+			log.Printf("Error checking %s: %v", checker.Name(), err)
+			result.check.Error = err.Error()
+			// Keep the provider on the dashboard with an UNKNOWN row
+			result.feed = FeedResult{Services: []Service{{
+				Name:      checker.Name(),
+				Provider:  checker.Name(),
+				Status:    StatusUnknown,
+				LastCheck: time.Now(),
+				Details:   fmt.Sprintf("Status check failed: %v", err),
+				Region:    "Global",
+			}}}
+		}
+	}()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("error reading Azure response: %v", err)
-	}
-
-	content := string(body)
-	if strings.Contains(content, "Service degradation") || strings.Contains(content, "Service disruption") {
-		*services = append(*services, Service{
-			Name:      "Azure Services",
-			Provider:  "Azure",
-			Status:    "DOWN",
-			LastCheck: time.Now(),
-			Details:   "Service degradation or disruption detected",
-			Region:    "Global",
-		})
+	if fc, ok := checker.(FeedChecker); ok {
+		result.feed, err = fc.CheckFeed(ctx)
 	} else {
-		*services = append(*services, Service{
-			Name:      "Azure Services",
-			Provider:  "Azure",
-			Status:    "UP",
-			LastCheck: time.Now(),
-			Details:   "All services operational",
-			Region:    "Global",
-		})
+		result.feed.Services, err = checker.Check(ctx)
 	}
-	return nil
+	return result
 }
 
-func generateReport() StatusReport {
-	var wg sync.WaitGroup
-	var services []Service
-
+// generateReport checks every provider once. Cancelling ctx aborts the
+// checks still running; they are reported as failed.
+func generateReport(ctx context.Context) StatusReport {
 	// Get system information
 	systemInfo := getSystemInfo()
 
-	// Check all providers concurrently
-	wg.Add(3)
-	go func() {
-		defer wg.Done()
-		if err := checkGoogleStatus(&services); err != nil {
-			log.Printf("Error checking Google: %v", err)
-		}
-	}()
-
-	go func() {
-		defer wg.Done()
-		if err := checkOCStatus(&services); err != nil {
-			log.Printf("Error checking OCI: %v", err)
-		}
-	}()
+	// Check all providers concurrently, each bounded by the check timeout.
+	// Every checker sends exactly one result; nothing else is shared.
+	checkTimeout := defaultHTTPConfig().CheckTimeout
+	if config := currentConfig(); config != nil {
+		checkTimeout = config.HTTP.CheckTimeout
+	}
+	registered := registeredCheckers()
+	type indexedResult struct {
+		index int
+		providerResult
+	}
+	results := make(chan indexedResult, len(registered))
+	for i, checker := range registered {
+		go func(i int, checker StatusChecker) {
+			results <- indexedResult{i, checkProvider(ctx, checker, checkTimeout)}
+		}(i, checker)
+	}
+	ordered := make([]providerResult, len(registered))
+	for range registered {
+		result := <-results
+		ordered[result.index] = result.providerResult
+	}
 
-	go func() {
-		defer wg.Done()
-		if err := checkAzureStatus(&services); err != nil {
-			log.Printf("Error checking Azure: %v", err)
+	var services []Service
+	var checks []CheckResult
+	var reported []Incident
+	var windows []Maintenance
+	for _, result := range ordered {
+		services = append(services, result.feed.Services...)
+		reported = append(reported, result.feed.Incidents...)
+		windows = append(windows, result.feed.Maintenance...)
+		checks = append(checks, result.check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Provider < checks[j].Provider })
+	sort.SliceStable(reported, func(i, j int) bool {
+		if reported[i].Provider != reported[j].Provider {
+			return reported[i].Provider < reported[j].Provider
 		}
-	}()
-
-	wg.Wait()
+		return reported[i].Started.Before(reported[j].Started)
+	})
+	sortMaintenance(windows)
 
-	// Organize services by provider
+	// Organize services by provider, keeping registration order
 	providers := make(map[string][]Service)
 	for _, service := range services {
 		providers[service.Provider] = append(providers[service.Provider], service)
 	}
+	checkErrors := make(map[string]string)
+	for _, check := range checks {
+		checkErrors[check.Provider] = check.Error
+	}
 
 	var reportProviders []Provider
-	for name, services := range providers {
-		var url string
-		switch name {
-		case "Google":
-			url = "https://www.google.com/appsstatus/dashboard/"
-		case "Oracle Cloud":
-			url = "https://ocistatus.oraclecloud.com/#/"
-		case "Azure":
-			url = "https://status.azure.com/en-us/status"
+	for _, checker := range registered {
+		services, ok := providers[checker.Name()]
+		if !ok {
+			continue
 		}
 		reportProviders = append(reportProviders, Provider{
-			Name:     name,
-			URL:      url,
+			Name:     checker.Name(),
+			URL:      checker.URL(),
 			Services: services,
+			Error:    checkErrors[checker.Name()],
 		})
 	}
 
-	// Set timezone to Pacific
-	loc, _ := time.LoadLocation("America/Los_Angeles")
+	// Use the configured display timezone
+	loc := displayLocation()
 
 	// Format report content
 	var contentBuilder strings.Builder
-	contentBuilder.WriteString("System Information:\n")
-	contentBuilder.WriteString(fmt.Sprintf("IP Address: %s\n", systemInfo.IPAddress))
-	contentBuilder.WriteString(fmt.Sprintf("Ping Latency: %s\n", systemInfo.PingLatency))
-	contentBuilder.WriteString(fmt.Sprintf("Last Network Check: %s\n\n", systemInfo.LastCheck.Format("15:04:05 MST")))
+	contentBuilder.WriteString(systemInfoContent(systemInfo))
 
 	contentBuilder.WriteString("Provider Status:\n")
 	for _, provider := range reportProviders {
-		contentBuilder.WriteString(fmt.Sprintf("\n%s:\n", provider.Name))
+		contentBuilder.WriteString(fmt.Sprintf("\n%s: %s\n", provider.Name, provider.Status().Label()))
 		for _, service := range provider.Services {
-			contentBuilder.WriteString(fmt.Sprintf("- %s: %s (%s)\n", service.Name, service.Status, service.Region))
+			contentBuilder.WriteString(fmt.Sprintf("- %s: %s (%s)\n", service.Name, service.Status.Label(), service.Region))
 			contentBuilder.WriteString(fmt.Sprintf("  Details: %s\n", service.Details))
 			contentBuilder.WriteString(fmt.Sprintf("  Last Check: %s\n", service.LastCheck.Format("15:04:05 MST")))
 		}
 	}
 
 	return StatusReport{
-		Timestamp:  time.Now().In(loc),
-		SystemInfo: systemInfo,
-		Providers:  reportProviders,
-		Content:    contentBuilder.String(),
+		Timestamp:   time.Now().In(loc),
+		SystemInfo:  systemInfo,
+		Providers:   reportProviders,
+		Checks:      checks,
+		Incidents:   reported,
+		Maintenance: windows,
+		Content:     contentBuilder.String(),
 	}
 }
 
 func handleRoot(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" && r.FormValue("action") == "refresh" {
-		// Start generating a new report
-		go func() {
-			newReport := generateReport()
-			reportMutex.Lock()
-			currentReport = newReport
-			reportMutex.Unlock()
-		}()
-		// Return success response
-		w.WriteHeader(http.StatusOK)
+		// Start generating a new report, or join the one in flight
+		requireAdmin(handleRefresh)(w, r)
 		return
 	}
 
 	reportMutex.RLock()
 	defer reportMutex.RUnlock()
 
-	tmpl, err := template.New("status").Parse(htmlTemplate)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	page := statusPage{StatusReport: currentReport, User: requestPrincipal(r)}
+	if page.Timestamp.IsZero() {
+		// No report yet; the probes may already have results, or be pending
+		page.SystemInfo = getSystemInfo()
 	}
+	pages.Execute(w, "status.html", page)
+}
 
-	if err := tmpl.Execute(w, currentReport); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+// statusPage is the data behind the dashboard: the report plus the user
+// viewing it, so admin-only controls can be hidden from viewers
+type statusPage struct {
+	StatusReport
+	User Principal
+}
+
+// annotateCurrentReport applies changed acknowledgements to the current
+// report and pushes it to live dashboards
+func annotateCurrentReport() {
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	previous := currentReport
+	currentReport.Incidents = incidents.Annotate(currentReport.Incidents)
+	publishReport(previous, currentReport)
 }
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Incident is a provider incident as described by its status feed
+type Incident struct {
+	// ID is unique within the provider
+	ID       string
+	Provider string
+	Title    string
+	Status   Status
+	// Services and Regions list what the incident affects
+	Services []string
+	Regions  []string `json:",omitempty"`
+	Started  time.Time
+	Updated  time.Time
+	Resolved time.Time `json:",omitempty"`
+	// LatestUpdate is the text of the most recent update
+	LatestUpdate string
+	Updates      []IncidentUpdate `json:",omitempty"`
+	// URL is the incident page on the provider's status site
+	URL string
+	// RCAURL links to the postmortem or root cause analysis, once published
+	RCAURL string `json:",omitempty"`
+	// Acknowledgement is set once an admin has taken note of the incident
+	Acknowledgement *Acknowledgement `json:",omitempty"`
+}
+
+// Acknowledgement records who took note of an incident, and when
+type Acknowledgement struct {
+	By   string
+	At   time.Time
+	Note string `json:",omitempty"`
+}
+
+// IncidentUpdate is a single update posted to an incident, newest first
+type IncidentUpdate struct {
+	Time time.Time
+	Text string
+}
+
+// Open reports whether the incident has not been resolved yet
+func (i Incident) Open() bool {
+	return i.Resolved.IsZero()
+}
+
+// Duration is how long the incident lasted, or has lasted so far
+func (i Incident) Duration(now time.Time) time.Duration {
+	end := i.Resolved
+	if end.IsZero() {
+		end = now
+	}
+	return end.Sub(i.Started).Round(time.Minute)
+}
+
+func incidentKey(provider, id string) string {
+	return provider + "\x00" + id
+}
+
+var (
+	urlPattern = regexp.MustCompile(`https?://[^\s"'<>()\[\]]+`)
+	// rcaURLHints mark links that point at a postmortem
+	rcaURLHints = []string{"postmortem", "post-mortem", "post-incident", "rca", "pir", "aka.ms/air", "incident-report"}
+	// rcaTextHints mark updates that are themselves the postmortem
+	rcaTextHints = []string{"incident report", "root cause analysis", "postmortem", "post-mortem", "post incident review"}
+)
+
+// findRCALink looks for a postmortem in an update. A link that looks like
+// one is returned as is; an update that reads like one returns pageURL.
+func findRCALink(text, pageURL string) string {
+	for _, link := range urlPattern.FindAllString(text, -1) {
+		lower := strings.ToLower(link)
+		for _, hint := range rcaURLHints {
+			if strings.Contains(lower, hint) {
+				return strings.TrimRight(link, ".,;:")
+			}
+		}
+	}
+	lower := strings.ToLower(text)
+	for _, hint := range rcaTextHints {
+		if strings.Contains(lower, hint) {
+			return pageURL
+		}
+	}
+	return ""
+}
+
+// IncidentTracker follows incidents from first report to resolution. An
+// open incident that disappears from a provider's feed is resolved by the
+// first report it is missing from; resolved incidents are kept so a
+// postmortem published later can still be attached.
+type IncidentTracker struct {
+	mu        sync.RWMutex
+	incidents map[string]*Incident
+}
+
+// incidentRetention is how long resolved incidents are kept in memory
+const incidentRetention = historyRetention
+
+var incidents = &IncidentTracker{incidents: make(map[string]*Incident)}
+
+// Load seeds the tracker, e.g. from history after a restart
+func (t *IncidentTracker) Load(list []Incident) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range list {
+		incident := list[i]
+		t.incidents[incidentKey(incident.Provider, incident.ID)] = &incident
+	}
+}
+
+// Observe merges the incidents in a report and returns those that opened,
+// resolved or gained a postmortem link
+func (t *IncidentTracker) Observe(report StatusReport) []Incident {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := report.Timestamp
+	checked := make(map[string]bool)
+	for _, check := range report.Checks {
+		checked[check.Provider] = check.Error == ""
+	}
+
+	var changed []Incident
+	seen := make(map[string]bool)
+	for _, incident := range report.Incidents {
+		key := incidentKey(incident.Provider, incident.ID)
+		seen[key] = true
+
+		existing, ok := t.incidents[key]
+		if !ok {
+			// Resolved before we ever saw it open; not ours to track
+			if !incident.Open() {
+				continue
+			}
+			incident := incident
+			t.incidents[key] = &incident
+			changed = append(changed, incident)
+			continue
+		}
+
+		wasOpen, hadRCA := existing.Open(), existing.RCAURL != ""
+		merged := incident
+		if merged.RCAURL == "" {
+			merged.RCAURL = existing.RCAURL
+		}
+		merged.Acknowledgement = existing.Acknowledgement
+		*existing = merged
+		if wasOpen != existing.Open() || hadRCA != (existing.RCAURL != "") {
+			changed = append(changed, *existing)
+		}
+	}
+
+	for key, existing := range t.incidents {
+		if seen[key] || !existing.Open() || !checked[existing.Provider] {
+			continue
+		}
+		existing.Resolved = now
+		changed = append(changed, *existing)
+	}
+
+	for key, existing := range t.incidents {
+		if !existing.Open() && now.Sub(existing.Resolved) > incidentRetention {
+			delete(t.incidents, key)
+		}
+	}
+	return changed
+}
+
+// Get returns a tracked incident
+func (t *IncidentTracker) Get(provider, id string) (Incident, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	incident, ok := t.incidents[incidentKey(provider, id)]
+	if !ok {
+		return Incident{}, false
+	}
+	return *incident, true
+}
+
+// Acknowledge sets or, with a nil ack, clears an incident's acknowledgement
+func (t *IncidentTracker) Acknowledge(provider, id string, ack *Acknowledgement) (Incident, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	incident, ok := t.incidents[incidentKey(provider, id)]
+	if !ok {
+		return Incident{}, false
+	}
+	incident.Acknowledgement = ack
+	return *incident, true
+}
+
+// Annotate returns a copy of the list with the tracked acknowledgements
+func (t *IncidentTracker) Annotate(list []Incident) []Incident {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	annotated := make([]Incident, len(list))
+	for i, incident := range list {
+		if tracked, ok := t.incidents[incidentKey(incident.Provider, incident.ID)]; ok {
+			incident.Acknowledgement = tracked.Acknowledgement
+		}
+		annotated[i] = incident
+	}
+	return annotated
+}
+
+// List returns tracked incidents, open ones first and then newest first
+func (t *IncidentTracker) List(provider string, openOnly bool) []Incident {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var list []Incident
+	for _, incident := range t.incidents {
+		if (provider != "" && incident.Provider != provider) || (openOnly && !incident.Open()) {
+			continue
+		}
+		list = append(list, *incident)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Open() != list[j].Open() {
+			return list[i].Open()
+		}
+		return list[i].Started.After(list[j].Started)
+	})
+	return list
+}
+
+// observeIncidents updates the tracker and stores changes in history
+func observeIncidents(report StatusReport) {
+	for _, incident := range incidents.Observe(report) {
+		if history == nil {
+			continue
+		}
+		if err := history.RecordIncident(incident); err != nil {
+			log.Printf("Error recording incident: %v", err)
+		}
+	}
+}
+
+// handleAPIIncidents lists tracked incidents as JSON, optionally filtered
+// by ?provider= and ?open=1
+func handleAPIIncidents(w http.ResponseWriter, r *http.Request) {
+	list := incidents.List(r.URL.Query().Get("provider"), r.URL.Query().Get("open") == "1")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// incidentPage is the data behind the incident drill-down page
+type incidentPage struct {
+	Incident    Incident
+	Duration    time.Duration
+	Transitions []Transition
+	User        Principal `json:"-"`
+}
+
+// handleIncident renders the drill-down page for ?provider=&id=
+func handleIncident(w http.ResponseWriter, r *http.Request) {
+	incident, ok := incidents.Get(r.URL.Query().Get("provider"), r.URL.Query().Get("id"))
+	if !ok {
+		http.Error(w, "unknown incident", http.StatusNotFound)
+		return
+	}
+
+	page := incidentPage{Incident: incident, Duration: incident.Duration(time.Now()), User: requestPrincipal(r)}
+	if history != nil {
+		end := incident.Resolved
+		if end.IsZero() {
+			end = time.Now()
+		}
+		page.Transitions = history.TransitionsFor(incident.Provider, incident.Services, incident.Started, end)
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+		return
+	}
+
+	pages.Execute(w, "incident.html", page)
+}
+
+// handleIncidentAck acknowledges the incident ?provider=&id= with an
+// optional note, or clears the acknowledgement with action=clear. The
+// change is stored in history and pushed to the dashboard at once.
+func handleIncidentAck(w http.ResponseWriter, r *http.Request) {
+	provider, id := r.FormValue("provider"), r.FormValue("id")
+	var ack *Acknowledgement
+	if r.FormValue("action") != "clear" {
+		ack = &Acknowledgement{
+			By:   requestPrincipal(r).Name,
+			At:   time.Now(),
+			Note: strings.TrimSpace(r.FormValue("note")),
+		}
+	}
+
+	incident, ok := incidents.Acknowledge(provider, id, ack)
+	if !ok {
+		http.Error(w, "unknown incident", http.StatusNotFound)
+		return
+	}
+	if history != nil {
+		if err := history.RecordIncident(incident); err != nil {
+			log.Printf("Error recording incident: %v", err)
+		}
+	}
+	annotateCurrentReport()
+
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(incident)
+		return
+	}
+	http.Redirect(w, r, incidentURL(provider, id), http.StatusSeeOther)
+}
+
+// incidentURL is the drill-down page of an incident
+func incidentURL(provider, id string) string {
+	return "/incident?" + url.Values{"provider": {provider}, "id": {id}}.Encode()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// incidentSummaries lists the incidents as "id open" or "id resolved 15:04",
+// with " rca" once a postmortem is linked
+func incidentSummaries(list []Incident) []string {
+	var summaries []string
+	for _, incident := range list {
+		summary := incident.ID + " open"
+		if !incident.Open() {
+			summary = incident.ID + " resolved " + incident.Resolved.UTC().Format("15:04")
+		}
+		if incident.RCAURL != "" {
+			summary += " rca"
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func TestIncidentTrackerTransitions(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	entry := func(minutes int, body string) feedItem {
+		return feedItem{Title: "Storage latency", GUID: "inc-1", Description: body, Published: at(minutes), Updated: at(minutes)}
+	}
+	opened := entry(0, "We are investigating increased latency.")
+	resolved := entry(60, "The issue has been resolved.")
+	review := entry(24*60, "Post Incident Review (PIR) published at https://status.example.com/pir/inc-1. The issue has been mitigated.")
+	stale := at(feedStaleWindows*24*60 + 1)
+
+	type poll struct {
+		at          time.Time
+		items       []feedItem
+		err         string
+		wantChanged []string
+	}
+	tests := []struct {
+		name  string
+		polls []poll
+	}{
+		{
+			name: "resolved by a content update",
+			polls: []poll{
+				{at: at(30), items: []feedItem{opened}, wantChanged: []string{"inc-1@20240501T080000Z open"}},
+				{at: at(45), items: []feedItem{opened}},
+				{at: at(90), items: []feedItem{resolved, opened}, wantChanged: []string{"inc-1@20240501T080000Z resolved 09:00"}},
+				{at: at(120), items: []feedItem{resolved, opened}},
+			},
+		},
+		{
+			name: "resolved before it was seen",
+			polls: []poll{
+				{at: at(90), items: []feedItem{resolved, opened}},
+			},
+		},
+		{
+			name: "resolved by age",
+			polls: []poll{
+				{at: at(30), items: []feedItem{opened}, wantChanged: []string{"inc-1@20240501T080000Z open"}},
+				// The feed drops the entry once stale, and the tracker resolves it then
+				{at: stale, items: []feedItem{opened}, wantChanged: []string{"inc-1@20240501T080000Z resolved 08:01"}},
+			},
+		},
+		{
+			name: "a failed check keeps it open",
+			polls: []poll{
+				{at: at(30), items: []feedItem{opened}, wantChanged: []string{"inc-1@20240501T080000Z open"}},
+				{at: at(45), err: "feed unavailable"},
+				{at: at(60), items: []feedItem{opened}},
+			},
+		},
+		{
+			name: "postmortem attached after resolution",
+			polls: []poll{
+				{at: at(30), items: []feedItem{opened}, wantChanged: []string{"inc-1@20240501T080000Z open"}},
+				{at: at(90), items: []feedItem{resolved, opened}, wantChanged: []string{"inc-1@20240501T080000Z resolved 09:00"}},
+				{at: at(24*60 + 30), items: []feedItem{review, resolved, opened}, wantChanged: []string{"inc-1@20240501T080000Z resolved 08:00 rca"}},
+				// The link is kept once the review has scrolled off the feed
+				{at: at(25*60 + 30), items: []feedItem{resolved, opened}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := &IncidentTracker{incidents: make(map[string]*Incident)}
+			for i, poll := range test.polls {
+				report := StatusReport{Timestamp: poll.at, Checks: []CheckResult{{Provider: "Azure", Error: poll.err}}}
+				if poll.err == "" {
+					_, report.Incidents = feedItemsToServices(poll.items, "Azure", "Azure Services", 24*time.Hour, poll.at)
+				}
+				changed := incidentSummaries(tracker.Observe(report))
+				if strings.Join(changed, ", ") != strings.Join(poll.wantChanged, ", ") {
+					t.Errorf("poll %d: changed %v, want %v", i, changed, poll.wantChanged)
+				}
+			}
+		})
+	}
+}
+
+func TestIncidentTrackerKeepsAcknowledgement(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	tracker := &IncidentTracker{incidents: make(map[string]*Incident)}
+	incident := Incident{ID: "inc-1", Provider: "Azure", Title: "Storage latency", Started: start}
+	report := func(at time.Time, list ...Incident) StatusReport {
+		return StatusReport{Timestamp: at, Checks: []CheckResult{{Provider: "Azure"}}, Incidents: list}
+	}
+
+	tracker.Observe(report(start, incident))
+	if _, ok := tracker.Acknowledge("Azure", "inc-1", &Acknowledgement{By: "admin", At: start}); !ok {
+		t.Fatal("incident not tracked")
+	}
+	incident.LatestUpdate = "A fix is being deployed."
+	if changed := tracker.Observe(report(start.Add(time.Hour), incident)); len(changed) != 0 {
+		t.Errorf("an update without a transition reported %v", incidentSummaries(changed))
+	}
+	got, _ := tracker.Get("Azure", "inc-1")
+	if got.Acknowledgement == nil || got.Acknowledgement.By != "admin" || got.LatestUpdate != incident.LatestUpdate {
+		t.Errorf("got %+v, want the update with the acknowledgement kept", got)
+	}
+
+	// Resolved incidents are forgotten after the retention period
+	tracker.Observe(report(start.Add(2 * time.Hour)))
+	tracker.Observe(report(start.Add(2*time.Hour + incidentRetention + time.Minute)))
+	if _, ok := tracker.Get("Azure", "inc-1"); ok {
+		t.Error("resolved incident kept past the retention period")
+	}
+}
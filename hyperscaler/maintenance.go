@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maintenance is a planned maintenance window announced by a provider
+type Maintenance struct {
+	// ID is unique within the provider
+	ID       string
+	Provider string
+	Title    string
+	// State is the provider's own state, e.g. scheduled, in_progress or completed
+	State string
+	// Services and Regions list what the window affects; no regions means all
+	Services []string
+	Regions  []string `json:",omitempty"`
+	Start    time.Time
+	End      time.Time
+	Updated  time.Time `json:",omitempty"`
+	// Description is the latest announcement text
+	Description string `json:",omitempty"`
+	URL         string
+}
+
+// Active reports whether the window is in progress
+func (m Maintenance) Active(now time.Time) bool {
+	return !now.Before(m.Start) && now.Before(m.End) && m.State != "completed"
+}
+
+// Finished reports whether the window is over
+func (m Maintenance) Finished(now time.Time) bool {
+	return m.State == "completed" || !now.Before(m.End)
+}
+
+// InRegions reports whether the window affects any of the regions, which
+// may use shell-style wildcards. A window without regions affects them all.
+func (m Maintenance) InRegions(regions []string) bool {
+	if len(regions) == 0 || len(m.Regions) == 0 {
+		return true
+	}
+	for _, pattern := range regions {
+		for _, region := range m.Regions {
+			if matchField(pattern, region) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sortMaintenance orders windows by start time, then provider
+func sortMaintenance(windows []Maintenance) {
+	sort.Slice(windows, func(i, j int) bool {
+		if !windows[i].Start.Equal(windows[j].Start) {
+			return windows[i].Start.Before(windows[j].Start)
+		}
+		if windows[i].Provider != windows[j].Provider {
+			return windows[i].Provider < windows[j].Provider
+		}
+		return windows[i].ID < windows[j].ID
+	})
+}
+
+// MaintenanceConfig selects the windows shown on the dashboard
+type MaintenanceConfig struct {
+	// Regions we care about, with wildcards; empty shows every region
+	Regions []string `yaml:"regions"`
+	// Horizon is how far ahead upcoming windows are shown
+	Horizon time.Duration `yaml:"horizon"`
+}
+
+// defaultMaintenanceConfig shows every region two weeks ahead
+func defaultMaintenanceConfig() MaintenanceConfig {
+	return MaintenanceConfig{Horizon: 14 * 24 * time.Hour}
+}
+
+func (c *MaintenanceConfig) validate() error {
+	if c.Horizon <= 0 {
+		return fmt.Errorf("maintenance.horizon must be positive")
+	}
+	for _, pattern := range c.Regions {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("maintenance.regions: bad pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// maintenanceRetention is how long finished windows stay in the calendar
+const maintenanceRetention = 7 * 24 * time.Hour
+
+// MaintenanceCalendar keeps the windows announced by each provider. A
+// provider's windows are replaced by every successful check; a window that
+// disappears before it starts was cancelled and is dropped, one that
+// disappears after it started is kept as completed.
+type MaintenanceCalendar struct {
+	mu      sync.RWMutex
+	windows map[string]*Maintenance
+}
+
+var maintenance = &MaintenanceCalendar{windows: make(map[string]*Maintenance)}
+
+// Observe merges the windows in a report
+func (c *MaintenanceCalendar) Observe(report StatusReport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := report.Timestamp
+	checked := make(map[string]bool)
+	for _, check := range report.Checks {
+		checked[check.Provider] = check.Error == ""
+	}
+
+	seen := make(map[string]bool)
+	for _, window := range report.Maintenance {
+		key := incidentKey(window.Provider, window.ID)
+		seen[key] = true
+		window := window
+		c.windows[key] = &window
+	}
+
+	for key, window := range c.windows {
+		if seen[key] || !checked[window.Provider] || window.State == "completed" {
+			continue
+		}
+		if now.Before(window.Start) {
+			delete(c.windows, key)
+			continue
+		}
+		window.State = "completed"
+		if now.Before(window.End) {
+			window.End = now
+		}
+	}
+
+	for key, window := range c.windows {
+		if window.Finished(now) && now.Sub(window.End) > maintenanceRetention {
+			delete(c.windows, key)
+		}
+	}
+}
+
+// MaintenanceFilter selects windows from the calendar
+type MaintenanceFilter struct {
+	Provider string
+	Regions  []string
+	// From and To bound the windows by overlap; zero means unbounded
+	From time.Time
+	To   time.Time
+}
+
+// List returns the windows matching the filter, soonest first
+func (c *MaintenanceCalendar) List(filter MaintenanceFilter) []Maintenance {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var list []Maintenance
+	for _, window := range c.windows {
+		if filter.Provider != "" && !strings.EqualFold(window.Provider, filter.Provider) {
+			continue
+		}
+		if !filter.From.IsZero() && window.End.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && window.Start.After(filter.To) {
+			continue
+		}
+		if !window.InRegions(filter.Regions) {
+			continue
+		}
+		list = append(list, *window)
+	}
+	sortMaintenance(list)
+	return list
+}
+
+// maintenanceFilter builds a filter from the query. By default it shows the
+// windows that are in progress or start within the configured horizon, in
+// the configured regions. ?provider= and ?region= narrow the list, ?all=1
+// lists every region and every window still in the calendar.
+func maintenanceFilter(r *http.Request) MaintenanceFilter {
+	settings := defaultMaintenanceConfig()
+	if config := currentConfig(); config != nil {
+		settings = config.Maintenance
+	}
+	query := r.URL.Query()
+	filter := MaintenanceFilter{Provider: query.Get("provider")}
+	if query.Get("all") != "1" {
+		now := time.Now()
+		filter.From = now
+		filter.To = now.Add(settings.Horizon)
+		filter.Regions = settings.Regions
+	}
+	if region := query.Get("region"); region != "" {
+		filter.Regions = splitList(region)
+	}
+	return filter
+}
+
+// handleAPIMaintenance lists maintenance windows as JSON
+func handleAPIMaintenance(w http.ResponseWriter, r *http.Request) {
+	list := maintenance.List(maintenanceFilter(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleMaintenanceICS exports maintenance windows as an iCalendar feed,
+// with the same filters as /api/maintenance
+func handleMaintenanceICS(w http.ResponseWriter, r *http.Request) {
+	list := maintenance.List(maintenanceFilter(r))
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="hyperscaler-maintenance.ics"`)
+	w.Write([]byte(maintenanceICS(list, time.Now())))
+}
+
+// maintenanceICS renders windows as an RFC 5545 calendar
+func maintenanceICS(windows []Maintenance, now time.Time) string {
+	var b strings.Builder
+	line := func(name, value string) {
+		b.WriteString(icsFold(name + ":" + value))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//hyperscaler//maintenance//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", "Provider maintenance")
+	for _, window := range windows {
+		stamp := window.Updated
+		if stamp.IsZero() {
+			stamp = now
+		}
+		end := window.End
+		if !end.After(window.Start) {
+			end = window.Start.Add(time.Hour)
+		}
+
+		description := []string{}
+		if len(window.Services) > 0 {
+			description = append(description, "Services: "+strings.Join(window.Services, ", "))
+		}
+		if len(window.Regions) > 0 {
+			description = append(description, "Regions: "+strings.Join(window.Regions, ", "))
+		}
+		if window.Description != "" {
+			description = append(description, window.Description)
+		}
+
+		line("BEGIN", "VEVENT")
+		line("UID", icsEscape(window.ID+"@"+strings.ToLower(window.Provider)+".hyperscaler"))
+		line("DTSTAMP", icsTime(stamp))
+		line("DTSTART", icsTime(window.Start))
+		line("DTEND", icsTime(end))
+		line("SUMMARY", icsEscape(fmt.Sprintf("[%s] %s", window.Provider, window.Title)))
+		if len(description) > 0 {
+			line("DESCRIPTION", icsEscape(strings.Join(description, "\n\n")))
+		}
+		if len(window.Regions) > 0 {
+			line("LOCATION", icsEscape(strings.Join(window.Regions, ", ")))
+		}
+		if window.URL != "" {
+			line("URL", window.URL)
+		}
+		line("CATEGORIES", "MAINTENANCE")
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icsEscape escapes a TEXT value
+func icsEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// icsFold splits a content line into 75-octet pieces, without breaking a
+// UTF-8 sequence
+func icsFold(line string) string {
+	const limit = 75
+	var b strings.Builder
+	size := 0
+	for _, r := range line {
+		n := len(string(r))
+		if size+n > limit {
+			b.WriteString("\r\n ")
+			// The leading space counts toward the next line
+			size = 1
+		}
+		b.WriteRune(r)
+		size += n
+	}
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// calendarSummaries lists the windows as "id state start-end"
+func calendarSummaries(calendar *MaintenanceCalendar) []string {
+	var summaries []string
+	for _, window := range calendar.List(MaintenanceFilter{}) {
+		summaries = append(summaries, window.ID+" "+window.State+" "+window.Start.Format("15:04")+"-"+window.End.Format("15:04"))
+	}
+	return summaries
+}
+
+func TestMaintenanceCalendarObserve(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	at := func(hours float64) time.Time { return start.Add(time.Duration(hours * float64(time.Hour))) }
+	window := func(id, state string, from, to float64) Maintenance {
+		return Maintenance{ID: id, Provider: "GitHub", Title: "Database upgrade", State: state, Start: at(from), End: at(to)}
+	}
+	upcoming := window("m1", "scheduled", 4, 6)
+	running := window("m2", "in_progress", 1, 3)
+	cancelled := window("m3", "scheduled", 10, 11)
+
+	calendar := &MaintenanceCalendar{windows: make(map[string]*Maintenance)}
+	polls := []struct {
+		name    string
+		at      time.Time
+		err     string
+		windows []Maintenance
+		want    []string
+	}{
+		{"first poll", at(2), "", []Maintenance{upcoming, running, cancelled},
+			[]string{"m2 in_progress 09:00-11:00", "m1 scheduled 12:00-14:00", "m3 scheduled 18:00-19:00"}},
+		// Every poll lists the same windows again; each is kept once, as last announced
+		{"second poll", at(2.5), "", []Maintenance{window("m1", "scheduled", 4, 7), running, cancelled},
+			[]string{"m2 in_progress 09:00-11:00", "m1 scheduled 12:00-15:00", "m3 scheduled 18:00-19:00"}},
+		{"failed check", at(2.75), "feed unavailable", nil,
+			[]string{"m2 in_progress 09:00-11:00", "m1 scheduled 12:00-15:00", "m3 scheduled 18:00-19:00"}},
+		// m2 ended early and m3 was cancelled before it started
+		{"gone from the feed", at(2.75), "", []Maintenance{window("m1", "scheduled", 4, 7)},
+			[]string{"m2 completed 09:00-10:45", "m1 scheduled 12:00-15:00"}},
+		{"completed", at(8), "", []Maintenance{window("m1", "completed", 4, 7)},
+			[]string{"m2 completed 09:00-10:45", "m1 completed 12:00-15:00"}},
+		{"past the retention", at(2.75).Add(maintenanceRetention + time.Minute), "", nil,
+			[]string{"m1 completed 12:00-15:00"}},
+	}
+	for _, poll := range polls {
+		calendar.Observe(StatusReport{
+			Timestamp:   poll.at,
+			Checks:      []CheckResult{{Provider: "GitHub", Error: poll.err}},
+			Maintenance: poll.windows,
+		})
+		if got := calendarSummaries(calendar); strings.Join(got, ", ") != strings.Join(poll.want, ", ") {
+			t.Errorf("%s: calendar %v, want %v", poll.name, got, poll.want)
+		}
+	}
+}
+
+func TestMaintenanceICSEscapesAndFolds(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	window := Maintenance{
+		ID:          "m1",
+		Provider:    "Azure",
+		Title:       "Network upgrade; West Europe, North Europe",
+		Regions:     []string{"westeurope", "northeurope"},
+		Start:       start,
+		End:         start.Add(2 * time.Hour),
+		Description: "Brief connectivity loss is expected.\nNo action is required – connections retry automatically, so customers should see at most a few seconds of errors (C:\\ paths unaffected).",
+	}
+
+	ics := maintenanceICS([]Maintenance{window}, start)
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a character: %q", line)
+		}
+	}
+
+	// Unfold, then look the properties up
+	properties := make(map[string]string)
+	for _, line := range strings.Split(strings.ReplaceAll(ics, "\r\n ", ""), "\r\n") {
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			properties[name] = value
+		}
+	}
+	want := map[string]string{
+		"SUMMARY":     `[Azure] Network upgrade\; West Europe\, North Europe`,
+		"DESCRIPTION": `Regions: westeurope\, northeurope\n\nBrief connectivity loss is expected.\nNo action is required – connections retry automatically\, so customers should see at most a few seconds of errors (C:\\ paths unaffected).`,
+		"LOCATION":    `westeurope\, northeurope`,
+		"DTSTART":     "20240501T080000Z",
+		"DTEND":       "20240501T100000Z",
+	}
+	for name, value := range want {
+		if properties[name] != value {
+			t.Errorf("%s: got %q, want %q", name, properties[name], value)
+		}
+	}
+}
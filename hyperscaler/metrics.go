@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// checkErrors counts failed checks per provider since startup
+	checkErrors  = make(map[string]int)
+	checkTotals  = make(map[string]int)
+	metricsMutex sync.Mutex
+)
+
+// recordCheckMetrics updates the cumulative check counters for a provider
+func recordCheckMetrics(provider string, err error) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	checkTotals[provider]++
+	if err != nil {
+		checkErrors[provider]++
+	}
+}
+
+// handleAPIStatus serves the current report as JSON. The report is copied
+// first so a slow client does not hold up the next one being published.
+func handleAPIStatus(w http.ResponseWriter, r *http.Request) {
+	reportMutex.RLock()
+	report := currentReport
+	reportMutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleMetrics exposes the current report in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	reportMutex.RLock()
+	report := currentReport
+	reportMutex.RUnlock()
+
+	var b strings.Builder
+	services := metricServices(report)
+
+	writeMetricHeader(&b, "hyperscaler_service_up", "gauge", "Whether a provider service is operational or in maintenance (1) or not (0).")
+	for _, service := range services {
+		writeMetric(&b, "hyperscaler_service_up", boolValue(service.Status.Healthy()),
+			"provider", service.Provider, "service", service.Name, "region", service.Region)
+	}
+
+	writeMetricHeader(&b, "hyperscaler_service_severity", "gauge", "Service status severity: 0 operational, 1 maintenance, 2 unknown, 3 degraded, 4 partial outage, 5 major outage.")
+	for _, service := range services {
+		writeMetric(&b, "hyperscaler_service_severity", float64(service.Status.Severity()),
+			"provider", service.Provider, "service", service.Name, "region", service.Region, "status", string(service.Status))
+	}
+
+	writeMetricHeader(&b, "hyperscaler_provider_up", "gauge", "Whether every service of a provider is healthy (1) or not (0).")
+	for _, provider := range report.Providers {
+		writeMetric(&b, "hyperscaler_provider_up", boolValue(provider.Status().Healthy()), "provider", provider.Name)
+	}
+
+	writeMetricHeader(&b, "hyperscaler_provider_severity", "gauge", "Severity of the worst service status per provider.")
+	for _, provider := range report.Providers {
+		writeMetric(&b, "hyperscaler_provider_severity", float64(provider.Status().Severity()), "provider", provider.Name)
+	}
+
+	writeMetricHeader(&b, "hyperscaler_check_duration_seconds", "gauge", "Duration of the last status check per provider.")
+	for _, check := range report.Checks {
+		writeMetric(&b, "hyperscaler_check_duration_seconds", check.Duration.Seconds(), "provider", check.Provider)
+	}
+
+	writeMetricHeader(&b, "hyperscaler_check_success", "gauge", "Whether the last status check per provider succeeded.")
+	for _, check := range report.Checks {
+		writeMetric(&b, "hyperscaler_check_success", boolValue(check.Error == ""), "provider", check.Provider)
+	}
+
+	metricsMutex.Lock()
+	providers := make([]string, 0, len(checkTotals))
+	for provider := range checkTotals {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	writeMetricHeader(&b, "hyperscaler_checks_total", "counter", "Status checks run per provider since startup.")
+	for _, provider := range providers {
+		writeMetric(&b, "hyperscaler_checks_total", float64(checkTotals[provider]), "provider", provider)
+	}
+	writeMetricHeader(&b, "hyperscaler_check_errors_total", "counter", "Failed status checks per provider since startup.")
+	for _, provider := range providers {
+		writeMetric(&b, "hyperscaler_check_errors_total", float64(checkErrors[provider]), "provider", provider)
+	}
+	metricsMutex.Unlock()
+
+	writeMetricHeader(&b, "hyperscaler_last_report_timestamp_seconds", "gauge", "Unix time the current report was generated.")
+	if !report.Timestamp.IsZero() {
+		writeMetric(&b, "hyperscaler_last_report_timestamp_seconds", float64(report.Timestamp.Unix()))
+	}
+
+	// Probes run on their own schedule, so report their latest window
+	info := probes.SystemInfo()
+	writeMetricHeader(&b, "hyperscaler_probe_rtt_seconds", "gauge", "Probe round-trip time over the rolling window, by statistic.")
+	for _, probe := range info.Probes {
+		if probe.Samples == probe.Lost {
+			continue
+		}
+		for _, stat := range []struct {
+			name  string
+			value Latency
+		}{{"min", probe.Min}, {"avg", probe.Avg}, {"max", probe.Max}, {"jitter", probe.Jitter}} {
+			writeMetric(&b, "hyperscaler_probe_rtt_seconds", time.Duration(stat.value).Seconds(),
+				"target", probe.Name, "type", probe.Type, "stat", stat.name)
+		}
+	}
+	writeMetricHeader(&b, "hyperscaler_probe_loss_ratio", "gauge", "Fraction of probe samples lost over the rolling window.")
+	for _, probe := range info.Probes {
+		if probe.Samples > 0 {
+			writeMetric(&b, "hyperscaler_probe_loss_ratio", probe.Loss/100, "target", probe.Name, "type", probe.Type)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, b.String())
+}
+
+// metricServices returns one service per provider, name and region, since
+// Prometheus rejects a scrape that repeats a label set. A feed can list the
+// same component twice, for example under two incidents; the worst status wins.
+func metricServices(report StatusReport) []Service {
+	var services []Service
+	index := make(map[string]int)
+	for _, provider := range report.Providers {
+		for _, service := range provider.Services {
+			key := serviceKey(service)
+			if i, ok := index[key]; ok {
+				if service.Status.Severity() > services[i].Status.Severity() {
+					services[i] = service
+				}
+				continue
+			}
+			index[key] = len(services)
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+func writeMetricHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
+
+// writeMetric writes a sample; labels are given as name/value pairs
+func writeMetric(b *strings.Builder, name string, value float64, labels ...string) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		b.WriteString("}")
+	}
+	fmt.Fprintf(b, " %g\n", value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleMetricsDedupesServices(t *testing.T) {
+	reportMutex.Lock()
+	previous := currentReport
+	currentReport = providerReport(currentReport.Timestamp, "P",
+		Service{Name: "Compute", Region: "us-east-1", Status: StatusDegraded},
+		Service{Name: "Compute", Region: "us-east-1", Status: StatusMajorOutage},
+		Service{Name: "Compute", Region: "us-east-1", Status: StatusOperational},
+		Service{Name: "Compute", Region: "eu-west-1", Status: StatusOperational},
+	)
+	reportMutex.Unlock()
+	t.Cleanup(func() {
+		reportMutex.Lock()
+		currentReport = previous
+		reportMutex.Unlock()
+	})
+
+	recorder := httptest.NewRecorder()
+	handleMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		series := line[:strings.LastIndex(line, " ")]
+		if seen[series] {
+			t.Errorf("duplicate series %s", series)
+		}
+		seen[series] = true
+	}
+	for _, want := range []string{
+		`hyperscaler_service_up{provider="P",service="Compute",region="us-east-1"} 0`,
+		`hyperscaler_service_severity{provider="P",service="Compute",region="us-east-1",status="MAJOR_OUTAGE"} 5`,
+		`hyperscaler_service_up{provider="P",service="Compute",region="eu-west-1"} 1`,
+	} {
+		if !strings.Contains(recorder.Body.String(), want+"\n") {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
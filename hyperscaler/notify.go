@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alert describes a single service changing state
+type Alert struct {
+	Time     time.Time
+	Provider string
+	Service  string
+	Region   string
+	From     Status
+	To       Status
+	Details  string
+}
+
+// Summary returns a one-line description of the alert
+func (a Alert) Summary() string {
+	return fmt.Sprintf("[%s] %s (%s): %s -> %s", a.Provider, a.Service, a.Region, a.From.Label(), a.To.Label())
+}
+
+// Notifier delivers alerts to an external target
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alerts []Alert) error
+}
+
+// AlertConfig controls which notifiers are used and when they fire
+type AlertConfig struct {
+	WebhookURL      string   `yaml:"webhook_url"`
+	SlackWebhookURL string   `yaml:"slack_webhook_url"`
+	SMTPAddr        string   `yaml:"smtp_addr"`
+	SMTPFrom        string   `yaml:"smtp_from"`
+	SMTPTo          []string `yaml:"smtp_to"`
+	SMTPUsername    string   `yaml:"smtp_username"`
+	SMTPPassword    string   `yaml:"smtp_password"`
+	ExecCommand     string   `yaml:"exec_command"`
+	// Debounce is the minimum time between alerts for the same provider
+	Debounce time.Duration `yaml:"debounce"`
+	// QuietHours suppresses alerts between two "HH:MM" times, e.g. "22:00-07:00"
+	QuietHours string         `yaml:"quiet_hours"`
+	Location   *time.Location `yaml:"-"`
+}
+
+// buildNotifiers creates a notifier for every target set in the config
+func buildNotifiers(config AlertConfig) []Notifier {
+	var notifiers []Notifier
+	if config.WebhookURL != "" {
+		notifiers = append(notifiers, &webhookNotifier{URL: config.WebhookURL})
+	}
+	if config.SlackWebhookURL != "" {
+		notifiers = append(notifiers, &slackNotifier{URL: config.SlackWebhookURL})
+	}
+	if config.SMTPAddr != "" && len(config.SMTPTo) > 0 {
+		notifiers = append(notifiers, &emailNotifier{
+			Addr:     config.SMTPAddr,
+			From:     config.SMTPFrom,
+			To:       config.SMTPTo,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+		})
+	}
+	if config.ExecCommand != "" {
+		notifiers = append(notifiers, &execNotifier{Command: config.ExecCommand})
+	}
+	return notifiers
+}
+
+// AlertManager diffs consecutive reports and sends alerts for state changes.
+// It remembers the last state it notified for each service, so a change that
+// is suppressed by debounce or quiet hours is sent later if it persists, and
+// a flap that returns to the notified state produces no alert at all.
+// Changes between healthy states (operational and maintenance) and changes
+// to Unknown are tracked without alerting.
+type AlertManager struct {
+	mu          sync.Mutex
+	notifiers   []Notifier
+	debounce    time.Duration
+	quietStart  int
+	quietEnd    int
+	quiet       bool
+	location    *time.Location
+	initialized bool
+	notified    map[string]Alert
+	lastSent    map[string]time.Time
+	// now is the clock used by Observe; tests replace it
+	now func() time.Time
+}
+
+// NewAlertManager creates an AlertManager from the config
+func NewAlertManager(config AlertConfig) (*AlertManager, error) {
+	manager := &AlertManager{
+		notified: make(map[string]Alert),
+		lastSent: make(map[string]time.Time),
+		now:      time.Now,
+	}
+	if err := manager.Reconfigure(config); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// Reconfigure replaces the notifiers and timing rules, keeping the notified state
+func (m *AlertManager) Reconfigure(config AlertConfig) error {
+	var start, end int
+	if config.QuietHours != "" {
+		var err error
+		if start, end, err = parseQuietHours(config.QuietHours); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.notifiers = buildNotifiers(config)
+	m.debounce = config.Debounce
+	m.quietStart, m.quietEnd, m.quiet = start, end, config.QuietHours != ""
+	m.location = config.Location
+	if m.location == nil {
+		m.location = time.Local
+	}
+	return nil
+}
+
+// parseQuietHours parses "HH:MM-HH:MM" into minutes since midnight
+func parseQuietHours(value string) (int, int, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid quiet hours %q, expected HH:MM-HH:MM", value)
+	}
+	var minutes [2]int
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid quiet hours %q: %v", value, err)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	return minutes[0], minutes[1], nil
+}
+
+// inQuietHours reports whether t falls inside the quiet window
+func (m *AlertManager) inQuietHours(t time.Time) bool {
+	if !m.quiet {
+		return false
+	}
+	t = t.In(m.location)
+	minute := t.Hour()*60 + t.Minute()
+	if m.quietStart <= m.quietEnd {
+		return minute >= m.quietStart && minute < m.quietEnd
+	}
+	// Window wraps past midnight
+	return minute >= m.quietStart || minute < m.quietEnd
+}
+
+// Observe compares a report with the last notified state and sends any alerts
+func (m *AlertManager) Observe(report StatusReport) {
+	alerts := m.pendingAlerts(report, m.now())
+	if len(alerts) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	notifiers := m.notifiers
+	m.mu.Unlock()
+
+	for _, notifier := range notifiers {
+		go func(notifier Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := notifier.Notify(ctx, alerts); err != nil {
+				log.Printf("Error sending alerts via %s: %v", notifier.Name(), err)
+			}
+		}(notifier)
+	}
+}
+
+// pendingAlerts updates the notified state and returns the alerts to send
+func (m *AlertManager) pendingAlerts(report StatusReport, now time.Time) []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := make(map[string]Alert)
+	checked := make(map[string]bool)
+	for _, provider := range report.Providers {
+		// A failed check says nothing about the services, so keep their last state
+		if provider.Error != "" {
+			continue
+		}
+		checked[provider.Name] = true
+		for _, service := range provider.Services {
+			if service.Status == StatusUnknown {
+				continue
+			}
+			current[serviceKey(service)] = Alert{
+				Provider: service.Provider,
+				Service:  service.Name,
+				Region:   service.Region,
+				To:       service.Status,
+				Details:  service.Details,
+			}
+		}
+	}
+
+	// The first report only establishes the baseline
+	if !m.initialized {
+		m.notified = current
+		m.initialized = true
+		return nil
+	}
+
+	var changes []Alert
+	for key, state := range current {
+		from := StatusOperational
+		if previous, ok := m.notified[key]; ok {
+			from = previous.To
+		}
+		if from == state.To {
+			continue
+		}
+		if from.Healthy() && state.To.Healthy() {
+			m.notified[key] = state
+			continue
+		}
+		state.From = from
+		changes = append(changes, state)
+	}
+	// Services that dropped out of a checked provider's feed have recovered
+	for key, previous := range m.notified {
+		if _, ok := current[key]; ok || !checked[previous.Provider] {
+			continue
+		}
+		if previous.To.Healthy() {
+			delete(m.notified, key)
+			continue
+		}
+		changes = append(changes, Alert{
+			Provider: previous.Provider,
+			Service:  previous.Service,
+			Region:   previous.Region,
+			From:     previous.To,
+			To:       StatusOperational,
+			Details:  "No longer reported",
+		})
+	}
+
+	if len(changes) == 0 || m.inQuietHours(now) {
+		return nil
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.Region < b.Region
+	})
+
+	var alerts []Alert
+	sentProviders := make(map[string]bool)
+	for _, alert := range changes {
+		if last, ok := m.lastSent[alert.Provider]; ok && now.Sub(last) < m.debounce && !sentProviders[alert.Provider] {
+			continue
+		}
+		alert.Time = now
+		alerts = append(alerts, alert)
+		sentProviders[alert.Provider] = true
+
+		key := serviceKey(Service{Provider: alert.Provider, Name: alert.Service, Region: alert.Region})
+		if alert.To == StatusOperational && alert.Details == "No longer reported" {
+			delete(m.notified, key)
+		} else {
+			m.notified[key] = alert
+		}
+	}
+	for provider := range sentProviders {
+		m.lastSent[provider] = now
+	}
+	return alerts
+}
+
+// webhookNotifier posts the alerts as a JSON document
+type webhookNotifier struct {
+	URL string
+}
+
+func (n *webhookNotifier) Name() string { return "webhook" }
+
+func (n *webhookNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"alerts": alerts,
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.URL, payload)
+}
+
+// slackNotifier posts a Slack incoming-webhook compatible message
+type slackNotifier struct {
+	URL string
+}
+
+func (n *slackNotifier) Name() string { return "slack" }
+
+func (n *slackNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	var text strings.Builder
+	for _, alert := range alerts {
+		icon := ":red_circle:"
+		switch {
+		case alert.To.Healthy():
+			icon = ":large_green_circle:"
+		case alert.To == StatusDegraded:
+			icon = ":large_yellow_circle:"
+		}
+		text.WriteString(fmt.Sprintf("%s *%s* %s (%s): %s → %s\n", icon, alert.Provider, alert.Service, alert.Region, alert.From.Label(), alert.To.Label()))
+		if alert.Details != "" {
+			text.WriteString(fmt.Sprintf(">%s\n", alert.Details))
+		}
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"text": text.String(),
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.URL, payload)
+}
+
+func postJSON(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// emailNotifier sends a plain-text email through an SMTP relay
+type emailNotifier struct {
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+func (n *emailNotifier) Name() string { return "email" }
+
+// message builds the email. The subject comes from feed text, so line
+// breaks in it are folded into spaces and anything else that is unsafe in
+// a header is Q-encoded; it cannot add headers of its own.
+func (n *emailNotifier) message(alerts []Alert) []byte {
+	subject := alerts[0].Summary()
+	if len(alerts) > 1 {
+		subject = fmt.Sprintf("%d hyperscaler status changes", len(alerts))
+	}
+	subject = mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject), " "))
+
+	var body strings.Builder
+	body.WriteString(fmt.Sprintf("From: %s\r\n", n.From))
+	body.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(n.To, ", ")))
+	body.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	for _, alert := range alerts {
+		body.WriteString(alert.Summary() + "\r\n")
+		if alert.Details != "" {
+			body.WriteString("  " + alert.Details + "\r\n")
+		}
+	}
+	return []byte(body.String())
+}
+
+func (n *emailNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	message := n.message(alerts)
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		host := n.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+
+	// net/smtp has no context support, so run it in the background
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(n.Addr, auth, n.From, n.To, message)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// execNotifier runs a local command with the alerts as JSON on stdin
+type execNotifier struct {
+	Command string
+}
+
+func (n *execNotifier) Name() string { return "exec" }
+
+func (n *execNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	payload, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", n.Command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("HYPERSCALER_ALERT_COUNT=%d", len(alerts)),
+		"HYPERSCALER_ALERT_SUMMARY="+alerts[0].Summary(),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
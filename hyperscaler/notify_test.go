@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNotifier hands every batch of alerts to the test
+type fakeNotifier struct {
+	sent chan []Alert
+}
+
+func (n *fakeNotifier) Name() string { return "fake" }
+
+func (n *fakeNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	n.sent <- alerts
+	return nil
+}
+
+// alertHarness drives an AlertManager with a fake notifier and clock
+type alertHarness struct {
+	t        *testing.T
+	manager  *AlertManager
+	notifier *fakeNotifier
+	now      time.Time
+}
+
+func newAlertHarness(t *testing.T, config AlertConfig, start time.Time) *alertHarness {
+	t.Helper()
+	config.Location = time.UTC
+	manager, err := NewAlertManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &alertHarness{t: t, manager: manager, notifier: &fakeNotifier{sent: make(chan []Alert, 10)}, now: start}
+	manager.notifiers = []Notifier{h.notifier}
+	manager.now = func() time.Time { return h.now }
+	return h
+}
+
+// observe advances the clock to at and returns the alerts sent for the report
+func (h *alertHarness) observe(at time.Time, services ...Service) []Alert {
+	h.t.Helper()
+	h.now = at
+	h.manager.Observe(providerReport(at, "P", services...))
+	select {
+	case alerts := <-h.notifier.sent:
+		return alerts
+	case <-time.After(50 * time.Millisecond):
+		return nil
+	}
+}
+
+// alertSummaries lists the alerts as "service from->to"
+func alertSummaries(alerts []Alert) []string {
+	var summaries []string
+	for _, alert := range alerts {
+		summaries = append(summaries, alert.Service+" "+string(alert.From)+"->"+string(alert.To))
+	}
+	return summaries
+}
+
+func assertAlerts(t *testing.T, step string, got []Alert, want ...string) {
+	t.Helper()
+	if summaries := alertSummaries(got); strings.Join(summaries, ", ") != strings.Join(want, ", ") {
+		t.Errorf("%s: alerts %v, want %v", step, summaries, want)
+	}
+}
+
+func TestAlertManagerBaselineAndDebounce(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h := newAlertHarness(t, AlertConfig{Debounce: 15 * time.Minute}, start)
+	compute := Service{Name: "Compute", Region: "Global", Status: StatusMajorOutage}
+	storage := Service{Name: "Storage", Region: "Global", Status: StatusOperational}
+	with := func(service Service, status Status) Service {
+		service.Status = status
+		return service
+	}
+
+	// An outage already in progress at startup is the baseline, not news
+	assertAlerts(t, "baseline", h.observe(start, compute, storage))
+	assertAlerts(t, "unchanged", h.observe(start.Add(time.Minute), compute, storage))
+
+	assertAlerts(t, "first change", h.observe(start.Add(2*time.Minute), compute, with(storage, StatusDegraded)),
+		"Storage OPERATIONAL->DEGRADED")
+	// Within the debounce period of the last alert for the provider
+	assertAlerts(t, "debounced", h.observe(start.Add(5*time.Minute), compute, with(storage, StatusMajorOutage)))
+	// The change persisted, so it is sent once the debounce period is over
+	assertAlerts(t, "after debounce", h.observe(start.Add(20*time.Minute), compute, with(storage, StatusMajorOutage)),
+		"Storage DEGRADED->MAJOR_OUTAGE")
+
+	// A flap back to the notified state during the debounce period is never sent
+	assertAlerts(t, "flap", h.observe(start.Add(21*time.Minute), compute, with(storage, StatusDegraded)))
+	assertAlerts(t, "flap recovered", h.observe(start.Add(40*time.Minute), compute, with(storage, StatusMajorOutage)))
+
+	// A failed check keeps the last known state
+	h.now = start.Add(60 * time.Minute)
+	h.manager.Observe(StatusReport{Timestamp: h.now, Providers: []Provider{{Name: "P", Error: "feed unavailable",
+		Services: []Service{{Name: "P", Provider: "P", Region: "Global", Status: StatusUnknown}}}}})
+	assertAlerts(t, "recovery", h.observe(start.Add(61*time.Minute), storage),
+		"Compute MAJOR_OUTAGE->OPERATIONAL", "Storage MAJOR_OUTAGE->OPERATIONAL")
+}
+
+func TestAlertManagerQuietHours(t *testing.T) {
+	start := time.Date(2024, 5, 1, 21, 0, 0, 0, time.UTC)
+	h := newAlertHarness(t, AlertConfig{QuietHours: "22:00-07:00"}, start)
+	compute := Service{Name: "Compute", Region: "Global", Status: StatusOperational}
+	down := compute
+	down.Status = StatusPartialOutage
+
+	assertAlerts(t, "baseline", h.observe(start, compute))
+	assertAlerts(t, "before quiet hours", h.observe(start.Add(30*time.Minute), down), "Compute OPERATIONAL->PARTIAL_OUTAGE")
+	assertAlerts(t, "recovered at night", h.observe(start.Add(2*time.Hour), compute))
+	assertAlerts(t, "down again at night", h.observe(start.Add(5*time.Hour), down))
+	assertAlerts(t, "still down at 06:59", h.observe(time.Date(2024, 5, 2, 6, 59, 0, 0, time.UTC), down))
+	// The night's flapping ended where the last alert left off
+	assertAlerts(t, "morning", h.observe(time.Date(2024, 5, 2, 7, 0, 0, 0, time.UTC), down))
+	assertAlerts(t, "recovered in the morning", h.observe(time.Date(2024, 5, 2, 7, 5, 0, 0, time.UTC), compute),
+		"Compute PARTIAL_OUTAGE->OPERATIONAL")
+}
+
+func TestParseQuietHours(t *testing.T) {
+	if start, end, err := parseQuietHours("22:00-07:30"); err != nil || start != 22*60 || end != 7*60+30 {
+		t.Errorf("got %d, %d, %v; want 1320, 450", start, end, err)
+	}
+	for _, value := range []string{"22:00", "22-07", "25:00-07:00", "22:00-07:00-08:00"} {
+		if _, _, err := parseQuietHours(value); err == nil {
+			t.Errorf("%q: want an error", value)
+		}
+	}
+}
+
+func TestEmailMessageHeaders(t *testing.T) {
+	notifier := &emailNotifier{From: "monitor@example.com", To: []string{"ops@example.com"}}
+	alert := Alert{
+		Provider: "Évil Cloud",
+		Service:  "API\r\nBcc: victim@example.com\r\n",
+		Region:   "Global",
+		From:     StatusOperational,
+		To:       StatusMajorOutage,
+		Details:  "line one\r\nline two",
+	}
+
+	message, err := mail.ReadMessage(bytes.NewReader(notifier.message([]Alert{alert})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range message.Header {
+		switch name {
+		case "From", "To", "Subject", "Content-Type":
+		default:
+			t.Errorf("unexpected header %s: %q", name, message.Header.Get(name))
+		}
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[Évil Cloud] API Bcc: victim@example.com (Global): Operational -> Major Outage"; subject != want {
+		t.Errorf("subject %q, want %q", subject, want)
+	}
+}
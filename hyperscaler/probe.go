@@ -0,0 +1,516 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// ProbeConfig controls the network probes shown under System Information
+type ProbeConfig struct {
+	// Interval is the time between probe rounds
+	Interval time.Duration `yaml:"interval"`
+	// Count is the number of samples taken per target each round
+	Count int `yaml:"count"`
+	// Timeout bounds a single sample
+	Timeout time.Duration `yaml:"timeout"`
+	// Window is how far back samples are kept for the statistics
+	Window time.Duration `yaml:"window"`
+	// IPURL returns the public IP address as plain text; empty disables the lookup
+	IPURL   string        `yaml:"ip_url"`
+	Targets []ProbeTarget `yaml:"targets"`
+}
+
+// ProbeTarget is a single endpoint to probe
+type ProbeTarget struct {
+	Name string `yaml:"name"`
+	// Type is one of icmp, tcp, tls, dns or http
+	Type string `yaml:"type"`
+	// Address is a host for icmp and dns, host:port for tcp and tls, and a URL for http
+	Address string `yaml:"address"`
+}
+
+// defaultProbeConfig returns the probes run when none are configured
+func defaultProbeConfig() ProbeConfig {
+	return ProbeConfig{
+		Interval: 30 * time.Second,
+		Count:    3,
+		Timeout:  5 * time.Second,
+		Window:   10 * time.Minute,
+		IPURL:    "https://api.ipify.org?format=text",
+		Targets: []ProbeTarget{
+			{Name: "Google", Type: "icmp", Address: "www.google.com"},
+			{Name: "Google DNS", Type: "dns", Address: "www.google.com"},
+			{Name: "Google APIs", Type: "http", Address: "https://www.googleapis.com/"},
+			{Name: "AWS us-east-1", Type: "tcp", Address: "ec2.us-east-1.amazonaws.com:443"},
+			{Name: "Azure Resource Manager", Type: "tls", Address: "management.azure.com:443"},
+			{Name: "Oracle Cloud us-ashburn-1", Type: "tcp", Address: "objectstorage.us-ashburn-1.oraclecloud.com:443"},
+		},
+	}
+}
+
+// probeFuncs measure one sample for each probe type
+var probeFuncs = map[string]func(ctx context.Context, address string) (time.Duration, error){
+	"icmp": probeICMP,
+	"tcp":  probeTCP,
+	"tls":  probeTLS,
+	"dns":  probeDNS,
+	"http": probeHTTP,
+}
+
+// validate checks the probe settings and fills in target defaults
+func (c *ProbeConfig) validate() error {
+	if c.Interval <= 0 || c.Timeout <= 0 || c.Window <= 0 {
+		return fmt.Errorf("probes.interval, probes.timeout and probes.window must be positive")
+	}
+	if c.Count < 1 {
+		return fmt.Errorf("probes.count must be at least 1")
+	}
+	for i := range c.Targets {
+		target := &c.Targets[i]
+		if _, ok := probeFuncs[target.Type]; !ok {
+			return fmt.Errorf("probe %q: unknown type %q", target.Name, target.Type)
+		}
+		if target.Address == "" {
+			return fmt.Errorf("probe %q: address is required", target.Name)
+		}
+		switch target.Type {
+		case "tcp", "tls":
+			if _, _, err := net.SplitHostPort(target.Address); err != nil {
+				return fmt.Errorf("probe %q: address must be host:port: %v", target.Name, err)
+			}
+		case "http":
+			u, err := url.Parse(target.Address)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("probe %q: address must be an http or https URL", target.Name)
+			}
+		}
+		if target.Name == "" {
+			target.Name = target.Address
+		}
+	}
+	return nil
+}
+
+// Latency is a round-trip time; it encodes to JSON in nanoseconds
+type Latency time.Duration
+
+func (l Latency) String() string {
+	if l <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f ms", float64(l)/float64(time.Millisecond))
+}
+
+// ProbeStats summarizes a target's samples over the rolling window
+type ProbeStats struct {
+	Name    string
+	Type    string
+	Address string
+	Samples int
+	Lost    int
+	// Loss is the percentage of samples that failed
+	Loss   float64
+	Min    Latency
+	Avg    Latency
+	Max    Latency
+	Jitter Latency
+	// LastError is the error of the most recent sample, if it failed
+	LastError string `json:",omitempty"`
+	LastProbe time.Time
+}
+
+type probeSample struct {
+	time time.Time
+	rtt  time.Duration
+	err  error
+}
+
+// probeWindow holds the recent samples of one target
+type probeWindow struct {
+	target  ProbeTarget
+	samples []probeSample
+}
+
+// ProbeManager runs probe rounds in the background and keeps a rolling
+// window of samples per target
+type ProbeManager struct {
+	mu        sync.Mutex
+	config    ProbeConfig
+	windows   []*probeWindow
+	publicIP  string
+	lastRound time.Time
+	started   bool
+}
+
+var probes = &ProbeManager{config: defaultProbeConfig()}
+
+// Configure replaces the probe settings. Targets that are still configured
+// keep their samples.
+func (m *ProbeManager) Configure(config ProbeConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing := make(map[ProbeTarget]*probeWindow)
+	for _, window := range m.windows {
+		existing[window.target] = window
+	}
+	var windows []*probeWindow
+	for _, target := range config.Targets {
+		window, ok := existing[target]
+		if !ok {
+			window = &probeWindow{target: target}
+		}
+		windows = append(windows, window)
+	}
+	m.config = config
+	m.windows = windows
+}
+
+// Start probes in the background, straight away and then every interval,
+// so a slow target never holds up the first report. SystemInfo is pending
+// until the first round completes; firstRound, if set, is called then.
+func (m *ProbeManager) Start(ctx context.Context, firstRound func()) {
+	m.mu.Lock()
+	if m.started {
+		m.mu.Unlock()
+		return
+	}
+	m.started = true
+	m.mu.Unlock()
+
+	go func() {
+		m.round(ctx)
+		if firstRound != nil && ctx.Err() == nil {
+			firstRound()
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(m.settings().Interval):
+				m.round(ctx)
+			}
+		}
+	}()
+}
+
+func (m *ProbeManager) settings() ProbeConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.config
+}
+
+// round probes every target concurrently; samples of one target are sequential
+func (m *ProbeManager) round(ctx context.Context) {
+	m.mu.Lock()
+	config := m.config
+	windows := append([]*probeWindow(nil), m.windows...)
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, window := range windows {
+		wg.Add(1)
+		go func(window *probeWindow) {
+			defer wg.Done()
+			probe := probeFuncs[window.target.Type]
+			for i := 0; i < config.Count && ctx.Err() == nil; i++ {
+				ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+				rtt, err := probe(ctx, window.target.Address)
+				cancel()
+				m.record(window, probeSample{time: time.Now(), rtt: rtt, err: err}, config.Window)
+			}
+		}(window)
+	}
+	if config.IPURL != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+			defer cancel()
+			ip := lookupPublicIP(ctx, config.IPURL)
+			m.mu.Lock()
+			m.publicIP = ip
+			m.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	m.lastRound = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *ProbeManager) record(window *probeWindow, sample probeSample, keep time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	window.samples = append(window.samples, sample)
+	cutoff := sample.time.Add(-keep)
+	drop := 0
+	for drop < len(window.samples) && window.samples[drop].time.Before(cutoff) {
+		drop++
+	}
+	window.samples = window.samples[drop:]
+}
+
+// SystemInfo returns the public IP and the probe statistics
+func (m *ProbeManager) SystemInfo() SystemInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info := SystemInfo{IPAddress: m.publicIP, LastCheck: m.lastRound, Pending: m.started && m.lastRound.IsZero()}
+	if info.Pending {
+		info.IPAddress = "Pending"
+	} else if info.IPAddress == "" {
+		info.IPAddress = "Unable to determine"
+	}
+	for _, window := range m.windows {
+		info.Probes = append(info.Probes, window.stats())
+	}
+	return info
+}
+
+// stats computes min/avg/max, jitter and loss over the window. Jitter is
+// the mean absolute difference between consecutive successful samples.
+func (w *probeWindow) stats() ProbeStats {
+	stats := ProbeStats{Name: w.target.Name, Type: w.target.Type, Address: w.target.Address, Samples: len(w.samples)}
+	if len(w.samples) == 0 {
+		return stats
+	}
+
+	var total, deltas time.Duration
+	var previous time.Duration
+	received := 0
+	for _, sample := range w.samples {
+		if sample.err != nil {
+			stats.Lost++
+			continue
+		}
+		if received == 0 || Latency(sample.rtt) < stats.Min {
+			stats.Min = Latency(sample.rtt)
+		}
+		if Latency(sample.rtt) > stats.Max {
+			stats.Max = Latency(sample.rtt)
+		}
+		if received > 0 {
+			deltas += time.Duration(math.Abs(float64(sample.rtt - previous)))
+		}
+		total += sample.rtt
+		previous = sample.rtt
+		received++
+	}
+	if received > 0 {
+		stats.Avg = Latency(total / time.Duration(received))
+	}
+	if received > 1 {
+		stats.Jitter = Latency(deltas / time.Duration(received-1))
+	}
+	stats.Loss = float64(stats.Lost) / float64(len(w.samples)) * 100
+
+	last := w.samples[len(w.samples)-1]
+	stats.LastProbe = last.time
+	if last.err != nil {
+		stats.LastError = last.err.Error()
+	}
+	return stats
+}
+
+func lookupPublicIP(ctx context.Context, ipURL string) string {
+	body, err := httpClient.Get(ctx, ipURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// probeTCP times a TCP connect
+func probeTCP(ctx context.Context, address string) (time.Duration, error) {
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	conn.Close()
+	return rtt, nil
+}
+
+// probeTLS times the TLS handshake only, after the TCP connection is up
+func probeTLS(ctx context.Context, address string) (time.Duration, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return 0, err
+	}
+	var dialer net.Dialer
+	raw, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return 0, err
+	}
+	defer raw.Close()
+
+	conn := tls.Client(raw, &tls.Config{ServerName: host})
+	start := time.Now()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// probeDNS times resolving a host name
+func probeDNS(ctx context.Context, address string) (time.Duration, error) {
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, address)
+	if err != nil {
+		return 0, err
+	}
+	if len(addrs) == 0 {
+		return 0, fmt.Errorf("no addresses for %s", address)
+	}
+	return time.Since(start), nil
+}
+
+// probeTransport opens a new connection for every HTTP sample so TTFB
+// includes connection setup, as a first visit would
+var probeTransport = &http.Transport{
+	Proxy:             http.ProxyFromEnvironment,
+	DisableKeepAlives: true,
+}
+
+// probeHTTP times from sending a GET until the first response byte
+func probeHTTP(ctx context.Context, address string) (time.Duration, error) {
+	var firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, address, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", httpClient.settings().UserAgent)
+
+	start := time.Now()
+	resp, err := probeTransport.RoundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return firstByte.Sub(start), nil
+}
+
+var icmpSequence uint32
+
+// probeICMP sends one echo request. It uses an unprivileged ICMP socket
+// where the kernel allows it (net.ipv4.ping_group_range on Linux), then a
+// raw socket, and falls back to the system ping command.
+func probeICMP(ctx context.Context, address string) (time.Duration, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", address)
+	if err != nil {
+		return 0, err
+	}
+	if len(ips) == 0 {
+		return 0, fmt.Errorf("no IPv4 address for %s", address)
+	}
+	ip := ips[0]
+
+	privileged := false
+	conn, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	if err != nil {
+		privileged = true
+		conn, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return probePingCommand(ctx, ip.String())
+		}
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Unprivileged sockets get their ID assigned by the kernel
+	id := os.Getpid() & 0xffff
+	seq := int(atomic.AddUint32(&icmpSequence, 1) & 0xffff)
+	message := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("hyperscaler")},
+	}
+	packet, err := message.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	if privileged {
+		dst = &net.IPAddr{IP: ip}
+	}
+	start := time.Now()
+	if _, err := conn.WriteTo(packet, dst); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || echo.Seq != seq || (privileged && echo.ID != id) {
+			continue
+		}
+		return time.Since(start), nil
+	}
+}
+
+// probePingCommand runs the system ping, which is usually setuid or has
+// the capability to open ICMP sockets
+func probePingCommand(ctx context.Context, host string) (time.Duration, error) {
+	output, err := exec.CommandContext(ctx, "ping", "-c", "1", host).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ping failed: %v", err)
+	}
+	outputStr := string(output)
+	start := strings.Index(outputStr, "time=")
+	if start < 0 {
+		return 0, fmt.Errorf("no reply from %s", host)
+	}
+	start += len("time=")
+	end := strings.IndexAny(outputStr[start:], " m")
+	if end < 0 {
+		return 0, fmt.Errorf("unexpected ping output")
+	}
+	ms, err := strconv.ParseFloat(outputStr[start:start+end], 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected ping output: %v", err)
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProbeStartDoesNotWaitForTheFirstRound(t *testing.T) {
+	release := make(chan struct{})
+	probeFuncs["test"] = func(ctx context.Context, address string) (time.Duration, error) {
+		<-release
+		return time.Millisecond, nil
+	}
+	t.Cleanup(func() { delete(probeFuncs, "test") })
+
+	config := defaultProbeConfig()
+	config.IPURL = ""
+	config.Count = 1
+	config.Interval = time.Hour
+	config.Targets = []ProbeTarget{{Name: "Example", Type: "test", Address: "example.com"}}
+	manager := &ProbeManager{}
+	manager.Configure(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	firstRound := make(chan struct{})
+	manager.Start(ctx, func() { close(firstRound) })
+
+	info := manager.SystemInfo()
+	if !info.Pending || info.IPAddress != "Pending" || info.Probes[0].Samples != 0 {
+		t.Errorf("before the first round: got %+v, want it pending", info)
+	}
+	if content := systemInfoContent(info); content != "System Information:\nIP Address: Pending\nExample (test): pending\nLast Network Check: Pending\n\n" {
+		t.Errorf("content %q", content)
+	}
+
+	close(release)
+	select {
+	case <-firstRound:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first round never completed")
+	}
+	info = manager.SystemInfo()
+	if info.Pending || info.IPAddress != "Unable to determine" || info.Probes[0].Samples != 1 {
+		t.Errorf("after the first round: got %+v", info)
+	}
+}
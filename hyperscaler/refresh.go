@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Refresh job states
+const (
+	jobRunning = "running"
+	jobDone    = "done"
+)
+
+// RefreshJob tracks one report generation. Every refresh requested while a
+// job is running joins that job instead of starting another.
+type RefreshJob struct {
+	ID       string
+	State    string
+	Started  time.Time
+	Finished time.Time `json:",omitempty"`
+	// Requests counts the refreshes served by this job, including the first
+	Requests int
+	// ReportTimestamp identifies the report the job produced
+	ReportTimestamp time.Time `json:",omitempty"`
+
+	done chan struct{}
+}
+
+// maxRefreshJobs is how many finished jobs are kept for polling
+const maxRefreshJobs = 50
+
+// reportRunner makes sure at most one report is being generated at a time
+type reportRunner struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	current *RefreshJob
+	jobs    map[string]*RefreshJob
+	order   []string
+	// finished is when the last job completed
+	finished time.Time
+}
+
+var refresher = &reportRunner{ctx: context.Background(), jobs: make(map[string]*RefreshJob)}
+
+// SetContext sets the context reports are generated under; cancelling it
+// aborts the checks of the job in flight
+func (r *reportRunner) SetContext(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ctx = ctx
+}
+
+// Wait blocks until no job is running, or ctx is done
+func (r *reportRunner) Wait(ctx context.Context) error {
+	r.mu.Lock()
+	job := r.current
+	r.mu.Unlock()
+	if job == nil {
+		return nil
+	}
+	select {
+	case <-job.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LastFinished returns when the last report generation completed
+func (r *reportRunner) LastFinished() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.finished
+}
+
+// Refresh starts a report generation, or joins the one in flight, and
+// returns the job without waiting for it
+func (r *reportRunner) Refresh() RefreshJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.start()
+}
+
+// Run generates a report, or joins the one in flight, and waits for it
+func (r *reportRunner) Run() RefreshJob {
+	r.mu.Lock()
+	job := r.start()
+	r.mu.Unlock()
+
+	<-job.done
+	return r.Job(job.ID)
+}
+
+// Job returns a copy of the job with the given ID
+func (r *reportRunner) Job(id string) RefreshJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job, ok := r.jobs[id]; ok {
+		return *job
+	}
+	return RefreshJob{}
+}
+
+// start must be called with r.mu held
+func (r *reportRunner) start() *RefreshJob {
+	if r.current != nil {
+		r.current.Requests++
+		return r.current
+	}
+
+	job := &RefreshJob{
+		ID:       newJobID(),
+		State:    jobRunning,
+		Started:  time.Now(),
+		Requests: 1,
+		done:     make(chan struct{}),
+	}
+	r.current = job
+	r.jobs[job.ID] = job
+	r.order = append(r.order, job.ID)
+	if len(r.order) > maxRefreshJobs {
+		delete(r.jobs, r.order[0])
+		r.order = r.order[1:]
+	}
+
+	go r.run(r.ctx, job)
+	return job
+}
+
+func (r *reportRunner) run(ctx context.Context, job *RefreshJob) {
+	report := generateReport(ctx)
+	aborted := ctx.Err() != nil
+	if aborted {
+		// Every check still running failed because of the cancellation, not
+		// the provider; keep that out of history and alerts
+		log.Printf("Report aborted by shutdown, discarding it")
+	} else {
+		setCurrentReport(report)
+	}
+
+	r.mu.Lock()
+	job.State = jobDone
+	job.Finished = time.Now()
+	r.finished = job.Finished
+	if !aborted {
+		job.ReportTimestamp = report.Timestamp
+	}
+	r.current = nil
+	r.mu.Unlock()
+	close(job.done)
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// handleRefresh starts a refresh, or joins the one in flight, and returns
+// its job so the caller can poll /refresh/jobs/<id>
+func handleRefresh(w http.ResponseWriter, r *http.Request) {
+	writeRefreshJob(w, refresher.Refresh())
+}
+
+func writeRefreshJob(w http.ResponseWriter, job RefreshJob) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"job":     job,
+	})
+}
+
+// handleRefreshJob reports the state of a refresh job
+func handleRefreshJob(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/refresh/jobs/")
+	job := refresher.Job(id)
+	if job.ID == "" {
+		http.Error(w, "unknown refresh job", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
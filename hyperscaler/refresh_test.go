@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMinIntervalReusesOnlySuccessfulResults(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	stub := &countingChecker{}
+	checker := &scheduledChecker{StatusChecker: stub, MinInterval: time.Minute, now: func() time.Time { return now }}
+
+	steps := []struct {
+		at        time.Duration
+		err       error
+		wantCalls int
+	}{
+		{0, nil, 1},
+		// Refreshes within the minimum interval reuse the result
+		{10 * time.Second, nil, 1},
+		{time.Minute, errors.New("feed unavailable"), 2},
+		// A failure is not worth keeping; the next refresh tries again
+		{70 * time.Second, nil, 3},
+		{80 * time.Second, nil, 3},
+	}
+	for _, step := range steps {
+		now = start.Add(step.at)
+		stub.err = step.err
+		_, err := checker.Check(context.Background())
+		if stub.calls != step.wantCalls {
+			t.Errorf("at %s: %d checks, want %d", step.at, stub.calls, step.wantCalls)
+		}
+		if (err == nil) != (step.err == nil) {
+			t.Errorf("at %s: error %v, want %v", step.at, err, step.err)
+		}
+	}
+}
+
+func TestRefreshesJoinTheJobInFlight(t *testing.T) {
+	stub := operationalStub("Example", 200*time.Millisecond)
+	useCheckers(t, stub)
+	reportMutex.RLock()
+	previous := currentReport
+	reportMutex.RUnlock()
+	t.Cleanup(func() {
+		reportMutex.Lock()
+		currentReport = previous
+		reportMutex.Unlock()
+	})
+
+	runner := &reportRunner{ctx: context.Background(), jobs: make(map[string]*RefreshJob)}
+	first := runner.Refresh()
+	var wg sync.WaitGroup
+	joined := make([]RefreshJob, 5)
+	for i := range joined {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			joined[i] = runner.Refresh()
+		}(i)
+	}
+	wg.Wait()
+	for _, job := range joined {
+		if job.ID != first.ID {
+			t.Errorf("refresh started job %s while %s was running", job.ID, first.ID)
+		}
+	}
+
+	done := runner.Run()
+	if done.ID != first.ID || done.State != jobDone || done.Requests != 7 || done.ReportTimestamp.IsZero() {
+		t.Errorf("got %+v, want job %s done after 7 requests", done, first.ID)
+	}
+	// Once it is done the next refresh starts a new job
+	if next := runner.Refresh(); next.ID == first.ID {
+		t.Error("refresh joined a finished job")
+	}
+	runner.Wait(context.Background())
+}
@@ -0,0 +1,215 @@
+package main
+
+// Run with the race detector: go test -race ./hyperscaler/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubChecker returns canned results after an optional delay
+type stubChecker struct {
+	name      string
+	services  []Service
+	incidents []Incident
+	err       error
+	delay     time.Duration
+	panics    bool
+}
+
+func (s *stubChecker) Name() string { return s.name }
+
+func (s *stubChecker) URL() string { return "https://status.example.com/" + s.name }
+
+func (s *stubChecker) Check(ctx context.Context) ([]Service, error) {
+	result, err := s.CheckFeed(ctx)
+	return result.Services, err
+}
+
+func (s *stubChecker) CheckFeed(ctx context.Context) (FeedResult, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return FeedResult{}, ctx.Err()
+	}
+	if s.panics {
+		panic("stub failure")
+	}
+	if s.err != nil {
+		return FeedResult{}, s.err
+	}
+	return FeedResult{Services: s.services, Incidents: s.incidents}, nil
+}
+
+// plainChecker only implements StatusChecker, so its incidents are never read
+type plainChecker struct {
+	stub *stubChecker
+}
+
+func (p *plainChecker) Name() string { return p.stub.Name() }
+
+func (p *plainChecker) URL() string { return p.stub.URL() }
+
+func (p *plainChecker) Check(ctx context.Context) ([]Service, error) { return p.stub.Check(ctx) }
+
+func operationalStub(name string, delay time.Duration) *stubChecker {
+	return &stubChecker{
+		name:  name,
+		delay: delay,
+		services: []Service{
+			{Name: name + " Compute", Provider: name, Status: StatusOperational, Region: "us-east-1"},
+			{Name: name + " Storage", Provider: name, Status: StatusOperational, Region: "Global"},
+		},
+	}
+}
+
+// useCheckers registers the stubs for the duration of the test
+func useCheckers(t *testing.T, list ...StatusChecker) {
+	t.Helper()
+	previous := registeredCheckers()
+	setCheckers(list)
+	t.Cleanup(func() { setCheckers(previous) })
+}
+
+func TestGenerateReportCollectsEveryChecker(t *testing.T) {
+	var list []StatusChecker
+	for i := 0; i < 25; i++ {
+		// Later checkers finish first, so arrival order differs from registration order
+		list = append(list, operationalStub(fmt.Sprintf("P%02d", i), time.Duration(25-i)*time.Millisecond))
+	}
+	useCheckers(t, list...)
+
+	report := generateReport(context.Background())
+
+	if len(report.Providers) != len(list) {
+		t.Fatalf("got %d providers, want %d", len(report.Providers), len(list))
+	}
+	for i, provider := range report.Providers {
+		if provider.Name != list[i].Name() {
+			t.Errorf("provider %d is %s, want %s in registration order", i, provider.Name, list[i].Name())
+		}
+		if len(provider.Services) != 2 {
+			t.Errorf("%s has %d services, want 2", provider.Name, len(provider.Services))
+		}
+	}
+	if len(report.Checks) != len(list) {
+		t.Fatalf("got %d checks, want %d", len(report.Checks), len(list))
+	}
+	for _, check := range report.Checks {
+		if check.Error != "" {
+			t.Errorf("%s: unexpected error %q", check.Provider, check.Error)
+		}
+		if check.Duration <= 0 {
+			t.Errorf("%s: duration %s was not recorded", check.Provider, check.Duration)
+		}
+	}
+}
+
+func TestGenerateReportCapturesErrorsPerChecker(t *testing.T) {
+	useCheckers(t,
+		operationalStub("Healthy", time.Millisecond),
+		&stubChecker{name: "Broken", err: errors.New("feed unavailable")},
+		&stubChecker{name: "Panicky", panics: true},
+	)
+
+	report := generateReport(context.Background())
+
+	checks := make(map[string]CheckResult)
+	for _, check := range report.Checks {
+		checks[check.Provider] = check
+	}
+	if checks["Healthy"].Error != "" {
+		t.Errorf("Healthy: unexpected error %q", checks["Healthy"].Error)
+	}
+	if checks["Broken"].Error != "feed unavailable" {
+		t.Errorf("Broken: error is %q, want the checker's error", checks["Broken"].Error)
+	}
+	if checks["Panicky"].Error == "" {
+		t.Errorf("Panicky: a panic was not captured as an error")
+	}
+
+	for _, provider := range report.Providers {
+		switch provider.Name {
+		case "Broken", "Panicky":
+			if provider.Error == "" || len(provider.Services) != 1 || provider.Services[0].Status != StatusUnknown {
+				t.Errorf("%s: want a single UNKNOWN row with the error, got %+v", provider.Name, provider)
+			}
+		case "Healthy":
+			if provider.Status() != StatusOperational {
+				t.Errorf("Healthy: status %s, want operational", provider.Status())
+			}
+		}
+	}
+}
+
+func TestGenerateReportUsesFeedResults(t *testing.T) {
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	feed := operationalStub("Feed", 0)
+	feed.incidents = []Incident{{ID: "b", Provider: "Feed", Started: started.Add(time.Hour)}, {ID: "a", Provider: "Feed", Started: started}}
+	plain := &plainChecker{operationalStub("Plain", 0)}
+	plain.stub.incidents = []Incident{{ID: "ignored", Provider: "Plain", Started: started}}
+	useCheckers(t, feed, plain)
+
+	report := generateReport(context.Background())
+
+	if len(report.Incidents) != 2 || report.Incidents[0].ID != "a" || report.Incidents[1].ID != "b" {
+		t.Errorf("incidents %+v, want the feed checker's two incidents oldest first", report.Incidents)
+	}
+}
+
+func TestGenerateReportHonoursCancellation(t *testing.T) {
+	useCheckers(t,
+		operationalStub("Fast", 0),
+		operationalStub("Stuck", time.Hour),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	report := generateReport(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("generateReport took %s after cancellation", elapsed)
+	}
+	for _, check := range report.Checks {
+		if check.Provider == "Stuck" && check.Error == "" {
+			t.Errorf("Stuck: want a cancellation error")
+		}
+		if check.Provider == "Fast" && check.Error != "" {
+			t.Errorf("Fast: unexpected error %q", check.Error)
+		}
+	}
+}
+
+func TestGenerateReportConcurrentCalls(t *testing.T) {
+	var list []StatusChecker
+	for i := 0; i < 10; i++ {
+		list = append(list, operationalStub(fmt.Sprintf("C%d", i), time.Duration(i)*time.Millisecond))
+	}
+	list = append(list, &stubChecker{name: "Failing", err: errors.New("boom")})
+	useCheckers(t, list...)
+
+	var wg sync.WaitGroup
+	reports := make([]StatusReport, 8)
+	for i := range reports {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reports[i] = generateReport(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	for i, report := range reports {
+		services := 0
+		for _, provider := range report.Providers {
+			services += len(provider.Services)
+		}
+		if len(report.Checks) != len(list) || services != 10*2+1 {
+			t.Errorf("report %d: %d checks and %d services, want %d and %d", i, len(report.Checks), services, len(list), 10*2+1)
+		}
+	}
+}
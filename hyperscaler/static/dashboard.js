@@ -0,0 +1,353 @@
+function showTab(tabName) {
+    // Hide all tabs
+    document.querySelectorAll('.tab-content').forEach(tab => {
+        tab.classList.remove('active');
+    });
+    document.querySelectorAll('.tab-button').forEach(button => {
+        button.classList.remove('active');
+    });
+    
+    // Show selected tab
+    document.getElementById(tabName + '-tab').classList.add('active');
+    event.target.classList.add('active');
+}
+
+function applyFilters() {
+    const region = document.getElementById('region-filter').value;
+    const groupBy = document.getElementById('group-by').value;
+
+    document.getElementById('by-provider').style.display = groupBy === 'provider' ? 'block' : 'none';
+    document.getElementById('by-region').style.display = groupBy === 'region' ? 'block' : 'none';
+
+    // Hide rows outside the selected region, and groups left empty
+    document.querySelectorAll('.status-group').forEach(group => {
+        let visible = 0;
+        group.querySelectorAll('tbody tr').forEach(row => {
+            const show = !region || row.dataset.region === region;
+            row.style.display = show ? '' : 'none';
+            if (show) visible++;
+        });
+        group.style.display = visible > 0 ? '' : 'none';
+    });
+
+    // Keep the selection in the URL so it survives a refresh
+    const params = new URLSearchParams(location.search);
+    region ? params.set('region', region) : params.delete('region');
+    groupBy !== 'provider' ? params.set('group', groupBy) : params.delete('group');
+    const query = params.toString();
+    history.replaceState(null, '', location.pathname + (query ? '?' + query : ''));
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+    const params = new URLSearchParams(location.search);
+    if (params.has('region')) {
+        document.getElementById('region-filter').value = params.get('region');
+    }
+    if (params.has('group')) {
+        document.getElementById('group-by').value = params.get('group');
+    }
+    applyFilters();
+    loadMaintenance();
+    connectEvents();
+});
+
+// Severity order, matching Status.Severity on the server
+const severities = ['OPERATIONAL', 'MAINTENANCE', 'UNKNOWN', 'DEGRADED', 'PARTIAL_OUTAGE', 'MAJOR_OUTAGE'];
+
+// providerStatus mirrors Provider.Status: the worst known service status
+function providerStatus(provider) {
+    const known = (provider.Services || []).map(s => s.Status).filter(s => s !== 'UNKNOWN');
+    if (known.length === 0) {
+        return provider.Error || (provider.Services || []).length > 0 ? 'UNKNOWN' : 'OPERATIONAL';
+    }
+    return known.reduce((worst, s) => severities.indexOf(s) > severities.indexOf(worst) ? s : worst, 'OPERATIONAL');
+}
+
+function serviceKey(service) {
+    return service.Provider + '|' + service.Name + '|' + service.Region;
+}
+
+// formatLatency matches Latency.String on the server
+function formatLatency(ns) {
+    return ns > 0 ? (ns / 1e6).toFixed(1) + ' ms' : '-';
+}
+
+function formatTime(value) {
+    return new Date(value).toLocaleTimeString();
+}
+
+function cell(text) {
+    return '<td>' + escapeHTML(text) + '</td>';
+}
+
+function statusCell(status) {
+    return '<td class="' + statusClass(status) + '">' + escapeHTML(statusLabel(status)) + '</td>';
+}
+
+// incidentURL links to the drill-down page of an incident
+function incidentURL(provider, id) {
+    return '/incident?provider=' + encodeURIComponent(provider) + '&id=' + encodeURIComponent(id);
+}
+
+function detailsCell(service) {
+    if (!service.IncidentID) {
+        return cell(service.Details);
+    }
+    return '<td><a href="' + escapeHTML(incidentURL(service.Provider, service.IncidentID)) + '" class="incident-link">' +
+        escapeHTML(service.Details) + '</a></td>';
+}
+
+function serviceRow(service, cells) {
+    return '<tr data-region="' + escapeHTML(service.Region) + '" data-key="' + escapeHTML(serviceKey(service)) + '">' +
+        cells.join('') + '</tr>';
+}
+
+function statusGroup(header, columns, rows) {
+    return '<div class="status-group"><div class="provider-header">' + header + '</div>' +
+        '<table class="status-table"><thead><tr>' + columns.map(c => '<th>' + c + '</th>').join('') + '</tr></thead>' +
+        '<tbody>' + rows.join('') + '</tbody></table></div>';
+}
+
+// renderReport patches the dashboard in place from a pushed report
+function renderReport(report) {
+    document.getElementById('last-updated').textContent = new Date(report.Timestamp).toLocaleString();
+    document.getElementById('ip-address').textContent = report.SystemInfo.IPAddress;
+    document.getElementById('network-check').textContent = report.SystemInfo.Pending ? 'Pending' : formatTime(report.SystemInfo.LastCheck);
+    document.getElementById('probe-rows').innerHTML = (report.SystemInfo.Probes || []).map(p =>
+        '<tr><td title="' + escapeHTML(p.Address) + '">' + escapeHTML(p.Name) + '</td>' +
+        cell(p.Type) + cell(formatLatency(p.Min)) + cell(formatLatency(p.Avg)) +
+        cell(formatLatency(p.Max)) + cell(formatLatency(p.Jitter)) +
+        cell(p.Samples ? p.Loss.toFixed(0) + '% (' + p.Lost + '/' + p.Samples + ')' : 'Pending') +
+        cell(p.LastError || '') + '</tr>'
+    ).join('');
+
+    const providers = report.Providers || [];
+    document.getElementById('by-provider').innerHTML = providers.map(p => {
+        const status = providerStatus(p);
+        const header = escapeHTML(p.Name) +
+            ' <span class="provider-status ' + statusClass(status) + '">' + escapeHTML(statusLabel(status)) + '</span>' +
+            ' <a href="' + escapeHTML(p.URL) + '" target="_blank" class="provider-link">View Official Status Page</a>';
+        const rows = (p.Services || []).map(s =>
+            serviceRow(s, [cell(s.Name), statusCell(s.Status), cell(s.Region), detailsCell(s), cell(formatTime(s.LastCheck))]));
+        return statusGroup(header, ['Service', 'Status', 'Region', 'Details', 'Last Check'], rows);
+    }).join('');
+
+    const regions = {};
+    providers.forEach(p => (p.Services || []).forEach(s => {
+        (regions[s.Region] = regions[s.Region] || []).push(s);
+    }));
+    const names = Object.keys(regions).sort();
+    document.getElementById('by-region').innerHTML = names.map(region => {
+        const rows = regions[region].map(s =>
+            serviceRow(s, [cell(s.Provider), cell(s.Name), statusCell(s.Status), detailsCell(s), cell(formatTime(s.LastCheck))]));
+        return statusGroup(escapeHTML(region), ['Provider', 'Service', 'Status', 'Details', 'Last Check'], rows);
+    }).join('');
+
+    // Keep the region filter in step with the regions now reported
+    const filter = document.getElementById('region-filter');
+    const selected = filter.value;
+    filter.innerHTML = '<option value="">All regions</option>' +
+        names.map(r => '<option value="' + escapeHTML(r) + '">' + escapeHTML(r) + '</option>').join('');
+    filter.value = names.includes(selected) ? selected : '';
+    applyFilters();
+}
+
+// highlightChange flashes the rows of a service that just changed status
+function highlightChange(transition) {
+    const key = transition.Provider + '|' + transition.Service + '|' + transition.Region;
+    document.querySelectorAll('tr[data-key]').forEach(row => {
+        if (row.dataset.key === key) {
+            row.classList.remove('changed');
+            void row.offsetWidth;
+            row.classList.add('changed');
+        }
+    });
+}
+
+let eventSource = null;
+
+function connectEvents() {
+    if (!window.EventSource) {
+        return;
+    }
+    const indicator = document.getElementById('live-indicator');
+    eventSource = new EventSource('/events');
+    eventSource.onopen = () => {
+        indicator.textContent = 'Live';
+        indicator.classList.add('connected');
+    };
+    eventSource.onerror = () => {
+        // EventSource reconnects by itself
+        indicator.textContent = 'Reconnecting...';
+        indicator.classList.remove('connected');
+    };
+    eventSource.addEventListener('report', e => {
+        renderReport(JSON.parse(e.data));
+        loadMaintenance();
+        if (document.getElementById('impact-tab').classList.contains('active')) {
+            loadImpact();
+        }
+    });
+    eventSource.addEventListener('change', e => highlightChange(JSON.parse(e.data)));
+}
+
+function escapeHTML(value) {
+    const div = document.createElement('div');
+    div.textContent = value;
+    return div.innerHTML;
+}
+
+function statusClass(status) {
+    return 'status-' + status.toLowerCase().replace(/_/g, '-');
+}
+
+function statusLabel(status) {
+    return status.toLowerCase().split('_').map(w => w.charAt(0).toUpperCase() + w.slice(1)).join(' ');
+}
+
+function loadHistory() {
+    const range = document.getElementById('history-range').value;
+    fetch('/history?range=' + range)
+        .then(response => response.json())
+        .then(data => {
+            const since = new Date(data.Since).getTime();
+            const span = new Date(data.Generated).getTime() - since;
+
+            document.getElementById('history-providers').innerHTML = (data.Providers || []).map(p => {
+                const outages = (p.Outages || []).map(o => {
+                    const start = Math.max(new Date(o.Start).getTime(), since);
+                    const end = new Date(o.End).getTime();
+                    const left = (start - since) / span * 100;
+                    const width = (end - start) / span * 100;
+                    const title = new Date(o.Start).toLocaleString() + ' - ' + (o.Ongoing ? 'ongoing' : new Date(o.End).toLocaleString());
+                    return '<div class="timeline-outage" style="left:' + left + '%;width:' + width + '%" title="' + escapeHTML(title) + '"></div>';
+                }).join('');
+                return '<tr><td>' + escapeHTML(p.Provider) + '</td>' +
+                    '<td>' + p.Uptime['24h'].toFixed(2) + '%</td>' +
+                    '<td>' + p.Uptime['7d'].toFixed(2) + '%</td>' +
+                    '<td>' + p.Uptime['30d'].toFixed(2) + '%</td>' +
+                    '<td><div class="timeline">' + outages + '</div></td></tr>';
+            }).join('');
+
+            document.getElementById('history-transitions').innerHTML = (data.Transitions || []).slice().reverse().map(t =>
+                '<tr><td>' + new Date(t.Time).toLocaleString() + '</td>' +
+                '<td>' + escapeHTML(t.Provider) + '</td>' +
+                '<td>' + escapeHTML(t.Service) + '</td>' +
+                '<td>' + escapeHTML(t.Region) + '</td>' +
+                '<td class="' + statusClass(t.To) + '">' + escapeHTML(statusLabel(t.From)) + ' &rarr; ' + escapeHTML(statusLabel(t.To)) + '</td>' +
+                '<td>' + escapeHTML(t.Details) + '</td></tr>'
+            ).join('');
+
+            document.getElementById('history-incidents').innerHTML = (data.Incidents || []).map(i => {
+                const resolved = new Date(i.Resolved).getFullYear() > 1 ? new Date(i.Resolved).toLocaleString() : 'Ongoing';
+                const rca = i.RCAURL ? '<a href="' + escapeHTML(i.RCAURL) + '" target="_blank">Postmortem</a>' : '';
+                return '<tr><td><a href="' + escapeHTML(incidentURL(i.Provider, i.ID)) + '" class="incident-link">' + escapeHTML(i.Title) + '</a></td>' +
+                    '<td>' + escapeHTML(i.Provider) + '</td>' +
+                    '<td>' + new Date(i.Started).toLocaleString() + '</td>' +
+                    '<td>' + resolved + '</td>' +
+                    '<td>' + rca + '</td>' +
+                    '<td>' + (i.Acknowledgement ? escapeHTML(i.Acknowledgement.By || 'yes') : '') + '</td></tr>';
+            }).join('');
+        })
+        .catch(error => {
+            alert('Error loading history: ' + error);
+        });
+}
+
+// waitForJob polls a refresh job until it has finished
+function waitForJob(id) {
+    return fetch('/refresh/jobs/' + id)
+        .then(response => {
+            if (!response.ok) {
+                throw new Error(response.statusText);
+            }
+            return response.json();
+        })
+        .then(job => job.State === 'done' ? job :
+            new Promise(resolve => setTimeout(resolve, 1000)).then(() => waitForJob(id)));
+}
+
+function loadImpact() {
+    fetch('/api/impact')
+        .then(response => response.json())
+        .then(data => {
+            const services = data.Services || [];
+            if (services.length === 0) {
+                document.getElementById('impact-services').innerHTML =
+                    '<tr><td colspan="4">No dependency manifest is configured; see dependencies_path.</td></tr>';
+                return;
+            }
+            document.getElementById('impact-services').innerHTML = services.map(s => {
+                const causes = (s.Causes || []).map(c => {
+                    const text = escapeHTML(c.Provider + ' ' + c.Service + ' (' + c.Region + '): ' + statusLabel(c.Status));
+                    const link = c.IncidentID ? ' <a href="' + escapeHTML(incidentURL(c.Provider, c.IncidentID)) + '" class="incident-link">incident</a>' : '';
+                    return '<div title="' + escapeHTML(c.Details) + '">' + text + link + '</div>';
+                }).join('');
+                return '<tr>' + cell(s.Name) + cell(s.Owner || '') + statusCell(s.Status) + '<td>' + causes + '</td></tr>';
+            }).join('');
+        })
+        .catch(error => {
+            alert('Error loading impact: ' + error);
+        });
+}
+
+// loadMaintenance fills the upcoming maintenance panel; the server applies
+// the configured regions and horizon
+function loadMaintenance() {
+    fetch('/api/maintenance')
+        .then(response => response.json())
+        .then(windows => {
+            const rows = document.getElementById('maintenance-rows');
+            if (!windows || windows.length === 0) {
+                rows.innerHTML = '<tr><td colspan="6">No maintenance scheduled in the selected regions.</td></tr>';
+                return;
+            }
+            const now = new Date();
+            rows.innerHTML = windows.map(m => {
+                const active = new Date(m.Start) <= now && now < new Date(m.End) && m.State !== 'completed';
+                const title = m.URL ? '<a href="' + escapeHTML(m.URL) + '" target="_blank" class="incident-link">' + escapeHTML(m.Title) + '</a>' : escapeHTML(m.Title);
+                return '<tr' + (active ? ' class="maintenance-active"' : '') + ' title="' + escapeHTML(m.Description || '') + '">' +
+                    cell(m.Provider) + '<td>' + title + '</td>' + cell((m.Regions || []).join(', ') || 'All') +
+                    cell(new Date(m.Start).toLocaleString()) + cell(new Date(m.End).toLocaleString()) +
+                    cell(m.State.replace(/_/g, ' ')) + '</tr>';
+            }).join('');
+        })
+        .catch(error => {
+            console.log('Error loading maintenance: ' + error);
+        });
+}
+
+function refreshStatus() {
+    const loading = document.getElementById('refresh-loading');
+    const button = document.querySelector('.refresh-button');
+    loading.style.display = 'block';
+    button.disabled = true;
+
+    // Concurrent refreshes share one job, so repeated clicks are cheap
+    fetch('/refresh', {method: 'POST'})
+        .then(response => {
+            if (!response.ok) {
+                return response.text().then(text => { throw new Error(text.trim() || response.statusText); });
+            }
+            return response.json();
+        })
+        .then(data => {
+            if (!data.success) {
+                throw new Error(data.error);
+            }
+            return waitForJob(data.job.ID);
+        })
+        .then(() => {
+            // Live dashboards receive the new report over /events
+            if (!eventSource || eventSource.readyState !== EventSource.OPEN) {
+                location.reload();
+            }
+        })
+        .catch(error => {
+            alert('Error refreshing status: ' + error);
+        })
+        .finally(() => {
+            loading.style.display = 'none';
+            button.disabled = false;
+        });
+}
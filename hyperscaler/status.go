@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Status is the normalized state of a service
+type Status string
+
+const (
+	StatusOperational   Status = "OPERATIONAL"
+	StatusMaintenance   Status = "MAINTENANCE"
+	StatusUnknown       Status = "UNKNOWN"
+	StatusDegraded      Status = "DEGRADED"
+	StatusPartialOutage Status = "PARTIAL_OUTAGE"
+	StatusMajorOutage   Status = "MAJOR_OUTAGE"
+)
+
+// allStatuses lists every status in severity order
+var allStatuses = []Status{
+	StatusOperational,
+	StatusMaintenance,
+	StatusUnknown,
+	StatusDegraded,
+	StatusPartialOutage,
+	StatusMajorOutage,
+}
+
+// Severity orders statuses from 0 (operational) to 5 (major outage).
+// Unknown ranks below any real problem so it never masks one in a rollup.
+func (s Status) Severity() int {
+	for i, status := range allStatuses {
+		if status == s {
+			return i
+		}
+	}
+	return StatusUnknown.Severity()
+}
+
+// Healthy reports whether the service is working as expected; planned
+// maintenance counts as healthy
+func (s Status) Healthy() bool {
+	return s == StatusOperational || s == StatusMaintenance
+}
+
+// Problem reports whether the service has a known issue
+func (s Status) Problem() bool {
+	return s.Severity() > StatusUnknown.Severity()
+}
+
+// Label returns the status as shown to people
+func (s Status) Label() string {
+	switch s {
+	case StatusOperational:
+		return "Operational"
+	case StatusMaintenance:
+		return "Maintenance"
+	case StatusDegraded:
+		return "Degraded"
+	case StatusPartialOutage:
+		return "Partial Outage"
+	case StatusMajorOutage:
+		return "Major Outage"
+	}
+	return "Unknown"
+}
+
+// CSSClass returns the dashboard class used to colour the status
+func (s Status) CSSClass() string {
+	return "status-" + strings.ReplaceAll(strings.ToLower(string(s.normalize())), "_", "-")
+}
+
+func (s Status) normalize() Status {
+	for _, status := range allStatuses {
+		if status == s {
+			return s
+		}
+	}
+	return StatusUnknown
+}
+
+// UnmarshalText accepts the current names plus the UP/DOWN values written
+// by older versions, so existing history files keep loading
+func (s *Status) UnmarshalText(text []byte) error {
+	status, err := ParseStatus(string(text))
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// ParseStatus parses a status name, case-insensitively
+func ParseStatus(value string) (Status, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(value))
+	normalized = strings.NewReplacer("-", "_", " ", "_").Replace(normalized)
+	switch normalized {
+	case "UP":
+		return StatusOperational, nil
+	case "DOWN":
+		return StatusMajorOutage, nil
+	}
+	for _, status := range allStatuses {
+		if string(status) == normalized {
+			return status, nil
+		}
+	}
+	return StatusUnknown, fmt.Errorf("unknown status %q", value)
+}
+
+// worstStatus returns the most severe status in the list, or Operational
+// when the list is empty
+func worstStatus(statuses ...Status) Status {
+	worst := StatusOperational
+	for _, status := range statuses {
+		if status.Severity() > worst.Severity() {
+			worst = status
+		}
+	}
+	return worst
+}
+
+// statuspageStatus maps an Atlassian Statuspage component status
+func statuspageStatus(value string) Status {
+	switch value {
+	case "operational":
+		return StatusOperational
+	case "degraded_performance":
+		return StatusDegraded
+	case "partial_outage":
+		return StatusPartialOutage
+	case "major_outage":
+		return StatusMajorOutage
+	case "under_maintenance":
+		return StatusMaintenance
+	}
+	return StatusUnknown
+}
+
+// statuspageImpact maps the impact of an Atlassian Statuspage incident
+func statuspageImpact(value string) Status {
+	switch value {
+	case "none":
+		return StatusOperational
+	case "minor":
+		return StatusDegraded
+	case "major":
+		return StatusPartialOutage
+	case "critical":
+		return StatusMajorOutage
+	case "maintenance":
+		return StatusMaintenance
+	}
+	return StatusUnknown
+}
+
+// googleStatus maps a Google incidents.json status_impact and severity
+func googleStatus(impact, severity string) Status {
+	switch impact {
+	case "SERVICE_INFORMATION", "AVAILABLE":
+		return StatusOperational
+	case "SERVICE_DISRUPTION":
+		if severity == "low" {
+			return StatusDegraded
+		}
+		return StatusPartialOutage
+	case "SERVICE_OUTAGE":
+		return StatusMajorOutage
+	}
+	return StatusDegraded
+}
+
+// feedItemStatus guesses the status of an open incident from its wording.
+// RSS feeds carry no structured severity, so anything unrecognised is Degraded.
+func feedItemStatus(item feedItem) Status {
+	text := strings.ToLower(item.Title + " " + item.Description)
+	switch {
+	case strings.Contains(text, "maintenance"):
+		return StatusMaintenance
+	case strings.Contains(text, "partial"), strings.Contains(text, "some customers"), strings.Contains(text, "subset of"):
+		return StatusPartialOutage
+	case strings.Contains(text, "outage"), strings.Contains(text, "service disruption"), strings.Contains(text, "unavailable"):
+		return StatusMajorOutage
+	}
+	return StatusDegraded
+}
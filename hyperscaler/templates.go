@@ -0,0 +1,139 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// embeddedAssets holds the page templates and static files shipped in the binary
+//
+//go:embed templates/*.html static
+var embeddedAssets embed.FS
+
+// templateSet parses the page templates once and serves static assets.
+// In dev mode both are read from the source tree on every request, so
+// edits show up on reload. A theme directory can override any template or
+// static file by name.
+type templateSet struct {
+	mu sync.RWMutex
+	// devDir is the source tree in dev mode, empty otherwise
+	devDir   string
+	themeDir string
+	tmpl     *template.Template
+}
+
+// pages is the shared template set, configured in main
+var pages = &templateSet{}
+
+// Configure sets the dev mode source tree, empty for the embedded assets,
+// and the theme directory, and parses the templates
+func (t *templateSet) Configure(devDir, themeDir string) error {
+	if devDir != "" {
+		if matches, _ := filepath.Glob(filepath.Join(devDir, "templates", "*.html")); len(matches) == 0 {
+			return fmt.Errorf("dev mode: no templates in %s; pass the hyperscaler source directory with -dev-dir", filepath.Join(devDir, "templates"))
+		}
+	}
+	tmpl, err := parseTemplates(assetsFS(devDir), themeDir)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.devDir = devDir
+	t.themeDir = themeDir
+	t.tmpl = tmpl
+	return nil
+}
+
+// assetsFS returns the source tree in dev mode and the embedded files otherwise
+func assetsFS(devDir string) fs.FS {
+	if devDir != "" {
+		return os.DirFS(devDir)
+	}
+	return embeddedAssets
+}
+
+// sourceDir is the directory this file was compiled from, where -dev finds
+// the templates unless -dev-dir says otherwise
+func sourceDir() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return "."
+	}
+	return filepath.Dir(file)
+}
+
+// parseTemplates parses every page template, then the theme's templates on
+// top so a theme file replaces the built-in template of the same name
+func parseTemplates(assets fs.FS, themeDir string) (*template.Template, error) {
+	tmpl, err := template.New("").ParseFS(assets, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing templates: %v", err)
+	}
+	if themeDir == "" {
+		return tmpl, nil
+	}
+
+	overrides, err := filepath.Glob(filepath.Join(themeDir, "templates", "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading theme templates: %v", err)
+	}
+	if len(overrides) > 0 {
+		if tmpl, err = tmpl.ParseFiles(overrides...); err != nil {
+			return nil, fmt.Errorf("error parsing theme templates: %v", err)
+		}
+	}
+	return tmpl, nil
+}
+
+// Execute renders a page template by file name, e.g. "status.html"
+func (t *templateSet) Execute(w http.ResponseWriter, name string, data interface{}) {
+	t.mu.RLock()
+	devDir, themeDir, tmpl := t.devDir, t.themeDir, t.tmpl
+	t.mu.RUnlock()
+
+	if devDir != "" || tmpl == nil {
+		var err error
+		if tmpl, err = parseTemplates(assetsFS(devDir), themeDir); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
+		// Headers may already be written; log so the failure is not lost
+		log.Printf("Error rendering %s: %v", name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ServeHTTP serves /static/ from the theme directory when it has the file,
+// otherwise from the embedded assets (or the source tree in dev mode)
+func (t *templateSet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mu.RLock()
+	devDir, themeDir := t.devDir, t.themeDir
+	t.mu.RUnlock()
+
+	name := path.Clean("/" + r.URL.Path)
+	if themeDir != "" {
+		themed := filepath.Join(themeDir, filepath.FromSlash(name))
+		if info, err := os.Stat(themed); err == nil && !info.IsDir() {
+			http.ServeFile(w, r, themed)
+			return
+		}
+	}
+	if devDir != "" {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.FileServer(http.FS(assetsFS(devDir))).ServeHTTP(w, r)
+}